@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// FinishedJobTTL is how long done, failed and cancelled jobs are kept
+	FinishedJobTTL = 7 * 24 * time.Hour
+
+	defaultMaxAttempts = 5
+	pollInterval       = 5 * time.Second
+	jobTimeout         = time.Minute
+	// jobLease has to outlast jobTimeout or a slow job could be picked up
+	// twice
+	jobLease    = 2 * jobTimeout
+	baseBackoff = time.Minute
+	maxBackoff  = time.Hour
+)
+
+// Handler runs one job. Returning an error retries the job later, unless it
+// was wrapped with Permanent or the job is out of attempts.
+type Handler func(ctx context.Context, job *models.Job) error
+
+var handlers = map[string]Handler{
+	TypeMeetingInvitation: sendInvitation,
+	TypeMeetingReminder:   sendReminder,
+	TypeWebhookDelivery:   deliverWebhook,
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying won't fix
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Enqueue adds a job to run at runAt, or straight away if runAt is zero.
+// Jobs sharing a key can be cancelled together.
+func Enqueue(jobType, key string, payload interface{}, runAt time.Time) error {
+	return enqueue(jobType, key, payload, runAt, defaultMaxAttempts)
+}
+
+func enqueue(jobType, key string, payload interface{}, runAt time.Time, maxAttempts int) error {
+	if _, ok := handlers[jobType]; !ok {
+		return fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	data, err := bson.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return models.CreateJob(utils.GetJobsCollection(), &models.Job{
+		Type:        jobType,
+		Key:         key,
+		Payload:     data,
+		MaxAttempts: maxAttempts,
+		RunAt:       runAt,
+	})
+}
+
+// Cancel stops the pending jobs with a key from running
+func Cancel(key string) error {
+	return models.CancelJobs(utils.GetJobsCollection(), key)
+}
+
+// Run works through due jobs until the process exits. Several instances can
+// run it at once since each job is claimed before it runs.
+func Run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			job, err := models.ClaimDueJob(utils.GetJobsCollection(), jobLease)
+			if err != nil {
+				break
+			}
+			runJob(job)
+		}
+	}
+}
+
+func runJob(job *models.Job) {
+	collection := utils.GetJobsCollection()
+
+	handler, ok := handlers[job.Type]
+	if !ok {
+		models.FinishJob(collection, job.ID, models.JobStatusFailed, "unknown job type", time.Time{})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	err := handler(ctx, job)
+	if err == nil {
+		models.FinishJob(collection, job.ID, models.JobStatusDone, "", time.Time{})
+		return
+	}
+
+	var permanent permanentError
+	if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Printf("Job %s (%s) failed: %v", job.ID.Hex(), job.Type, err)
+		models.FinishJob(collection, job.ID, models.JobStatusFailed, err.Error(), time.Time{})
+		return
+	}
+
+	retryAt := time.Now().Add(backoff(job.Attempts))
+	models.FinishJob(collection, job.ID, models.JobStatusPending, err.Error(), retryAt)
+}
+
+// backoff doubles from a minute after each failed attempt, up to an hour
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// finalAttempt reports whether a failure now means the job gives up, so
+// handlers can record the failure where users will see it
+func finalAttempt(job *models.Job) bool {
+	return job.Attempts >= job.MaxAttempts
+}
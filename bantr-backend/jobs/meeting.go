@@ -0,0 +1,239 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/mailer"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	TypeMeetingInvitation = "meeting.invitation"
+	TypeMeetingReminder   = "meeting.reminder"
+)
+
+const emailTimeFormat = "Mon, 2 Jan 2006 15:04 MST"
+
+type invitationPayload struct {
+	RoomID string `bson:"room_id"`
+	Email  string `bson:"email"`
+	// Token is the RSVP token for the link in the email. Only its hash is
+	// kept on the meeting, so this is the one place it exists until sent.
+	Token  string `bson:"token"`
+	Update bool   `bson:"update"`
+	// SentBy is the user the email goes out on behalf of, for rate limiting
+	SentBy string `bson:"sent_by"`
+}
+
+type reminderPayload struct {
+	RoomID string `bson:"room_id"`
+	Email  string `bson:"email"`
+	// StartsAt is the start time the reminder was queued for, so reminders
+	// for a meeting that has since moved are dropped
+	StartsAt time.Time `bson:"starts_at"`
+}
+
+func invitationKey(roomID string) string {
+	return "meeting-invitations:" + roomID
+}
+
+func reminderKey(roomID string) string {
+	return "meeting-reminders:" + roomID
+}
+
+// QueueInvitation emails someone their invitation on sentBy's behalf.
+// update is set when they were invited before and the meeting changed.
+func QueueInvitation(roomID, email, token, sentBy string, update bool) error {
+	payload := invitationPayload{RoomID: roomID, Email: email, Token: token, Update: update, SentBy: sentBy}
+	return Enqueue(TypeMeetingInvitation, invitationKey(roomID), payload, time.Time{})
+}
+
+// InvitationsSentSince counts the invitation emails queued on a user's
+// behalf since a point in time
+func InvitationsSentSince(userID string, since time.Time) (int64, error) {
+	return models.CountRecentJobs(utils.GetJobsCollection(), TypeMeetingInvitation, bson.M{"sent_by": userID}, since)
+}
+
+// ScheduleReminder queues one person's reminder, as long as the meeting is
+// scheduled with reminders on and the reminder time hasn't passed
+func ScheduleReminder(meeting *models.Meeting, email string) error {
+	schedule := meeting.Schedule
+	if schedule == nil || schedule.ReminderMinutes == 0 {
+		return nil
+	}
+
+	runAt := schedule.StartsAt.Add(-time.Duration(schedule.ReminderMinutes) * time.Minute)
+	if runAt.Before(time.Now()) {
+		return nil
+	}
+
+	payload := reminderPayload{RoomID: meeting.RoomID, Email: email, StartsAt: schedule.StartsAt}
+	return Enqueue(TypeMeetingReminder, reminderKey(meeting.RoomID), payload, runAt)
+}
+
+// ScheduleReminders replaces a meeting's queued reminders with new ones for
+// the host and everyone invited. Whether someone declined is checked when
+// the reminder goes out, since they can still change their mind.
+func ScheduleReminders(meeting *models.Meeting) error {
+	if err := Cancel(reminderKey(meeting.RoomID)); err != nil {
+		return err
+	}
+
+	recipients := []string{}
+	if hostEmail := meetingHostEmail(meeting); hostEmail != "" {
+		recipients = append(recipients, hostEmail)
+	}
+	for _, invitation := range meeting.Invitations {
+		recipients = append(recipients, invitation.Email)
+	}
+
+	for _, email := range recipients {
+		if err := ScheduleReminder(meeting, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelMeetingJobs drops the invitations and reminders still queued for a
+// meeting
+func CancelMeetingJobs(roomID string) error {
+	if err := Cancel(invitationKey(roomID)); err != nil {
+		return err
+	}
+	return Cancel(reminderKey(roomID))
+}
+
+func meetingHostEmail(meeting *models.Meeting) string {
+	hostID, err := bson.ObjectIDFromHex(meeting.CreatedBy)
+	if err != nil {
+		return ""
+	}
+	host, err := models.FindUserByID(utils.GetUsersCollection(), hostID)
+	if err != nil || host.IsBot {
+		return ""
+	}
+	return host.Email
+}
+
+// loadJobMeeting finds the meeting a job is for. A meeting that's gone is
+// a permanent failure.
+func loadJobMeeting(roomID string) (*models.Meeting, error) {
+	meeting, err := models.FindMeetingByRoomID(utils.GetMeetingsCollection(), roomID)
+	if err == mongo.ErrNoDocuments {
+		return nil, Permanent(err)
+	}
+	return meeting, err
+}
+
+func sendInvitation(ctx context.Context, job *models.Job) error {
+	var payload invitationPayload
+	if err := bson.Unmarshal(job.Payload, &payload); err != nil {
+		return Permanent(err)
+	}
+
+	meeting, err := loadJobMeeting(payload.RoomID)
+	if err != nil {
+		return err
+	}
+
+	// Skip invitations that were withdrawn, or replaced by a newer email
+	// with a fresh token, since this was queued
+	invitation := meeting.FindInvitation(payload.Email)
+	if !meeting.IsActive || invitation == nil || invitation.TokenHash != utils.HashToken(payload.Token) {
+		return nil
+	}
+
+	subject := "Invitation: " + meeting.Title
+	if payload.Update {
+		subject = "Updated invitation: " + meeting.Title
+	}
+
+	lines := []string{fmt.Sprintf("%s invited you to %s.", meeting.CreatorName, meeting.Title), ""}
+	if meeting.Schedule != nil {
+		lines = append(lines, fmt.Sprintf("When: %s (%d minutes)",
+			meeting.Schedule.StartsAt.UTC().Format(emailTimeFormat), meeting.Schedule.DurationMinutes))
+	}
+	lines = append(lines,
+		"Join: "+utils.MeetingURL(meeting.RoomID),
+		"",
+		"Let "+meeting.CreatorName+" know if you're coming:",
+		utils.InvitationURL(payload.Token),
+	)
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      []string{payload.Email},
+		Subject: subject,
+		Text:    strings.Join(lines, "\n"),
+		Attachments: []mailer.Attachment{{
+			Filename:    "invite.ics",
+			ContentType: "text/calendar; charset=utf-8; method=REQUEST",
+			Data:        utils.MeetingICS(meeting, payload.Email),
+		}},
+	})
+
+	meetings := utils.GetMeetingsCollection()
+	if err != nil {
+		log.Printf("Error sending invitation for %s to %s: %v", meeting.RoomID, payload.Email, err)
+		if finalAttempt(job) {
+			models.SetInvitationStatus(meetings, meeting.RoomID, payload.Email, models.InvitationStatusFailed, err.Error())
+		}
+		return err
+	}
+
+	// The email is out, so a failure to record that mustn't send it again
+	models.SetInvitationStatus(meetings, meeting.RoomID, payload.Email, models.InvitationStatusSent, "")
+	return nil
+}
+
+func sendReminder(ctx context.Context, job *models.Job) error {
+	var payload reminderPayload
+	if err := bson.Unmarshal(job.Payload, &payload); err != nil {
+		return Permanent(err)
+	}
+
+	meeting, err := loadJobMeeting(payload.RoomID)
+	if err != nil {
+		return err
+	}
+
+	schedule := meeting.Schedule
+	if !meeting.IsActive || schedule == nil || !schedule.StartsAt.Equal(payload.StartsAt) {
+		return nil
+	}
+	// Skip people who were uninvited or have said they won't come
+	invitation := meeting.FindInvitation(payload.Email)
+	if invitation == nil && payload.Email != meetingHostEmail(meeting) {
+		return nil
+	}
+	if invitation != nil && invitation.RSVP == models.RSVPDeclined {
+		return nil
+	}
+
+	subject := "Reminder: " + meeting.Title + " is starting"
+	switch minutes := int(time.Until(schedule.StartsAt).Round(time.Minute) / time.Minute); {
+	case minutes == 1:
+		subject = "Reminder: " + meeting.Title + " starts in 1 minute"
+	case minutes > 1:
+		subject = fmt.Sprintf("Reminder: %s starts in %d minutes", meeting.Title, minutes)
+	}
+
+	text := strings.Join([]string{
+		fmt.Sprintf("%s starts at %s.", meeting.Title, schedule.StartsAt.UTC().Format(emailTimeFormat)),
+		"",
+		"Join: " + utils.MeetingURL(meeting.RoomID),
+	}, "\n")
+
+	return mailer.Send(ctx, mailer.Message{
+		To:      []string{payload.Email},
+		Subject: subject,
+		Text:    text,
+	})
+}
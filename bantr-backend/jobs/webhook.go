@@ -0,0 +1,219 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const TypeWebhookDelivery = "webhook.delivery"
+
+const (
+	// webhookMaxAttempts is how many times a delivery is tried before it's
+	// marked failed. With the queue's backoff the last try comes about four
+	// hours after the first.
+	webhookMaxAttempts = 10
+	webhookTimeout     = 10 * time.Second
+)
+
+type webhookDeliveryPayload struct {
+	WebhookID  bson.ObjectID `bson:"webhook_id"`
+	DeliveryID bson.ObjectID `bson:"delivery_id"`
+}
+
+func webhookKey(webhookID bson.ObjectID) string {
+	return "webhook-deliveries:" + webhookID.Hex()
+}
+
+var errPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// webhookClient refuses to connect to loopback and private addresses so
+// webhooks can't be pointed at things inside our network. Set
+// WEBHOOK_ALLOW_PRIVATE=true to allow them when developing locally.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true" {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+					ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	// Following redirects would let a public URL bounce us somewhere private
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// StartWebhookDispatch queues a delivery for every webhook that wants an
+// event as it's published
+func StartWebhookDispatch() {
+	models.SubscribeEvents(queueWebhookDeliveries)
+}
+
+func queueWebhookDeliveries(event models.Event) {
+	meeting := event.Meeting
+	if meeting == nil {
+		var err error
+		meeting, err = models.FindMeetingByRoomID(utils.GetMeetingsCollection(), event.RoomID)
+		if err != nil {
+			// Rooms without a meeting behind them have nobody to notify
+			return
+		}
+		event.Meeting = meeting
+	}
+
+	webhooks, err := models.GetMeetingWebhooks(utils.GetWebhooksCollection(), meeting, event.Type)
+	if err != nil || len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling event %s: %v", event.ID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		delivery := &models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   string(payload),
+		}
+		if err := queueWebhookDelivery(delivery); err != nil {
+			log.Printf("Error queueing webhook delivery for %s: %v", webhook.ID.Hex(), err)
+		}
+	}
+}
+
+// queueWebhookDelivery logs a delivery and queues the job that sends it
+func queueWebhookDelivery(delivery *models.WebhookDelivery) error {
+	if err := models.CreateWebhookDelivery(utils.GetWebhookDeliveriesCollection(), delivery); err != nil {
+		return err
+	}
+
+	payload := webhookDeliveryPayload{WebhookID: delivery.WebhookID, DeliveryID: delivery.ID}
+	return enqueue(TypeWebhookDelivery, webhookKey(delivery.WebhookID), payload, time.Time{}, webhookMaxAttempts)
+}
+
+// RedeliverWebhook queues a fresh copy of a delivery to be sent right away.
+// The original stays in the log as it was.
+func RedeliverWebhook(delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	originalID := delivery.ID
+	redelivery := &models.WebhookDelivery{
+		WebhookID:    delivery.WebhookID,
+		EventID:      delivery.EventID,
+		EventType:    delivery.EventType,
+		Payload:      delivery.Payload,
+		RedeliveryOf: &originalID,
+	}
+	if err := queueWebhookDelivery(redelivery); err != nil {
+		return nil, err
+	}
+	return redelivery, nil
+}
+
+func deliverWebhook(ctx context.Context, job *models.Job) error {
+	var payload webhookDeliveryPayload
+	if err := bson.Unmarshal(job.Payload, &payload); err != nil {
+		return Permanent(err)
+	}
+
+	deliveries := utils.GetWebhookDeliveriesCollection()
+	delivery, err := models.FindWebhookDelivery(deliveries, payload.WebhookID, payload.DeliveryID)
+	if err == mongo.ErrNoDocuments {
+		// Deleted along with its webhook since this was queued
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	webhook, err := models.FindWebhookByID(utils.GetWebhooksCollection(), delivery.WebhookID)
+	if err == mongo.ErrNoDocuments || (err == nil && !webhook.Active) {
+		attempt := models.DeliveryAttempt{At: time.Now(), Error: "webhook was deleted or disabled"}
+		models.RecordDeliveryAttempt(deliveries, delivery.ID, attempt, models.DeliveryStatusFailed, attempt.At)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	attempt := sendWebhook(ctx, webhook, delivery)
+	if attempt.Error == "" {
+		models.RecordDeliveryAttempt(deliveries, delivery.ID, attempt, models.DeliveryStatusSucceeded, attempt.At)
+		return nil
+	}
+
+	status := models.DeliveryStatusPending
+	next := attempt.At.Add(backoff(job.Attempts))
+	if finalAttempt(job) {
+		status = models.DeliveryStatusFailed
+		next = attempt.At
+	}
+	models.RecordDeliveryAttempt(deliveries, delivery.ID, attempt, status, next)
+	return errors.New(attempt.Error)
+}
+
+func sendWebhook(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) models.DeliveryAttempt {
+	started := time.Now()
+	attempt := models.DeliveryAttempt{At: started}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bantr-Webhooks/1.0")
+	req.Header.Set(utils.WebhookEventHeader, delivery.EventType)
+	req.Header.Set(utils.WebhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(utils.WebhookSignatureHeader, utils.SignWebhookPayload(webhook.Secret, started, payload))
+
+	resp, err := webhookClient.Do(req)
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("endpoint responded with %d", resp.StatusCode)
+	}
+	return attempt
+}
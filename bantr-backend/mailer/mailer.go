@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Message is a single email. Text is required, HTML is optional and sent as
+// an alternative part when set.
+type Message struct {
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var defaultMailer Mailer = LogMailer{}
+
+// Setup picks the mailer from MAIL_DRIVER. "smtp" sends through the server in
+// the SMTP_* variables, anything else just logs messages, which is what you
+// want in development.
+func Setup() error {
+	driver := os.Getenv("MAIL_DRIVER")
+	switch driver {
+	case "smtp":
+		smtpMailer, err := NewSMTPMailerFromEnv()
+		if err != nil {
+			return err
+		}
+		defaultMailer = smtpMailer
+	case "", "log":
+		defaultMailer = LogMailer{}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+
+	log.Printf("Using %s mailer", driverName(driver))
+	return nil
+}
+
+// Send sends a message with the configured mailer
+func Send(ctx context.Context, message Message) error {
+	return defaultMailer.Send(ctx, message)
+}
+
+func driverName(driver string) string {
+	if driver == "" {
+		return "log"
+	}
+	return driver
+}
+
+// LogMailer writes messages to the log instead of sending them
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("Email to %v: %s\n%s", message.To, message.Subject, message.Text)
+	for _, attachment := range message.Attachments {
+		log.Printf("Attachment %s (%s, %d bytes)", attachment.Filename, attachment.ContentType, len(attachment.Data))
+	}
+	return nil
+}
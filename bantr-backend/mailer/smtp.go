@@ -0,0 +1,251 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends mail through an SMTP server. Leaving the username empty
+// skips authentication, which is how local catchers like MailHog are used.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPMailerFromEnv() (*SMTPMailer, error) {
+	m := &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+	if m.Host == "" {
+		return nil, errors.New("SMTP_HOST is not set")
+	}
+	if m.Port == "" {
+		m.Port = "587"
+	}
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return nil, fmt.Errorf("MAIL_FROM is not a valid address: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if len(message.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	body, err := buildMessage(m.From, message)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// net/smtp doesn't take a context, so run it on the side and give up
+	// waiting if the context ends first
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, from.Address, message.To, body)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func buildMessage(from string, message Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	headers := []string{
+		"From: " + from,
+		"To: " + strings.Join(message.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID(from),
+		"MIME-Version: 1.0",
+	}
+
+	body, err := buildBody(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(message.Attachments) == 0 {
+		headers = append(headers, body.headerLines()...)
+		buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+		buf.Write(body.data)
+		return buf.Bytes(), nil
+	}
+
+	// With attachments the body becomes the first part of a mixed message
+	writer := multipart.NewWriter(&buf)
+	headers = append(headers, "Content-Type: multipart/mixed; boundary="+writer.Boundary())
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	w, err := writer.CreatePart(body.header())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body.data); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range message.Attachments {
+		if err := writeAttachment(writer, attachment); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mimeEntity is an encoded body along with the headers that describe it
+type mimeEntity struct {
+	contentType string
+	encoding    string
+	data        []byte
+}
+
+func (e mimeEntity) header() textproto.MIMEHeader {
+	header := textproto.MIMEHeader{"Content-Type": {e.contentType}}
+	if e.encoding != "" {
+		header.Set("Content-Transfer-Encoding", e.encoding)
+	}
+	return header
+}
+
+func (e mimeEntity) headerLines() []string {
+	lines := []string{"Content-Type: " + e.contentType}
+	if e.encoding != "" {
+		lines = append(lines, "Content-Transfer-Encoding: "+e.encoding)
+	}
+	return lines
+}
+
+// buildBody encodes the text, or the text and HTML as alternatives
+func buildBody(message Message) (mimeEntity, error) {
+	var buf bytes.Buffer
+
+	if message.HTML == "" {
+		if err := writeQuotedPrintable(&buf, message.Text); err != nil {
+			return mimeEntity{}, err
+		}
+		return mimeEntity{"text/plain; charset=utf-8", "quoted-printable", buf.Bytes()}, nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	}
+	for _, part := range parts {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return mimeEntity{}, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return mimeEntity{}, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return mimeEntity{}, err
+	}
+	return mimeEntity{"multipart/alternative; boundary=" + writer.Boundary(), "", buf.Bytes()}, nil
+}
+
+func writeAttachment(writer *multipart.Writer, attachment Attachment) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("attachment %s: %w", attachment.Filename, err)
+	}
+	// Some clients still look for the name on the content type
+	params["name"] = attachment.Filename
+
+	w, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(mediaType, params)},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Base64 in lines of 76 characters, as MIME asks for
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 {
+			domain = address.Address[at+1:]
+		}
+	}
+
+	random := make([]byte, 12)
+	rand.Read(random)
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
@@ -6,7 +6,12 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/AnshX01/Bantr/bantr-backend/jobs"
+	"github.com/AnshX01/Bantr/bantr-backend/mailer"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/notifications"
 	"github.com/AnshX01/Bantr/bantr-backend/routes"
+	"github.com/AnshX01/Bantr/bantr-backend/storage"
 	"github.com/AnshX01/Bantr/bantr-backend/utils"
 	"github.com/AnshX01/Bantr/bantr-backend/websocket"
 	"github.com/gin-gonic/gin"
@@ -25,13 +30,87 @@ func main() {
 		port = "8080"
 	}
 
+	if err := utils.LoadKeyring(); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	go utils.RunKeyRotation()
+
+	if err := utils.LoadLoginProviders(); err != nil {
+		log.Fatal("Failed to load login providers: ", err)
+	}
+
+	if err := mailer.Setup(); err != nil {
+		log.Fatal("Failed to set up mailer: ", err)
+	}
+
+	if err := storage.Setup(); err != nil {
+		log.Fatal("Failed to set up blob storage: ", err)
+	}
+
 	utils.ConnectDB()
 
+	if err := models.EnsureUserIndexes(utils.GetUsersCollection()); err != nil {
+		log.Fatal("Failed to create user indexes:", err)
+	}
+	if err := models.EnsureSessionIndexes(utils.GetSessionsCollection()); err != nil {
+		log.Fatal("Failed to create session indexes:", err)
+	}
+	if err := models.EnsureRevokedTokenIndexes(utils.GetRevokedTokensCollection()); err != nil {
+		log.Fatal("Failed to create revoked token indexes:", err)
+	}
+	if err := models.EnsureOAuthStateIndexes(utils.GetOAuthStatesCollection()); err != nil {
+		log.Fatal("Failed to create oauth state indexes:", err)
+	}
+	if err := models.EnsureMagicLinkIndexes(utils.GetMagicLinksCollection()); err != nil {
+		log.Fatal("Failed to create magic link indexes:", err)
+	}
+	if err := models.EnsurePreferencesIndexes(utils.GetPreferencesCollection()); err != nil {
+		log.Fatal("Failed to create preferences indexes:", err)
+	}
+	if err := models.EnsureTwoFactorChallengeIndexes(utils.GetTwoFactorChallengesCollection()); err != nil {
+		log.Fatal("Failed to create 2FA challenge indexes:", err)
+	}
+	if err := models.EnsureWorkspaceIndexes(utils.GetWorkspacesCollection(), utils.GetWorkspaceMembersCollection()); err != nil {
+		log.Fatal("Failed to create workspace indexes:", err)
+	}
+	if err := models.EnsureAPIKeyIndexes(utils.GetAPIKeysCollection()); err != nil {
+		log.Fatal("Failed to create API key indexes:", err)
+	}
+	if err := models.EnsureWebhookIndexes(utils.GetWebhooksCollection(), utils.GetWebhookDeliveriesCollection(), utils.WebhookDeliveryLogTTL); err != nil {
+		log.Fatal("Failed to create webhook indexes:", err)
+	}
+	if err := models.EnsureChatLinkIndexes(utils.GetChatLinksCollection()); err != nil {
+		log.Fatal("Failed to create chat link indexes:", err)
+	}
+	if err := models.EnsureJobIndexes(utils.GetJobsCollection(), jobs.FinishedJobTTL); err != nil {
+		log.Fatal("Failed to create job indexes:", err)
+	}
+	if err := models.EnsureInvitationIndexes(utils.GetMeetingsCollection()); err != nil {
+		log.Fatal("Failed to create invitation indexes:", err)
+	}
+	if err := models.EnsureAnalyticsIndexes(utils.GetMeetingAnalyticsCollection()); err != nil {
+		log.Fatal("Failed to create analytics indexes:", err)
+	}
+	if err := models.EnsureNotificationIndexes(utils.GetNotificationsCollection(), notifications.TTL); err != nil {
+		log.Fatal("Failed to create notification indexes:", err)
+	}
+	if err := models.EnsureDataExportIndexes(utils.GetDataExportsCollection()); err != nil {
+		log.Fatal("Failed to create data export indexes:", err)
+	}
+	if err := models.FailInterruptedExports(utils.GetDataExportsCollection()); err != nil {
+		log.Printf("Warning: could not clean up interrupted exports: %v", err)
+	}
+
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
 	go hub.Run()
 	log.Println("WebSocket hub started")
 
+	jobs.StartWebhookDispatch()
+	utils.StartChatSummaries()
+	notifications.Setup(hub)
+	go jobs.Run()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -45,7 +124,7 @@ func main() {
 
 	corsConfig := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
 	})
@@ -58,10 +137,17 @@ func main() {
 		ctx.Next()
 	})
 
-	routes.AuthRoutes(router)
-	routes.UserRoutes(router)
-	routes.MeetingRoutes(router)
+	routes.AuthRoutes(router, hub)
+	routes.UserRoutes(router, hub)
+	routes.MeetingRoutes(router, hub)
+	routes.WorkspaceRoutes(router)
+	routes.RecordingRoutes(router)
 	routes.WebSocketRoutes(router, hub)
+	routes.SCIMRoutes(router, hub)
+	routes.WebhookRoutes(router)
+	routes.ChatRoutes(router)
+	routes.InvitationRoutes(router)
+	routes.NotificationRoutes(router)
 
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "Bantr backend running!"})
@@ -3,12 +3,14 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/AnshX01/Bantr/bantr-backend/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT tokens and protects routes
+// AuthMiddleware validates JWT tokens and protects routes. API keys are
+// accepted too, on the routes listed in apiKeyRouteScopes.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
@@ -34,6 +36,16 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if utils.IsAPIKey(tokenString) {
+			if status, message := authenticateAPIKey(c, tokenString); status != 0 {
+				c.JSON(status, gin.H{"error": message})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		// Verify token
 		claims, err := utils.VerifyToken(tokenString)
 		if err != nil {
@@ -49,18 +61,48 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Check if the token or its session was revoked
+		revoked, err := utils.IsTokenRevoked(claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			c.Abort()
+			return
+		}
+
+		// Deactivated users lose access right away, not when their token runs out
+		deactivated, err := utils.IsUserDeactivated(claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+			c.Abort()
+			return
+		}
+		if deactivated {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+			c.Abort()
+			return
+		}
+
 		// Store user information in context for use in handlers
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_name", claims.Name)
 		c.Set("user_picture", claims.Picture)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_id", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
 
 		// Continue to next handler
 		c.Next()
 	}
 }
 
-// OptionalAuthMiddleware validates JWT tokens but doesn't require them
+// OptionalAuthMiddleware validates JWT tokens but doesn't require them. Guest
+// tokens are accepted here as well, handlers check GetGuestFromContext.
 func OptionalAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
@@ -86,10 +128,27 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// A key that can't be used here is treated like a missing token
+		if utils.IsAPIKey(tokenString) {
+			if status, _ := authenticateAPIKey(c, tokenString); status == 0 {
+				c.Set("authenticated", true)
+			}
+			c.Next()
+			return
+		}
+
 		// Verify token
 		claims, err := utils.VerifyToken(tokenString)
 		if err != nil {
-			// Invalid token, continue without authentication
+			// Not an account token, it may still be a guest token
+			if guest, err := utils.VerifyTokenOfType(tokenString, utils.TokenTypeGuest); err == nil {
+				c.Set("user_id", guest.UserID)
+				c.Set("user_email", "")
+				c.Set("user_name", guest.Name)
+				c.Set("user_picture", "")
+				c.Set("authenticated", true)
+				c.Set("guest_room_id", guest.RoomID)
+			}
 			c.Next()
 			return
 		}
@@ -101,11 +160,24 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Revoked tokens are treated like missing ones
+		if revoked, err := utils.IsTokenRevoked(claims); err != nil || revoked {
+			c.Next()
+			return
+		}
+		if deactivated, err := utils.IsUserDeactivated(claims.UserID); err != nil || deactivated {
+			c.Next()
+			return
+		}
+
 		// Store user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_name", claims.Name)
 		c.Set("user_picture", claims.Picture)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_id", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
 		c.Set("authenticated", true)
 
 		// Continue to next handler
@@ -137,3 +209,20 @@ func GetUserFromContext(c *gin.Context) (userID, email, name, picture string, au
 	
 	return userIDStr, emailStr, nameStr, pictureStr, authBool
 }
+
+// GetSessionFromContext returns the session and token IDs of the access token
+// used for the request, along with when that token expires
+func GetSessionFromContext(c *gin.Context) (sessionID, tokenID string, expiresAt time.Time) {
+	sessionID = c.GetString("session_id")
+	tokenID = c.GetString("token_id")
+	expiresAt = c.GetTime("token_expires_at")
+	return sessionID, tokenID, expiresAt
+}
+
+// GetGuestFromContext reports whether the request was made with a guest token
+// and which room that token is for. Only OptionalAuthMiddleware accepts guest
+// tokens.
+func GetGuestFromContext(c *gin.Context) (roomID string, isGuest bool) {
+	roomID = c.GetString("guest_room_id")
+	return roomID, roomID != ""
+}
@@ -4,12 +4,10 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"os"
 
 	"github.com/AnshX01/Bantr/bantr-backend/models"
 	"github.com/AnshX01/Bantr/bantr-backend/utils"
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/idtoken"
 )
 
 
@@ -25,38 +23,57 @@ func GoogleAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		payload, err := idtoken.Validate(context.Background(), req.Token, os.Getenv("GOOGLE_CLIENT_ID"))
+		profile, err := utils.VerifyGoogleIDToken(context.Background(), req.Token)
 		if err != nil {
 			log.Println("Token validation error:", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google token"})
 			return
 		}
 
-		email := payload.Claims["email"].(string)
-		name := payload.Claims["name"].(string)
-		picture := payload.Claims["picture"].(string)
-
 		// Get users collection
 		usersCollection := utils.GetUsersCollection()
 
 		// Find or create user in database
-		user, err := models.FindOrCreateUser(usersCollection, name, email, picture)
+		user, err := models.FindOrCreateUserByIdentity(usersCollection, profile.Identity(), profile.Name, profile.Picture)
+		if err == models.ErrEmailInUse {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+			return
+		}
 		if err != nil {
 			log.Println("Database error:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
 
-		tokenString, err := utils.GenerateToken(*user)
+		utils.JoinWorkspaceByDomain(user, profile.HostedDomain)
+
+		login, err := utils.BeginLogin(*user, c.Request.UserAgent(), c.ClientIP())
+		if err == models.ErrUserDeactivated {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+			return
+		}
 		if err != nil {
-			log.Println("JWT generation error:", err)
+			log.Println("Session creation error:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 			return
 		}
 
+		// Users with 2FA still have to send a code to /api/auth/2fa
+		if login.ChallengeToken != "" {
+			c.JSON(http.StatusOK, gin.H{
+				"two_factor_required": true,
+				"challenge_token":     login.ChallengeToken,
+				"expires_in":          int(utils.TwoFactorChallengeTTL.Seconds()),
+			})
+			return
+		}
+
+		tokens := login.Tokens
 		c.JSON(http.StatusOK, gin.H{
-			"token": tokenString,
-			"user":  user,
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_in":    tokens.ExpiresIn,
+			"user":          user,
 		})
 	}
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// RequireMeetingPermission loads the meeting in the :roomId param and only
+// lets the request through if the user's role in it has the permission. It
+// has to run after AuthMiddleware or OptionalAuthMiddleware. Handlers get
+// the meeting from GetMeetingFromContext.
+func RequireMeetingPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, _, _, authenticated := GetUserFromContext(c)
+		if !authenticated {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+			c.Abort()
+			return
+		}
+
+		roomID := c.Param("roomId")
+		meeting, err := models.FindMeetingByRoomID(utils.GetMeetingsCollection(), roomID)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meeting not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find meeting"})
+			c.Abort()
+			return
+		}
+
+		// Guest tokens only count for the room they were issued for
+		guestRoomID, isGuest := GetGuestFromContext(c)
+		if isGuest && guestRoomID != roomID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do that"})
+			c.Abort()
+			return
+		}
+
+		role := utils.MeetingRole(userID, isGuest, meeting)
+		if !models.RoleHasPermission(role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do that"})
+			c.Abort()
+			return
+		}
+
+		c.Set("meeting", meeting)
+		c.Set("meeting_role", role)
+		c.Next()
+	}
+}
+
+// GetMeetingFromContext returns the meeting loaded by RequireMeetingPermission
+// and the user's role in it
+func GetMeetingFromContext(c *gin.Context) (*models.Meeting, string) {
+	meeting, _ := c.Get("meeting")
+	m, _ := meeting.(*models.Meeting)
+	return m, c.GetString("meeting_role")
+}
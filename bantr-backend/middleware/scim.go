@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMAuthMiddleware lets an identity provider in with the bearer token a
+// workspace owner issued it, and remembers which workspace that was. Errors
+// are SCIM error documents since that's what provisioning clients expect.
+func SCIMAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+
+		var workspace *models.Workspace
+		err := utils.ErrInvalidSCIMToken
+		if token != authHeader {
+			workspace, err = utils.AuthenticateSCIMToken(token)
+		}
+		if err != nil {
+			status := http.StatusUnauthorized
+			detail := "Invalid SCIM token"
+			if err != utils.ErrInvalidSCIMToken {
+				status = http.StatusInternalServerError
+				detail = "Failed to check SCIM token"
+			}
+			c.JSON(status, gin.H{
+				"schemas": []string{utils.SCIMSchemaError},
+				"status":  strconv.Itoa(status),
+				"detail":  detail,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("scim_workspace", workspace)
+		c.Next()
+	}
+}
+
+// GetSCIMWorkspaceFromContext returns the workspace the SCIM token belongs to
+func GetSCIMWorkspaceFromContext(c *gin.Context) *models.Workspace {
+	workspace, _ := c.Get("scim_workspace")
+	w, _ := workspace.(*models.Workspace)
+	return w
+}
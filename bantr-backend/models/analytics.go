@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MeetingAnalytics collects per-participant statistics for a meeting
+type MeetingAnalytics struct {
+	ID           bson.ObjectID          `bson:"_id,omitempty" json:"id"`
+	RoomID       string                 `bson:"room_id" json:"room_id"`
+	Participants []ParticipantAnalytics `bson:"participants" json:"participants"`
+	UpdatedAt    time.Time              `bson:"updated_at" json:"updated_at"`
+}
+
+type ParticipantAnalytics struct {
+	UserID          string  `bson:"user_id" json:"user_id"`
+	Name            string  `bson:"name" json:"name"`
+	SpeakingSeconds float64 `bson:"speaking_seconds" json:"speaking_seconds"`
+}
+
+// EnsureAnalyticsIndexes keeps one analytics record per meeting, which also
+// lets concurrent upserts for a new meeting settle on the same record
+func EnsureAnalyticsIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "room_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "participants.user_id", Value: 1}}},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating analytics indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// AddSpeakingTime adds to a participant's speaking time total, creating the
+// meeting's analytics record or the participant's entry as needed. It's a
+// single upsert so concurrent flushes can't lose time or add the same
+// participant twice; the pipeline form is needed since $inc can't create
+// an array entry that isn't there yet.
+func AddSpeakingTime(collection *mongo.Collection, roomID, userID, name string, seconds float64) error {
+	participants := bson.M{"$ifNull": bson.A{"$participants", bson.A{}}}
+	isParticipant := bson.M{"$eq": bson.A{"$$p.user_id", bson.M{"$literal": userID}}}
+	added := bson.M{"$mergeObjects": bson.A{"$$p", bson.M{
+		"speaking_seconds": bson.M{"$add": bson.A{"$$p.speaking_seconds", seconds}},
+	}}}
+	newParticipant := bson.M{"$literal": ParticipantAnalytics{
+		UserID:          userID,
+		Name:            name,
+		SpeakingSeconds: seconds,
+	}}
+
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"participants": bson.M{"$cond": bson.A{
+			bson.M{"$in": bson.A{bson.M{"$literal": userID}, bson.M{"$map": bson.M{"input": participants, "as": "p", "in": "$$p.user_id"}}}},
+			bson.M{"$map": bson.M{"input": participants, "as": "p", "in": bson.M{"$cond": bson.A{isParticipant, added, "$$p"}}}},
+			bson.M{"$concatArrays": bson.A{participants, bson.A{newParticipant}}},
+		}},
+		"updated_at": time.Now(),
+	}}}}
+
+	log.Printf("Adding %.1fs of speaking time for %s in room %s", seconds, userID, roomID)
+	_, err := collection.UpdateOne(context.Background(), bson.M{"room_id": roomID}, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error updating speaking time: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func GetMeetingAnalytics(collection *mongo.Collection, roomID string) (*MeetingAnalytics, error) {
+	var analytics MeetingAnalytics
+	err := collection.FindOne(context.Background(), bson.M{"room_id": roomID}).Decode(&analytics)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding meeting analytics: %v", err)
+		}
+		return nil, err
+	}
+
+	return &analytics, nil
+}
+
+// GetUserAnalytics returns the analytics of every meeting a user spoke in,
+// with the other participants left out
+func GetUserAnalytics(collection *mongo.Collection, userID string) ([]MeetingAnalytics, error) {
+	filter := bson.M{"participants.user_id": userID}
+	opts := options.Find().SetProjection(bson.M{
+		"room_id":      1,
+		"updated_at":   1,
+		"participants": bson.M{"$elemMatch": bson.M{"user_id": userID}},
+	})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding user analytics: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	analytics := []MeetingAnalytics{}
+	if err = cursor.All(context.Background(), &analytics); err != nil {
+		log.Printf("Error decoding user analytics: %v", err)
+		return nil, err
+	}
+
+	return analytics, nil
+}
+
+func AnonymizeAnalytics(collection *mongo.Collection, userID string) error {
+	filter := bson.M{"participants.user_id": userID}
+	update := bson.M{"$set": bson.M{
+		"participants.$[p].user_id": DeletedUserID,
+		"participants.$[p].name":    DeletedUserName,
+	}}
+	opts := options.UpdateMany().SetArrayFilters([]interface{}{bson.M{"p.user_id": userID}})
+
+	_, err := collection.UpdateMany(context.Background(), filter, update, opts)
+	if err != nil {
+		log.Printf("Error anonymizing analytics: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// API key scopes. A key can only reach routes that need one of its scopes.
+const (
+	ScopeMeetingsRead   = "meetings:read"
+	ScopeMeetingsWrite  = "meetings:write"
+	ScopeRecordingsRead = "recordings:read"
+	ScopeRoomsJoin      = "rooms:join"
+	ScopeProfileRead    = "profile:read"
+)
+
+var apiKeyScopes = []string{
+	ScopeMeetingsRead,
+	ScopeMeetingsWrite,
+	ScopeRecordingsRead,
+	ScopeRoomsJoin,
+	ScopeProfileRead,
+}
+
+func IsValidAPIKeyScope(scope string) bool {
+	for _, s := range apiKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyScopes lists every scope a key can be given
+func APIKeyScopes() []string {
+	return append([]string{}, apiKeyScopes...)
+}
+
+// APIKey lets an integration act as a user, or as a bot they own, without
+// logging in. Only a hash of the key is kept.
+type APIKey struct {
+	ID     bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name   string        `bson:"name" json:"name"`
+	Prefix string        `bson:"prefix" json:"prefix"`
+	// UserID is who the key acts as, CreatedBy who manages it. They only
+	// differ for bot keys.
+	UserID     string     `bson:"user_id" json:"user_id"`
+	CreatedBy  string     `bson:"created_by" json:"created_by"`
+	KeyHash    string     `bson:"key_hash" json:"-"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+func EnsureAPIKeyIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "created_by", Value: 1}}},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating API key indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateAPIKey(collection *mongo.Collection, key *APIKey) error {
+	key.CreatedAt = time.Now()
+
+	log.Printf("Creating API key %s for user %s", key.Prefix, key.UserID)
+	result, err := collection.InsertOne(context.Background(), key)
+	if err != nil {
+		log.Printf("Error creating API key: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		key.ID = oid
+	}
+
+	return nil
+}
+
+func FindAPIKeyByHash(collection *mongo.Collection, keyHash string) (*APIKey, error) {
+	var key APIKey
+	err := collection.FindOne(context.Background(), bson.M{"key_hash": keyHash}).Decode(&key)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding API key: %v", err)
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetUserAPIKeys lists the keys a user manages, their bots' included,
+// newest first
+func GetUserAPIKeys(collection *mongo.Collection, userID string) ([]APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := collection.Find(context.Background(), bson.M{"created_by": userID}, opts)
+	if err != nil {
+		log.Printf("Error finding API keys: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	keys := []APIKey{}
+	if err = cursor.All(context.Background(), &keys); err != nil {
+		log.Printf("Error decoding API keys: %v", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey records that a key was used. It only writes about once a
+// minute so busy integrations don't cost a write per request.
+func TouchAPIKey(collection *mongo.Collection, id bson.ObjectID) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"last_used_at": bson.M{"$exists": false}},
+			bson.M{"last_used_at": bson.M{"$lt": now.Add(-time.Minute)}},
+		},
+	}
+
+	_, err := collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"last_used_at": now}})
+	if err != nil {
+		log.Printf("Error updating API key usage: %v", err)
+	}
+}
+
+// DeleteAPIKey removes a key the user manages
+func DeleteAPIKey(collection *mongo.Collection, id bson.ObjectID, createdBy string) error {
+	result, err := collection.DeleteOne(context.Background(), bson.M{"_id": id, "created_by": createdBy})
+	if err != nil {
+		log.Printf("Error deleting API key: %v", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	log.Printf("Deleted API key %s", id.Hex())
+	return nil
+}
+
+// DeleteUserAPIKeys removes every key that acts as or is managed by a user
+func DeleteUserAPIKeys(collection *mongo.Collection, userID string) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"user_id": userID},
+		bson.M{"created_by": userID},
+	}}
+
+	_, err := collection.DeleteMany(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error deleting API keys: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Attendance is one stay in a meeting room, from joining to leaving. A user
+// who drops out and rejoins gets a new entry.
+type Attendance struct {
+	ID       bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID   string        `bson:"room_id" json:"room_id"`
+	UserID   string        `bson:"user_id" json:"user_id"`
+	Name     string        `bson:"name" json:"name"`
+	IsGuest  bool          `bson:"is_guest" json:"is_guest"`
+	JoinedAt time.Time     `bson:"joined_at" json:"joined_at"`
+	LeftAt   *time.Time    `bson:"left_at,omitempty" json:"left_at,omitempty"`
+}
+
+func RecordJoin(collection *mongo.Collection, attendance *Attendance) error {
+	attendance.JoinedAt = time.Now()
+
+	result, err := collection.InsertOne(context.Background(), attendance)
+	if err != nil {
+		log.Printf("Error recording attendance: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		attendance.ID = oid
+	}
+
+	return nil
+}
+
+func RecordLeave(collection *mongo.Collection, id bson.ObjectID) error {
+	filter := bson.M{"_id": id, "left_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"left_at": time.Now()}}
+
+	_, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error recording leave: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func GetRoomAttendance(collection *mongo.Collection, roomID string) ([]Attendance, error) {
+	filter := bson.M{"room_id": roomID}
+	opts := options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding attendance: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	attendance := []Attendance{}
+	if err = cursor.All(context.Background(), &attendance); err != nil {
+		log.Printf("Error decoding attendance: %v", err)
+		return nil, err
+	}
+
+	return attendance, nil
+}
+
+func GetUserAttendance(collection *mongo.Collection, userID string) ([]Attendance, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding attendance: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	attendance := []Attendance{}
+	if err = cursor.All(context.Background(), &attendance); err != nil {
+		log.Printf("Error decoding attendance: %v", err)
+		return nil, err
+	}
+
+	return attendance, nil
+}
+
+// AnonymizeAttendance keeps a deleted user's attendance entries so hosts'
+// headcounts stay right, but drops who they were
+func AnonymizeAttendance(collection *mongo.Collection, userID string) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{"$set": bson.M{"user_id": DeletedUserID, "name": DeletedUserName}}
+
+	_, err := collection.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error anonymizing attendance: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Chat platforms slash commands can come from
+const (
+	ChatPlatformSlack      = "slack"
+	ChatPlatformMattermost = "mattermost"
+)
+
+// ErrChatUserLinked means the chat account is already linked to a user
+var ErrChatUserLinked = errors.New("chat account is linked to another user")
+
+// ChatLink ties an account on a chat platform to the Bantr user its slash
+// commands act as. Chat user IDs are only unique within a team.
+type ChatLink struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Platform     string        `bson:"platform" json:"platform"`
+	TeamID       string        `bson:"team_id" json:"team_id"`
+	TeamDomain   string        `bson:"team_domain,omitempty" json:"team_domain,omitempty"`
+	ChatUserID   string        `bson:"chat_user_id" json:"chat_user_id"`
+	ChatUserName string        `bson:"chat_user_name,omitempty" json:"chat_user_name,omitempty"`
+	UserID       string        `bson:"user_id" json:"user_id"`
+	CreatedAt    time.Time     `bson:"created_at" json:"created_at"`
+}
+
+func EnsureChatLinkIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "platform", Value: 1}, {Key: "team_id", Value: 1}, {Key: "chat_user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating chat link indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateChatLink links a chat account to a user. Linking it to the same user
+// again is a no-op, and to anyone else returns ErrChatUserLinked.
+func CreateChatLink(collection *mongo.Collection, link *ChatLink) error {
+	existing, err := FindChatLink(collection, link.Platform, link.TeamID, link.ChatUserID)
+	if err == nil {
+		if existing.UserID != link.UserID {
+			return ErrChatUserLinked
+		}
+		*link = *existing
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	link.CreatedAt = time.Now()
+	result, err := collection.InsertOne(context.Background(), link)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrChatUserLinked
+		}
+		log.Printf("Error creating chat link: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		link.ID = oid
+	}
+
+	log.Printf("Linked %s user %s/%s to user %s", link.Platform, link.TeamID, link.ChatUserID, link.UserID)
+	return nil
+}
+
+func FindChatLink(collection *mongo.Collection, platform, teamID, chatUserID string) (*ChatLink, error) {
+	filter := bson.M{"platform": platform, "team_id": teamID, "chat_user_id": chatUserID}
+
+	var link ChatLink
+	err := collection.FindOne(context.Background(), filter).Decode(&link)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding chat link: %v", err)
+		}
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func GetUserChatLinks(collection *mongo.Collection, userID string) ([]ChatLink, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		log.Printf("Error finding chat links: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	links := []ChatLink{}
+	if err = cursor.All(context.Background(), &links); err != nil {
+		log.Printf("Error decoding chat links: %v", err)
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// DeleteChatLink removes one of a user's links
+func DeleteChatLink(collection *mongo.Collection, id bson.ObjectID, userID string) error {
+	result, err := collection.DeleteOne(context.Background(), bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting chat link: %v", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func DeleteUserChatLinks(collection *mongo.Collection, userID string) error {
+	_, err := collection.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting chat links: %v", err)
+		return err
+	}
+
+	return nil
+}
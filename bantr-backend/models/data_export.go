@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Data export statuses
+const (
+	ExportStatusPending = "pending"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+)
+
+// DataExport is a ZIP of everything we hold about a user, built in the
+// background. The record and the file are dropped once it expires.
+type DataExport struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      string        `bson:"user_id" json:"user_id"`
+	Status      string        `bson:"status" json:"status"`
+	BlobKey     string        `bson:"blob_key,omitempty" json:"-"`
+	SizeBytes   int64         `bson:"size_bytes,omitempty" json:"size_bytes,omitempty"`
+	Error       string        `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time     `bson:"created_at" json:"created_at"`
+	CompletedAt *time.Time    `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	ExpiresAt   time.Time     `bson:"expires_at" json:"expires_at"`
+}
+
+func EnsureDataExportIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating data export indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateDataExport(collection *mongo.Collection, export *DataExport) error {
+	export.Status = ExportStatusPending
+	export.CreatedAt = time.Now()
+
+	result, err := collection.InsertOne(context.Background(), export)
+	if err != nil {
+		log.Printf("Error creating data export: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		export.ID = oid
+	}
+
+	return nil
+}
+
+// FindLatestDataExport returns the user's most recent export that hasn't
+// expired
+func FindLatestDataExport(collection *mongo.Collection, userID string) (*DataExport, error) {
+	filter := bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	var export DataExport
+	err := collection.FindOne(context.Background(), filter, opts).Decode(&export)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding data export: %v", err)
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func FinishDataExport(collection *mongo.Collection, id bson.ObjectID, blobKey string, sizeBytes int64) error {
+	update := bson.M{"$set": bson.M{
+		"status":       ExportStatusReady,
+		"blob_key":     blobKey,
+		"size_bytes":   sizeBytes,
+		"completed_at": time.Now(),
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Printf("Error finishing data export: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func FailDataExport(collection *mongo.Collection, id bson.ObjectID, reason string) error {
+	update := bson.M{"$set": bson.M{
+		"status":       ExportStatusFailed,
+		"error":        reason,
+		"completed_at": time.Now(),
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Printf("Error failing data export: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// FailInterruptedExports marks exports that were still being built when the
+// server stopped as failed, so users can ask for a new one
+func FailInterruptedExports(collection *mongo.Collection) error {
+	filter := bson.M{"status": ExportStatusPending}
+	update := bson.M{"$set": bson.M{
+		"status":       ExportStatusFailed,
+		"error":        "Export was interrupted",
+		"completed_at": time.Now(),
+	}}
+
+	_, err := collection.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error failing interrupted exports: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func DeleteUserDataExports(collection *mongo.Collection, userID string) error {
+	_, err := collection.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting data exports: %v", err)
+		return err
+	}
+
+	return nil
+}
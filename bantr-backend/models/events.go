@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Meeting lifecycle events
+const (
+	EventMeetingCreated    = "meeting.created"
+	EventMeetingStarted    = "meeting.started"
+	EventParticipantJoined = "participant.joined"
+	EventParticipantLeft   = "participant.left"
+	EventMeetingEnded      = "meeting.ended"
+)
+
+var eventTypes = []string{
+	EventMeetingCreated,
+	EventMeetingStarted,
+	EventParticipantJoined,
+	EventParticipantLeft,
+	EventMeetingEnded,
+}
+
+func IsValidEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EventTypes lists every event that can be subscribed to
+func EventTypes() []string {
+	return append([]string{}, eventTypes...)
+}
+
+// EventParticipant is who joined or left, for participant events
+type EventParticipant struct {
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	IsGuest bool   `json:"is_guest"`
+	IsBot   bool   `json:"is_bot"`
+}
+
+func NewEventParticipant(client *Client) *EventParticipant {
+	return &EventParticipant{
+		UserID:  client.UserID,
+		Name:    client.Name,
+		IsGuest: client.IsGuest,
+		IsBot:   client.IsBot,
+	}
+}
+
+// Event is something that happened to a meeting. Subscribers that need the
+// meeting itself load it when Meeting is nil.
+type Event struct {
+	ID          string            `json:"id"`
+	Type        string            `json:"type"`
+	OccurredAt  time.Time         `json:"occurred_at"`
+	RoomID      string            `json:"room_id"`
+	Meeting     *Meeting          `json:"meeting,omitempty"`
+	Participant *EventParticipant `json:"participant,omitempty"`
+}
+
+var (
+	eventSubscribers []func(Event)
+	eventMutex       sync.RWMutex
+)
+
+// SubscribeEvents registers a function to be called with every event. Call
+// it at startup, before events start flowing.
+func SubscribeEvents(subscriber func(Event)) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+
+	eventSubscribers = append(eventSubscribers, subscriber)
+}
+
+// PublishEvent hands an event to every subscriber. Each one runs in its own
+// goroutine so publishers, like the hub while it holds its lock, never wait
+// on them.
+func PublishEvent(event Event) {
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	eventMutex.RLock()
+	defer eventMutex.RUnlock()
+
+	for _, subscriber := range eventSubscribers {
+		go subscriber(event)
+	}
+}
+
+func newEventID() string {
+	bytes := make([]byte, 12)
+	rand.Read(bytes)
+	return "evt_" + hex.EncodeToString(bytes)
+}
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Invitation email statuses
+const (
+	InvitationStatusQueued = "queued"
+	InvitationStatusSent   = "sent"
+	InvitationStatusFailed = "failed"
+)
+
+// RSVP answers. Everyone starts at needs_action, the same as in calendars.
+const (
+	RSVPNeedsAction = "needs_action"
+	RSVPAccepted    = "accepted"
+	RSVPDeclined    = "declined"
+	RSVPTentative   = "tentative"
+)
+
+func IsValidRSVP(rsvp string) bool {
+	return rsvp == RSVPAccepted || rsvp == RSVPDeclined || rsvp == RSVPTentative
+}
+
+// MeetingSchedule is when a scheduled meeting is meant to happen. Meetings
+// without one are started on the spot.
+type MeetingSchedule struct {
+	StartsAt        time.Time `bson:"starts_at" json:"starts_at"`
+	DurationMinutes int       `bson:"duration_minutes" json:"duration_minutes"`
+	// ReminderMinutes is how long before the start reminders go out. Zero
+	// turns them off.
+	ReminderMinutes int `bson:"reminder_minutes" json:"reminder_minutes"`
+	// Sequence goes up every time the meeting is rescheduled so calendars
+	// replace the event instead of adding another
+	Sequence int `bson:"sequence" json:"sequence"`
+}
+
+func (s *MeetingSchedule) EndsAt() time.Time {
+	return s.StartsAt.Add(time.Duration(s.DurationMinutes) * time.Minute)
+}
+
+// Invitation is someone invited to a meeting by email. The RSVP link in the
+// email carries a token, of which only the hash is kept.
+type Invitation struct {
+	Email       string     `bson:"email" json:"email"`
+	TokenHash   string     `bson:"token_hash" json:"-"`
+	Status      string     `bson:"status" json:"status"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	RSVP        string     `bson:"rsvp" json:"rsvp"`
+	InvitedBy   string     `bson:"invited_by" json:"invited_by"`
+	InvitedAt   time.Time  `bson:"invited_at" json:"invited_at"`
+	SentAt      *time.Time `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	RespondedAt *time.Time `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+}
+
+// FindInvitation returns the meeting's invitation for an email, or nil
+func (m *Meeting) FindInvitation(email string) *Invitation {
+	for i := range m.Invitations {
+		if m.Invitations[i].Email == email {
+			return &m.Invitations[i]
+		}
+	}
+	return nil
+}
+
+// EnsureInvitationIndexes lets RSVP links find their meeting
+func EnsureInvitationIndexes(meetings *mongo.Collection) error {
+	_, err := meetings.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "invitations.token_hash", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		log.Printf("Error creating invitation indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// AddInvitations invites more people to a meeting. Callers skip emails that
+// are already invited.
+func AddInvitations(collection *mongo.Collection, roomID string, invitations []Invitation) error {
+	update := bson.M{
+		"$push": bson.M{"invitations": bson.M{"$each": invitations}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"room_id": roomID}, update)
+	if err != nil {
+		log.Printf("Error adding invitations: %v", err)
+		return err
+	}
+
+	log.Printf("Invited %d people to room %s", len(invitations), roomID)
+	return nil
+}
+
+func RemoveInvitation(collection *mongo.Collection, roomID, email string) error {
+	filter := bson.M{"room_id": roomID, "invitations.email": email}
+	update := bson.M{
+		"$pull": bson.M{"invitations": bson.M{"email": email}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error removing invitation: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// updateInvitation sets fields on one invitation of a meeting
+func updateInvitation(collection *mongo.Collection, roomID, email string, fields bson.M) error {
+	filter := bson.M{"room_id": roomID, "invitations.email": email}
+	set := bson.M{"updated_at": time.Now()}
+	for field, value := range fields {
+		set["invitations.$."+field] = value
+	}
+
+	result, err := collection.UpdateOne(context.Background(), filter, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("Error updating invitation: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// SetInvitationToken replaces the token an invitation's RSVP link carries
+// and queues the email again
+func SetInvitationToken(collection *mongo.Collection, roomID, email, tokenHash string) error {
+	return updateInvitation(collection, roomID, email, bson.M{
+		"token_hash": tokenHash,
+		"status":     InvitationStatusQueued,
+	})
+}
+
+// SetInvitationStatus records whether the invitation email went out
+func SetInvitationStatus(collection *mongo.Collection, roomID, email, status, sendError string) error {
+	fields := bson.M{"status": status, "error": sendError}
+	if status == InvitationStatusSent {
+		fields["sent_at"] = time.Now()
+	}
+	return updateInvitation(collection, roomID, email, fields)
+}
+
+func SetInvitationRSVP(collection *mongo.Collection, roomID, email, rsvp string) error {
+	return updateInvitation(collection, roomID, email, bson.M{
+		"rsvp":         rsvp,
+		"responded_at": time.Now(),
+	})
+}
+
+// FindMeetingByInvitationToken finds the meeting and invitation an RSVP
+// link belongs to
+func FindMeetingByInvitationToken(collection *mongo.Collection, tokenHash string) (*Meeting, *Invitation, error) {
+	var meeting Meeting
+	err := collection.FindOne(context.Background(), bson.M{"invitations.token_hash": tokenHash}).Decode(&meeting)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding invitation: %v", err)
+		}
+		return nil, nil, err
+	}
+
+	for i := range meeting.Invitations {
+		if meeting.Invitations[i].TokenHash == tokenHash {
+			return &meeting, &meeting.Invitations[i], nil
+		}
+	}
+	return nil, nil, mongo.ErrNoDocuments
+}
+
+// UpdateMeetingSchedule moves a scheduled meeting, or schedules one that
+// wasn't
+func UpdateMeetingSchedule(collection *mongo.Collection, roomID string, schedule *MeetingSchedule) error {
+	update := bson.M{"$set": bson.M{
+		"schedule":   schedule,
+		"updated_at": time.Now(),
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"room_id": roomID}, update)
+	if err != nil {
+		log.Printf("Error updating meeting schedule: %v", err)
+		return err
+	}
+
+	log.Printf("Meeting %s scheduled for %s", roomID, schedule.StartsAt.Format(time.RFC3339))
+	return nil
+}
+
+// UserInvitation is an invitation someone received, for data exports
+type UserInvitation struct {
+	RoomID     string     `json:"room_id"`
+	Title      string     `json:"title"`
+	Invitation Invitation `json:"invitation"`
+}
+
+// GetUserInvitations lists the invitations sent to any of a user's emails
+func GetUserInvitations(collection *mongo.Collection, emails []string) ([]UserInvitation, error) {
+	ctx := context.Background()
+
+	cursor, err := collection.Find(ctx, bson.M{"invitations.email": bson.M{"$in": emails}})
+	if err != nil {
+		log.Printf("Error finding user invitations: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	meetings := []Meeting{}
+	if err = cursor.All(ctx, &meetings); err != nil {
+		log.Printf("Error decoding meetings: %v", err)
+		return nil, err
+	}
+
+	invitations := []UserInvitation{}
+	for _, meeting := range meetings {
+		for _, email := range emails {
+			if invitation := meeting.FindInvitation(email); invitation != nil {
+				invitations = append(invitations, UserInvitation{
+					RoomID:     meeting.RoomID,
+					Title:      meeting.Title,
+					Invitation: *invitation,
+				})
+			}
+		}
+	}
+	return invitations, nil
+}
+
+// RemoveUserInvitations drops the invitations sent to a deleted user's
+// emails, and stops the ones they sent pointing back at them
+func RemoveUserInvitations(collection *mongo.Collection, userID string, emails []string) error {
+	ctx := context.Background()
+
+	received := bson.M{"invitations.email": bson.M{"$in": emails}}
+	update := bson.M{
+		"$pull": bson.M{"invitations": bson.M{"email": bson.M{"$in": emails}}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	if _, err := collection.UpdateMany(ctx, received, update); err != nil {
+		log.Printf("Error removing user invitations: %v", err)
+		return err
+	}
+
+	sent := bson.M{"invitations.invited_by": userID}
+	update = bson.M{"$set": bson.M{"invitations.$[i].invited_by": DeletedUserID}}
+	opts := options.UpdateMany().SetArrayFilters([]interface{}{bson.M{"i.invited_by": userID}})
+	if _, err := collection.UpdateMany(ctx, sent, update, opts); err != nil {
+		log.Printf("Error anonymizing sent invitations: %v", err)
+		return err
+	}
+
+	return nil
+}
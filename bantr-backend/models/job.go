@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Background job statuses
+const (
+	JobStatusPending   = "pending"
+	JobStatusDone      = "done"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Job is a piece of background work waiting in the queue. Key groups jobs
+// that get cancelled together, like all the reminders for one meeting.
+type Job struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type        string        `bson:"type" json:"type"`
+	Key         string        `bson:"key,omitempty" json:"key,omitempty"`
+	Payload     bson.Raw      `bson:"payload" json:"-"`
+	Status      string        `bson:"status" json:"status"`
+	Attempts    int           `bson:"attempts" json:"attempts"`
+	MaxAttempts int           `bson:"max_attempts" json:"max_attempts"`
+	RunAt       time.Time     `bson:"run_at" json:"run_at"`
+	LastError   string        `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt   time.Time     `bson:"created_at" json:"created_at"`
+	FinishedAt  *time.Time    `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// EnsureJobIndexes indexes the queue and drops finished jobs after
+// finishedTTL. Pending jobs have no finished_at so they never expire.
+func EnsureJobIndexes(collection *mongo.Collection, finishedTTL time.Duration) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "status", Value: 1}}},
+		// For counting the invitations someone has sent lately
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "payload.sent_by", Value: 1}, {Key: "created_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(finishedTTL.Seconds())),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating job indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateJob(collection *mongo.Collection, job *Job) error {
+	job.CreatedAt = time.Now()
+	job.Status = JobStatusPending
+	if job.RunAt.IsZero() {
+		job.RunAt = job.CreatedAt
+	}
+
+	result, err := collection.InsertOne(context.Background(), job)
+	if err != nil {
+		log.Printf("Error creating %s job: %v", job.Type, err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		job.ID = oid
+	}
+
+	return nil
+}
+
+// ClaimDueJob picks a pending job that's due and pushes its run time back
+// by lease so no other worker picks it up meanwhile. The attempt is counted
+// here so a job that crashes its worker still runs out of attempts.
+func ClaimDueJob(collection *mongo.Collection, lease time.Duration) (*Job, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status": JobStatusPending,
+		"run_at": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"run_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job Job
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&job)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error claiming job: %v", err)
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// FinishJob records how a job ended: done, failed, or still pending with
+// retryAt as its next run
+func FinishJob(collection *mongo.Collection, id bson.ObjectID, status, lastError string, retryAt time.Time) error {
+	set := bson.M{"status": status, "last_error": lastError}
+	if status == JobStatusPending {
+		set["run_at"] = retryAt
+	} else {
+		set["finished_at"] = time.Now()
+	}
+
+	// A job cancelled while it was running stays cancelled
+	filter := bson.M{"_id": id, "status": JobStatusPending}
+	_, err := collection.UpdateOne(context.Background(), filter, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("Error finishing job %s: %v", id.Hex(), err)
+		return err
+	}
+
+	return nil
+}
+
+// CountRecentJobs counts the jobs of a type queued since a point in time
+// whose payload has the given fields, for rate limiting
+func CountRecentJobs(collection *mongo.Collection, jobType string, payload bson.M, since time.Time) (int64, error) {
+	filter := bson.M{"type": jobType, "created_at": bson.M{"$gte": since}}
+	for field, value := range payload {
+		filter["payload."+field] = value
+	}
+
+	count, err := collection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error counting %s jobs: %v", jobType, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CancelJobs stops the pending jobs with a key from running
+func CancelJobs(collection *mongo.Collection, key string) error {
+	filter := bson.M{"key": key, "status": JobStatusPending}
+	update := bson.M{"$set": bson.M{"status": JobStatusCancelled, "finished_at": time.Now()}}
+
+	result, err := collection.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error cancelling jobs for %s: %v", key, err)
+		return err
+	}
+
+	if result.ModifiedCount > 0 {
+		log.Printf("Cancelled %d jobs for %s", result.ModifiedCount, key)
+	}
+	return nil
+}
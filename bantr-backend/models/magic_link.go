@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MagicLink records an emailed login link so it can only be used once. The
+// link itself is a signed token carrying TokenID.
+type MagicLink struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenID      string        `bson:"jti" json:"-"`
+	Email        string        `bson:"email" json:"email"`
+	Name         string        `bson:"name" json:"name"`
+	RedirectPath string        `bson:"redirect_path" json:"redirect_path"`
+	CreatedAt    time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt    time.Time     `bson:"expires_at" json:"expires_at"`
+	UsedAt       *time.Time    `bson:"used_at,omitempty" json:"used_at,omitempty"`
+}
+
+// EnsureMagicLinkIndexes indexes links by token and email and drops them a
+// day after they expire
+func EnsureMagicLinkIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour).Seconds()))},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating magic link indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateMagicLink(collection *mongo.Collection, link *MagicLink) error {
+	link.CreatedAt = time.Now()
+
+	log.Printf("Creating magic link for %s", link.Email)
+	result, err := collection.InsertOne(context.Background(), link)
+	if err != nil {
+		log.Printf("Error creating magic link: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		link.ID = oid
+	}
+
+	return nil
+}
+
+// ConsumeMagicLink marks a link as used and returns it. It fails with
+// mongo.ErrNoDocuments if the link doesn't exist, expired or was already
+// used.
+func ConsumeMagicLink(collection *mongo.Collection, tokenID string) (*MagicLink, error) {
+	now := time.Now()
+	filter := bson.M{
+		"jti":        tokenID,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var link MagicLink
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&link)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error consuming magic link: %v", err)
+		}
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// CountRecentMagicLinks counts the links sent to an address since a point in
+// time, for rate limiting
+func CountRecentMagicLinks(collection *mongo.Collection, email string, since time.Time) (int64, error) {
+	filter := bson.M{"email": email, "created_at": bson.M{"$gte": since}}
+
+	count, err := collection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error counting magic links: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DeleteMagicLinks forgets every link sent to an address
+func DeleteMagicLinks(collection *mongo.Collection, email string) error {
+	_, err := collection.DeleteMany(context.Background(), bson.M{"email": email})
+	if err != nil {
+		log.Printf("Error deleting magic links: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -9,19 +9,53 @@ import (
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+const (
+	MediaModeMesh = "mesh"
+	MediaModeSFU  = "sfu"
+)
+
+// MeetingSourceChat marks meetings started with a chat slash command
+const MeetingSourceChat = "chat"
+
+// MeetingSettings are the options a host can change on a meeting
+type MeetingSettings struct {
+	// E2EERequired blocks clients that don't announce end-to-end encryption
+	// support from joining
+	E2EERequired bool `bson:"e2ee_required" json:"e2ee_required"`
+	// AllowGuests lets people without an account join with a guest token
+	AllowGuests bool `bson:"allow_guests" json:"allow_guests"`
+	// RequireHost2FA only lets the host run the meeting while their account
+	// has two-factor authentication on
+	RequireHost2FA bool `bson:"require_host_2fa" json:"require_host_2fa"`
+}
+
 type Meeting struct {
-	ID          bson.ObjectID `bson:"_id,omitempty" json:"id"`
-	RoomID      string        `bson:"room_id" json:"room_id"`
-	Title       string        `bson:"title" json:"title"`
-	Description string        `bson:"description" json:"description"`
-	CreatedBy   string        `bson:"created_by" json:"created_by"`
-	CreatorName string        `bson:"creator_name" json:"creator_name"`
-	IsActive    bool          `bson:"is_active" json:"is_active"`
-	CreatedAt   time.Time     `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time     `bson:"updated_at" json:"updated_at"`
-	Participants []string     `bson:"participants" json:"participants"` 
+	ID           bson.ObjectID   `bson:"_id,omitempty" json:"id"`
+	RoomID       string          `bson:"room_id" json:"room_id"`
+	Title        string          `bson:"title" json:"title"`
+	Description  string          `bson:"description" json:"description"`
+	CreatedBy    string          `bson:"created_by" json:"created_by"`
+	CreatorName  string          `bson:"creator_name" json:"creator_name"`
+	WorkspaceID  string          `bson:"workspace_id,omitempty" json:"workspace_id,omitempty"`
+	MediaMode    string          `bson:"media_mode" json:"media_mode"`
+	Settings     MeetingSettings `bson:"settings" json:"settings"`
+	IsActive     bool            `bson:"is_active" json:"is_active"`
+	CreatedAt    time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time       `bson:"updated_at" json:"updated_at"`
+	Participants []string        `bson:"participants" json:"participants"`
+	// Roles holds the roles given out in this meeting by user ID. The
+	// creator is always host and isn't listed.
+	Roles map[string]string `bson:"roles,omitempty" json:"roles,omitempty"`
+	// Source is where the meeting was created from when it wasn't the app
+	Source string `bson:"source,omitempty" json:"source,omitempty"`
+	// Schedule is only set for meetings planned ahead of time
+	Schedule *MeetingSchedule `bson:"schedule,omitempty" json:"schedule,omitempty"`
+	// Invitations hold invitees' email addresses, so they're only shown to
+	// people who can invite
+	Invitations []Invitation `bson:"invitations,omitempty" json:"-"`
 }
 
 func GenerateRoomID() string {
@@ -38,6 +72,10 @@ func CreateMeeting(collection *mongo.Collection, meeting *Meeting) error {
 	if meeting.RoomID == "" {
 		meeting.RoomID = GenerateRoomID()
 	}
+
+	if meeting.MediaMode == "" {
+		meeting.MediaMode = MediaModeMesh
+	}
 	
 	log.Printf("Creating meeting room: %s (ID: %s) by %s", meeting.Title, meeting.RoomID, meeting.CreatorName)
 	result, err := collection.InsertOne(context.Background(), meeting)
@@ -51,6 +89,8 @@ func CreateMeeting(collection *mongo.Collection, meeting *Meeting) error {
 		log.Printf("Meeting created successfully with ID: %s, Room ID: %s", oid.Hex(), meeting.RoomID)
 	}
 	
+	PublishEvent(Event{Type: EventMeetingCreated, RoomID: meeting.RoomID, Meeting: meeting})
+	
 	return nil
 }
 
@@ -73,6 +113,11 @@ func FindMeetingByRoomID(collection *mongo.Collection, roomID string) (*Meeting,
 	return &meeting, nil
 }
 
+// IsValidMediaMode reports whether mode is a media mode the hub can run a room in
+func IsValidMediaMode(mode string) bool {
+	return mode == MediaModeMesh || mode == MediaModeSFU
+}
+
 func AddParticipant(collection *mongo.Collection, roomID, userID string) error {
 	filter := bson.M{"room_id": roomID}
 	update := bson.M{
@@ -149,3 +194,93 @@ func DeactivateMeeting(collection *mongo.Collection, roomID string) error {
 	log.Printf("Meeting deactivated. Modified count: %d", result.ModifiedCount)
 	return nil
 }
+
+func UpdateMeetingSettings(collection *mongo.Collection, roomID string, settings MeetingSettings) error {
+	filter := bson.M{"room_id": roomID}
+	update := bson.M{
+		"$set": bson.M{
+			"settings":   settings,
+			"updated_at": time.Now(),
+		},
+	}
+
+	log.Printf("Updating settings for meeting room: %s", roomID)
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error updating meeting settings: %v", err)
+		return err
+	}
+
+	log.Printf("Meeting settings updated. Modified count: %d", result.ModifiedCount)
+	return nil
+}
+
+// GetParticipatedMeetings finds the meetings a user is listed as a
+// participant in
+func GetParticipatedMeetings(collection *mongo.Collection, userID string) ([]Meeting, error) {
+	filter := bson.M{"participants": userID}
+
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error finding participated meetings: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	meetings := []Meeting{}
+	if err = cursor.All(context.Background(), &meetings); err != nil {
+		log.Printf("Error decoding meetings: %v", err)
+		return nil, err
+	}
+
+	return meetings, nil
+}
+
+// AnonymizeMeetingUser removes a deleted user from every meeting. Meetings
+// they hosted are kept for the other participants but ended and no longer
+// point back at them.
+func AnonymizeMeetingUser(collection *mongo.Collection, userID string) error {
+	ctx := context.Background()
+
+	hosted := bson.M{"created_by": userID}
+	update := bson.M{"$set": bson.M{
+		"created_by":   DeletedUserID,
+		"creator_name": DeletedUserName,
+		"is_active":    false,
+		"updated_at":   time.Now(),
+	}}
+	if _, err := collection.UpdateMany(ctx, hosted, update); err != nil {
+		log.Printf("Error anonymizing hosted meetings: %v", err)
+		return err
+	}
+
+	joined := bson.M{"participants": userID}
+	update = bson.M{"$pull": bson.M{"participants": userID}}
+	if _, err := collection.UpdateMany(ctx, joined, update); err != nil {
+		log.Printf("Error removing user from meetings: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetWorkspaceMeetings lists every meeting owned by a workspace, newest first
+func GetWorkspaceMeetings(collection *mongo.Collection, workspaceID string) ([]Meeting, error) {
+	filter := bson.M{"workspace_id": workspaceID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding workspace meetings: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	meetings := []Meeting{}
+	if err = cursor.All(context.Background(), &meetings); err != nil {
+		log.Printf("Error decoding meetings: %v", err)
+		return nil, err
+	}
+
+	return meetings, nil
+}
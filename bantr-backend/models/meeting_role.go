@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Meeting roles, from most to least powerful. The creator is always the
+// host, everyone else is an attendee or guest unless given another role.
+const (
+	MeetingRoleHost      = "host"
+	MeetingRoleCoHost    = "co-host"
+	MeetingRolePresenter = "presenter"
+	MeetingRoleAttendee  = "attendee"
+	MeetingRoleGuest     = "guest"
+)
+
+// Permissions that routes and WebSocket commands check for
+const (
+	PermissionEndMeeting     = "meeting.end"
+	PermissionEditSettings   = "meeting.settings"
+	PermissionManageRoles    = "meeting.roles"
+	PermissionViewAnalytics  = "meeting.analytics"
+	PermissionViewAttendance = "meeting.attendance"
+	PermissionRecord         = "meeting.record"
+	PermissionInvite         = "meeting.invite"
+	// PermissionPresent is for sharing a screen. Offers announcing a screen
+	// share are refused without it.
+	PermissionPresent = "meeting.present"
+)
+
+var meetingRolePermissions = map[string][]string{
+	MeetingRoleHost: {
+		PermissionEndMeeting,
+		PermissionEditSettings,
+		PermissionManageRoles,
+		PermissionViewAnalytics,
+		PermissionViewAttendance,
+		PermissionRecord,
+		PermissionInvite,
+		PermissionPresent,
+	},
+	MeetingRoleCoHost: {
+		PermissionEditSettings,
+		PermissionManageRoles,
+		PermissionViewAnalytics,
+		PermissionViewAttendance,
+		PermissionRecord,
+		PermissionInvite,
+		PermissionPresent,
+	},
+	MeetingRolePresenter: {
+		PermissionPresent,
+	},
+	MeetingRoleAttendee: {},
+	MeetingRoleGuest:    {},
+}
+
+// meetingRoleRank orders roles so we can tell promotions from demotions and
+// stop people handing out roles above their own
+var meetingRoleRank = map[string]int{
+	MeetingRoleGuest:     0,
+	MeetingRoleAttendee:  1,
+	MeetingRolePresenter: 2,
+	MeetingRoleCoHost:    3,
+	MeetingRoleHost:      4,
+}
+
+func IsValidMeetingRole(role string) bool {
+	_, ok := meetingRolePermissions[role]
+	return ok
+}
+
+// MeetingRoleRank returns how powerful a role is compared to the others
+func MeetingRoleRank(role string) int {
+	return meetingRoleRank[role]
+}
+
+func RoleHasPermission(role, permission string) bool {
+	for _, p := range meetingRolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions lists what a role is allowed to do
+func RolePermissions(role string) []string {
+	return append([]string{}, meetingRolePermissions[role]...)
+}
+
+// RoleOf returns a participant's role in the meeting as stored on it. It
+// doesn't know about workspace admins, see utils.MeetingRole for that.
+func (m *Meeting) RoleOf(userID string, isGuest bool) string {
+	if isGuest {
+		return MeetingRoleGuest
+	}
+	if userID != "" && userID == m.CreatedBy {
+		return MeetingRoleHost
+	}
+	if role, ok := m.Roles[userID]; ok {
+		return role
+	}
+	return MeetingRoleAttendee
+}
+
+// SetMeetingRole gives a user a role in a meeting. Setting them back to
+// attendee removes the entry since that's the default.
+func SetMeetingRole(collection *mongo.Collection, roomID, userID, role string) error {
+	field := "roles." + userID
+	update := bson.M{"$set": bson.M{field: role, "updated_at": time.Now()}}
+	if role == MeetingRoleAttendee {
+		update = bson.M{
+			"$unset": bson.M{field: ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		}
+	}
+
+	log.Printf("Setting role of %s in room %s to %s", userID, roomID, role)
+	result, err := collection.UpdateOne(context.Background(), bson.M{"room_id": roomID}, update)
+	if err != nil {
+		log.Printf("Error setting meeting role: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// UserMeetingRole is a role someone was given in a meeting, for data exports
+type UserMeetingRole struct {
+	RoomID string `json:"room_id"`
+	Title  string `json:"title"`
+	Role   string `json:"role"`
+}
+
+// GetUserMeetingRoles lists the roles a user was given across meetings
+func GetUserMeetingRoles(collection *mongo.Collection, userID string) ([]UserMeetingRole, error) {
+	ctx := context.Background()
+
+	cursor, err := collection.Find(ctx, bson.M{"roles." + userID: bson.M{"$exists": true}})
+	if err != nil {
+		log.Printf("Error finding meeting roles: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	meetings := []Meeting{}
+	if err = cursor.All(ctx, &meetings); err != nil {
+		log.Printf("Error decoding meetings: %v", err)
+		return nil, err
+	}
+
+	roles := make([]UserMeetingRole, 0, len(meetings))
+	for _, meeting := range meetings {
+		roles = append(roles, UserMeetingRole{
+			RoomID: meeting.RoomID,
+			Title:  meeting.Title,
+			Role:   meeting.Roles[userID],
+		})
+	}
+	return roles, nil
+}
+
+// RemoveUserMeetingRoles takes away every role a deleted user was given
+func RemoveUserMeetingRoles(collection *mongo.Collection, userID string) error {
+	field := "roles." + userID
+	update := bson.M{
+		"$unset": bson.M{field: ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := collection.UpdateMany(context.Background(), bson.M{field: bson.M{"$exists": true}}, update)
+	if err != nil {
+		log.Printf("Error removing meeting roles: %v", err)
+		return err
+	}
+
+	return nil
+}
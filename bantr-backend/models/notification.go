@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Notification types
+const (
+	NotificationMeetingInvite      = "meeting.invite"
+	NotificationMeetingRescheduled = "meeting.rescheduled"
+	NotificationMeetingStarted     = "meeting.started"
+	NotificationRoleChanged        = "meeting.role_changed"
+)
+
+// Notification is something shown in a user's notification center
+type Notification struct {
+	ID     bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID string        `bson:"user_id" json:"-"`
+	Type   string        `bson:"type" json:"type"`
+	Title  string        `bson:"title" json:"title"`
+	Body   string        `bson:"body,omitempty" json:"body,omitempty"`
+	RoomID string        `bson:"room_id,omitempty" json:"room_id,omitempty"`
+	// URL is the page the notification opens
+	URL       string     `bson:"url,omitempty" json:"url,omitempty"`
+	ReadAt    *time.Time `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// EnsureNotificationIndexes creates the indexes for listing a user's
+// notifications and drops notifications once they're older than ttl
+func EnsureNotificationIndexes(collection *mongo.Collection, ttl time.Duration) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "read_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(ttl.Seconds())),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating notification indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateNotification(collection *mongo.Collection, notification *Notification) error {
+	notification.CreatedAt = time.Now()
+
+	result, err := collection.InsertOne(context.Background(), notification)
+	if err != nil {
+		log.Printf("Error creating notification: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		notification.ID = oid
+	}
+
+	return nil
+}
+
+// GetUserNotifications pages through a user's notifications, newest first,
+// and counts how many there are in total
+func GetUserNotifications(collection *mongo.Collection, userID string, unreadOnly bool, skip, limit int64) ([]Notification, int64, error) {
+	ctx := context.Background()
+
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read_at"] = nil
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("Error counting notifications: %v", err)
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error finding notifications: %v", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []Notification{}
+	if err = cursor.All(ctx, &notifications); err != nil {
+		log.Printf("Error decoding notifications: %v", err)
+		return nil, 0, err
+	}
+
+	return notifications, total, nil
+}
+
+// GetAllUserNotifications returns every notification a user has, for data
+// exports
+func GetAllUserNotifications(collection *mongo.Collection, userID string) ([]Notification, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		log.Printf("Error finding notifications: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	notifications := []Notification{}
+	if err = cursor.All(context.Background(), &notifications); err != nil {
+		log.Printf("Error decoding notifications: %v", err)
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func CountUnreadNotifications(collection *mongo.Collection, userID string) (int64, error) {
+	count, err := collection.CountDocuments(context.Background(), bson.M{"user_id": userID, "read_at": nil})
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkNotificationRead marks one of a user's notifications read. Marking it
+// again keeps the time it was first read.
+func MarkNotificationRead(collection *mongo.Collection, id bson.ObjectID, userID string) (*Notification, error) {
+	ctx := context.Background()
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID, "read_at": nil},
+		bson.M{"$set": bson.M{"read_at": time.Now()}})
+	if err != nil {
+		log.Printf("Error marking notification read: %v", err)
+		return nil, err
+	}
+
+	var notification Notification
+	if err := collection.FindOne(ctx, filter).Decode(&notification); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding notification: %v", err)
+		}
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+// MarkAllNotificationsRead marks every unread notification a user has read
+// and returns how many there were
+func MarkAllNotificationsRead(collection *mongo.Collection, userID string) (int64, error) {
+	result, err := collection.UpdateMany(context.Background(),
+		bson.M{"user_id": userID, "read_at": nil},
+		bson.M{"$set": bson.M{"read_at": time.Now()}})
+	if err != nil {
+		log.Printf("Error marking notifications read: %v", err)
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func DeleteUserNotifications(collection *mongo.Collection, userID string) error {
+	_, err := collection.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting notifications: %v", err)
+		return err
+	}
+
+	return nil
+}
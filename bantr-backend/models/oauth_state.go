@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// OAuthState is what we need to remember between sending a user to a login
+// provider and them coming back to the callback. LinkUserID is set when a
+// logged in user is linking the identity to their account instead of logging
+// in with it, along with the session they started the link from.
+type OAuthState struct {
+	ID            bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	State         string        `bson:"state" json:"state"`
+	Provider      string        `bson:"provider" json:"provider"`
+	Nonce         string        `bson:"nonce" json:"-"`
+	CodeVerifier  string        `bson:"code_verifier" json:"-"`
+	RedirectPath  string        `bson:"redirect_path" json:"redirect_path"`
+	LinkUserID    string        `bson:"link_user_id,omitempty" json:"link_user_id,omitempty"`
+	LinkSessionID string        `bson:"link_session_id,omitempty" json:"-"`
+	ExpiresAt     time.Time     `bson:"expires_at" json:"expires_at"`
+}
+
+// EnsureOAuthStateIndexes makes states unique and drops them once expired
+func EnsureOAuthStateIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "state", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating oauth state indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateOAuthState(collection *mongo.Collection, state *OAuthState) error {
+	_, err := collection.InsertOne(context.Background(), state)
+	if err != nil {
+		log.Printf("Error creating oauth state: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeOAuthState looks up a state and deletes it in the same step so a
+// callback can't be replayed
+func ConsumeOAuthState(collection *mongo.Collection, provider, state string) (*OAuthState, error) {
+	filter := bson.M{
+		"state":      state,
+		"provider":   provider,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var oauthState OAuthState
+	err := collection.FindOneAndDelete(context.Background(), filter).Decode(&oauthState)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error consuming oauth state: %v", err)
+		}
+		return nil, err
+	}
+
+	return &oauthState, nil
+}
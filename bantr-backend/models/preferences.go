@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// NotificationPreferences are the kinds of notification a user opted into
+type NotificationPreferences struct {
+	MeetingInvites   bool `bson:"meeting_invites" json:"meeting_invites"`
+	MeetingReminders bool `bson:"meeting_reminders" json:"meeting_reminders"`
+	RecordingReady   bool `bson:"recording_ready" json:"recording_ready"`
+	ProductUpdates   bool `bson:"product_updates" json:"product_updates"`
+}
+
+// MeetingDefaults are applied to meetings the user creates when the request
+// leaves them out
+type MeetingDefaults struct {
+	MediaMode string          `bson:"media_mode" json:"media_mode"`
+	Settings  MeetingSettings `bson:"settings" json:"settings"`
+}
+
+// Preferences are a user's personal settings. There's at most one document
+// per user and users who never saved any get DefaultPreferences.
+type Preferences struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID       bson.ObjectID `bson:"user_id" json:"user_id"`
+	MicOnJoin    bool          `bson:"mic_on_join" json:"mic_on_join"`
+	CameraOnJoin bool          `bson:"camera_on_join" json:"camera_on_join"`
+	// DisplayName replaces the account name in meetings when set
+	DisplayName     string                  `bson:"display_name" json:"display_name"`
+	TimeZone        string                  `bson:"time_zone" json:"time_zone"`
+	Locale          string                  `bson:"locale" json:"locale"`
+	Notifications   NotificationPreferences `bson:"notifications" json:"notifications"`
+	MeetingDefaults MeetingDefaults         `bson:"meeting_defaults" json:"meeting_defaults"`
+	UpdatedAt       time.Time               `bson:"updated_at" json:"updated_at"`
+}
+
+func DefaultPreferences(userID bson.ObjectID) *Preferences {
+	return &Preferences{
+		UserID:       userID,
+		MicOnJoin:    true,
+		CameraOnJoin: true,
+		TimeZone:     "UTC",
+		Locale:       "en",
+		Notifications: NotificationPreferences{
+			MeetingInvites:   true,
+			MeetingReminders: true,
+			RecordingReady:   true,
+		},
+		MeetingDefaults: MeetingDefaults{
+			MediaMode: MediaModeMesh,
+		},
+	}
+}
+
+// EnsurePreferencesIndexes keeps it to one preferences document per user
+func EnsurePreferencesIndexes(collection *mongo.Collection) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := collection.Indexes().CreateOne(context.Background(), index)
+	if err != nil {
+		log.Printf("Error creating preferences indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetPreferences returns the user's saved preferences, or the defaults if
+// they haven't saved any
+func GetPreferences(collection *mongo.Collection, userID bson.ObjectID) (*Preferences, error) {
+	var prefs Preferences
+	err := collection.FindOne(context.Background(), bson.M{"user_id": userID}).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return DefaultPreferences(userID), nil
+	}
+	if err != nil {
+		log.Printf("Error finding preferences for user %s: %v", userID.Hex(), err)
+		return nil, err
+	}
+
+	return &prefs, nil
+}
+
+// SavePreferences writes the whole preferences document, creating it on the
+// first save
+func SavePreferences(collection *mongo.Collection, prefs *Preferences) error {
+	prefs.UpdatedAt = time.Now()
+
+	filter := bson.M{"user_id": prefs.UserID}
+	update := bson.M{"$set": bson.M{
+		"mic_on_join":      prefs.MicOnJoin,
+		"camera_on_join":   prefs.CameraOnJoin,
+		"display_name":     prefs.DisplayName,
+		"time_zone":        prefs.TimeZone,
+		"locale":           prefs.Locale,
+		"notifications":    prefs.Notifications,
+		"meeting_defaults": prefs.MeetingDefaults,
+		"updated_at":       prefs.UpdatedAt,
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), filter, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error saving preferences for user %s: %v", prefs.UserID.Hex(), err)
+		return err
+	}
+
+	return nil
+}
+
+func DeletePreferences(collection *mongo.Collection, userID bson.ObjectID) error {
+	_, err := collection.DeleteOne(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting preferences for user %s: %v", userID.Hex(), err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Recording is a single participant track written to disk while a room was
+// being recorded
+type Recording struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID    string        `bson:"room_id" json:"room_id"`
+	UserID    string        `bson:"user_id" json:"user_id"`
+	Name      string        `bson:"name" json:"name"`
+	TrackID   string        `bson:"track_id" json:"track_id"`
+	Kind      string        `bson:"kind" json:"kind"`
+	MimeType  string        `bson:"mime_type" json:"mime_type"`
+	FilePath  string        `bson:"file_path" json:"-"`
+	FileName  string        `bson:"file_name" json:"file_name"`
+	SizeBytes int64         `bson:"size_bytes" json:"size_bytes"`
+	StartedBy string        `bson:"started_by" json:"started_by"`
+	StartedAt time.Time     `bson:"started_at" json:"started_at"`
+	EndedAt   *time.Time    `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+}
+
+func CreateRecording(collection *mongo.Collection, recording *Recording) error {
+	if recording.StartedAt.IsZero() {
+		recording.StartedAt = time.Now()
+	}
+
+	log.Printf("Creating recording of %s (%s) in room %s", recording.UserID, recording.Kind, recording.RoomID)
+	result, err := collection.InsertOne(context.Background(), recording)
+	if err != nil {
+		log.Printf("Error creating recording: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		recording.ID = oid
+	}
+
+	return nil
+}
+
+// FinishRecording marks a recording as complete once its file is closed
+func FinishRecording(collection *mongo.Collection, id bson.ObjectID, sizeBytes int64) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{
+			"ended_at":   time.Now(),
+			"size_bytes": sizeBytes,
+		},
+	}
+
+	log.Printf("Finishing recording %s (%d bytes)", id.Hex(), sizeBytes)
+	_, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error finishing recording: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func FindRecordingByID(collection *mongo.Collection, id bson.ObjectID) (*Recording, error) {
+	var recording Recording
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&recording)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding recording: %v", err)
+		}
+		return nil, err
+	}
+
+	return &recording, nil
+}
+
+func GetRoomRecordings(collection *mongo.Collection, roomID string) ([]Recording, error) {
+	filter := bson.M{"room_id": roomID}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding recordings: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	recordings := []Recording{}
+	if err = cursor.All(context.Background(), &recordings); err != nil {
+		log.Printf("Error decoding recordings: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Found %d recordings for room %s", len(recordings), roomID)
+	return recordings, nil
+}
+
+func GetUserRecordings(collection *mongo.Collection, userID string) ([]Recording, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding user recordings: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	recordings := []Recording{}
+	if err = cursor.All(context.Background(), &recordings); err != nil {
+		log.Printf("Error decoding recordings: %v", err)
+		return nil, err
+	}
+
+	return recordings, nil
+}
+
+// DeleteUserRecordings removes the records of a user's own tracks and
+// returns them so the caller can delete the files. Recordings they started
+// of other people are kept without their ID.
+func DeleteUserRecordings(collection *mongo.Collection, userID string) ([]Recording, error) {
+	recordings, err := GetUserRecordings(collection, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if _, err := collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		log.Printf("Error deleting user recordings: %v", err)
+		return nil, err
+	}
+
+	filter := bson.M{"started_by": userID}
+	update := bson.M{"$set": bson.M{"started_by": DeletedUserID}}
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		log.Printf("Error anonymizing recordings: %v", err)
+		return nil, err
+	}
+
+	return recordings, nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// RevokedToken is a denylist entry for access tokens. An entry either names
+// a single token by its jti or a whole session by its sid. Entries only need
+// to live until the tokens they cover would have expired anyway, so a TTL
+// index on expires_at cleans them up.
+type RevokedToken struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenID   string        `bson:"jti,omitempty" json:"jti,omitempty"`
+	SessionID string        `bson:"sid,omitempty" json:"sid,omitempty"`
+	RevokedAt time.Time     `bson:"revoked_at" json:"revoked_at"`
+	ExpiresAt time.Time     `bson:"expires_at" json:"expires_at"`
+}
+
+// EnsureRevokedTokenIndexes creates the lookup and TTL indexes for the
+// denylist
+func EnsureRevokedTokenIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}},
+		{Keys: bson.D{{Key: "sid", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating revoked token indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// RevokeTokenID denylists a single access token until it expires
+func RevokeTokenID(collection *mongo.Collection, jti string, expiresAt time.Time) error {
+	return insertRevokedToken(collection, &RevokedToken{TokenID: jti, ExpiresAt: expiresAt})
+}
+
+// RevokeSessionTokens denylists every access token issued for a session.
+// expiresAt should be at least as late as the newest token for the session.
+func RevokeSessionTokens(collection *mongo.Collection, sessionID string, expiresAt time.Time) error {
+	return insertRevokedToken(collection, &RevokedToken{SessionID: sessionID, ExpiresAt: expiresAt})
+}
+
+func insertRevokedToken(collection *mongo.Collection, token *RevokedToken) error {
+	token.RevokedAt = time.Now()
+
+	_, err := collection.InsertOne(context.Background(), token)
+	if err != nil {
+		log.Printf("Error revoking token: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks the denylist for either the token or its session
+func IsTokenRevoked(collection *mongo.Collection, jti, sessionID string) (bool, error) {
+	conditions := bson.A{}
+	if jti != "" {
+		conditions = append(conditions, bson.M{"jti": jti})
+	}
+	if sessionID != "" {
+		conditions = append(conditions, bson.M{"sid": sessionID})
+	}
+	if len(conditions) == 0 {
+		return false, nil
+	}
+
+	filter := bson.M{"$or": conditions, "expires_at": bson.M{"$gt": time.Now()}}
+	count, err := collection.CountDocuments(context.Background(), filter, options.Count().SetLimit(1))
+	if err != nil {
+		log.Printf("Error checking revoked tokens: %v", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// rotated out is presented again. The session is revoked when this happens
+// since it means the token has most likely leaked.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// Session is a single login. Only hashes of the refresh tokens are stored.
+type Session struct {
+	ID                  bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID              string        `bson:"user_id" json:"user_id"`
+	RefreshTokenHash    string        `bson:"refresh_token_hash" json:"-"`
+	PreviousRefreshHash string        `bson:"previous_refresh_hash,omitempty" json:"-"`
+	UserAgent           string        `bson:"user_agent" json:"user_agent"`
+	IPAddress           string        `bson:"ip_address" json:"ip_address"`
+	CreatedAt           time.Time     `bson:"created_at" json:"created_at"`
+	LastUsedAt          time.Time     `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt           time.Time     `bson:"expires_at" json:"expires_at"`
+	RevokedAt           *time.Time    `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// EnsureSessionIndexes creates the indexes used to look sessions up by
+// refresh token
+func EnsureSessionIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "refresh_token_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "previous_refresh_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating session indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateSession(collection *mongo.Collection, session *Session) error {
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastUsedAt = now
+
+	log.Printf("Creating session for user %s", session.UserID)
+	result, err := collection.InsertOne(context.Background(), session)
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		session.ID = oid
+	}
+
+	return nil
+}
+
+func FindSessionByID(collection *mongo.Collection, id bson.ObjectID) (*Session, error) {
+	var session Session
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&session)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding session: %v", err)
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RotateRefreshToken swaps the session's refresh token hash for a new one.
+// The swap only happens if oldHash is still the current hash, so two
+// concurrent refreshes with the same token can't both succeed. Presenting a
+// hash that was already rotated out revokes the session and returns it along
+// with ErrRefreshTokenReused.
+func RotateRefreshToken(collection *mongo.Collection, oldHash, newHash string, expiresAt time.Time) (*Session, error) {
+	now := time.Now()
+	filter := bson.M{
+		"refresh_token_hash": oldHash,
+		"revoked_at":         bson.M{"$exists": false},
+		"expires_at":         bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"refresh_token_hash":    newHash,
+			"previous_refresh_hash": oldHash,
+			"last_used_at":          now,
+			"expires_at":            expiresAt,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var session Session
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&session)
+	if err == nil {
+		return &session, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Printf("Error rotating refresh token: %v", err)
+		return nil, err
+	}
+
+	// Not the current token, check whether it's one we already rotated out
+	err = collection.FindOne(context.Background(), bson.M{"previous_refresh_hash": oldHash}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Error looking up rotated refresh token: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Refresh token reuse detected for session %s, revoking", session.ID.Hex())
+	if err := RevokeSession(collection, session.ID); err != nil {
+		return nil, err
+	}
+	return &session, ErrRefreshTokenReused
+}
+
+func RevokeSession(collection *mongo.Collection, id bson.ObjectID) error {
+	filter := bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now()}}
+
+	log.Printf("Revoking session %s", id.Hex())
+	_, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error revoking session: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetUserSessions lists a user's sessions, newest first
+func GetUserSessions(collection *mongo.Collection, userID string) ([]Session, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding sessions: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	sessions := []Session{}
+	if err = cursor.All(context.Background(), &sessions); err != nil {
+		log.Printf("Error decoding sessions: %v", err)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func DeleteUserSessions(collection *mongo.Collection, userID string) error {
+	_, err := collection.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting sessions: %v", err)
+		return err
+	}
+
+	return nil
+}
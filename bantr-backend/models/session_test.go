@@ -0,0 +1,112 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/drivertest"
+)
+
+// newMockCollection returns a collection whose server replies are scripted
+// with AddResponses, one per command, in order
+func newMockCollection(t *testing.T, name string) (*mongo.Collection, *drivertest.MockDeployment) {
+	t.Helper()
+
+	deployment := drivertest.NewMockDeployment()
+	opts := options.Client()
+	opts.Deployment = deployment
+
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		t.Fatalf("connecting to mock deployment: %v", err)
+	}
+	return client.Database("bantr_test").Collection(name), deployment
+}
+
+func findAndModifyReply(doc interface{}) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: doc}}
+}
+
+func findReply(ns string, docs ...interface{}) bson.D {
+	batch := bson.A{}
+	for _, doc := range docs {
+		batch = append(batch, doc)
+	}
+	return bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: int64(0)},
+			{Key: "ns", Value: ns},
+			{Key: "firstBatch", Value: batch},
+		}},
+	}
+}
+
+func updateReply(modified int) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: modified}, {Key: "nModified", Value: modified}}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	session := Session{
+		ID:                  bson.NewObjectID(),
+		UserID:              bson.NewObjectID().Hex(),
+		RefreshTokenHash:    "new-hash",
+		PreviousRefreshHash: "old-hash",
+		ExpiresAt:           time.Now().Add(time.Hour),
+	}
+	ns := "bantr_test.sessions"
+
+	tests := []struct {
+		name    string
+		replies []bson.D
+		wantErr error
+		// wantSession is whether the session comes back, which callers
+		// need on reuse to revoke its access tokens
+		wantSession bool
+	}{
+		{
+			name:        "current token rotates",
+			replies:     []bson.D{findAndModifyReply(session)},
+			wantSession: true,
+		},
+		{
+			name: "rotated out token is reuse",
+			replies: []bson.D{
+				findAndModifyReply(nil),
+				findReply(ns, session),
+				updateReply(1),
+			},
+			wantErr:     ErrRefreshTokenReused,
+			wantSession: true,
+		},
+		{
+			name: "unknown token",
+			replies: []bson.D{
+				findAndModifyReply(nil),
+				findReply(ns),
+			},
+			wantErr: mongo.ErrNoDocuments,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection, deployment := newMockCollection(t, "sessions")
+			deployment.AddResponses(tt.replies...)
+
+			got, err := RotateRefreshToken(collection, "old-hash", "newer-hash", time.Now().Add(time.Hour))
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantSession && (got == nil || got.ID != session.ID) {
+				t.Errorf("session = %+v, want %s", got, session.ID.Hex())
+			}
+			if !tt.wantSession && got != nil {
+				t.Errorf("session = %+v, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MaxTwoFactorAttempts is how many codes can be tried against one login
+// challenge before it's thrown away
+const MaxTwoFactorAttempts = 5
+
+// A user's codes stop being checked for TwoFactorLockout after
+// MaxTwoFactorFailures wrong ones in a row, however many challenges they're
+// spread over
+const (
+	MaxTwoFactorFailures = 10
+	TwoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrTwoFactorCodeUsed = errors.New("two-factor code already used")
+	ErrTwoFactorLocked   = errors.New("too many failed two-factor codes")
+)
+
+// TwoFactor is a user's TOTP setup. PendingSecret holds a secret that was
+// handed out for enrollment but not confirmed with a code yet.
+type TwoFactor struct {
+	Enabled            bool       `bson:"enabled" json:"enabled"`
+	Secret             string     `bson:"secret,omitempty" json:"-"`
+	PendingSecret      string     `bson:"pending_secret,omitempty" json:"-"`
+	RecoveryCodeHashes []string   `bson:"recovery_code_hashes,omitempty" json:"-"`
+	LastStep           int64      `bson:"last_step" json:"-"`
+	EnabledAt          *time.Time `bson:"enabled_at,omitempty" json:"enabled_at,omitempty"`
+	// FailedAttempts counts wrong codes since the last right one
+	FailedAttempts int        `bson:"failed_attempts,omitempty" json:"-"`
+	LockedUntil    *time.Time `bson:"locked_until,omitempty" json:"-"`
+}
+
+// HasTwoFactor reports whether the user has to enter a code to log in
+func (u *User) HasTwoFactor() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// TwoFactorLocked reports whether the user entered too many wrong codes
+// recently to have any more checked
+func (u *User) TwoFactorLocked() bool {
+	return u.TwoFactor != nil && u.TwoFactor.LockedUntil != nil && u.TwoFactor.LockedUntil.After(time.Now())
+}
+
+// SetPendingTwoFactorSecret stores a secret for the user to confirm. An
+// enabled setup isn't touched until the new secret is confirmed.
+func SetPendingTwoFactorSecret(collection *mongo.Collection, userID bson.ObjectID, secret string) error {
+	update := bson.M{"$set": bson.M{"two_factor.pending_secret": secret}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": userID}, update)
+	if err != nil {
+		log.Printf("Error storing pending 2FA secret: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// EnableTwoFactor switches the pending secret on along with a fresh set of
+// recovery codes
+func EnableTwoFactor(collection *mongo.Collection, userID bson.ObjectID, secret string, recoveryHashes []string, step int64) error {
+	now := time.Now()
+	filter := bson.M{"_id": userID, "two_factor.pending_secret": secret}
+	update := bson.M{"$set": bson.M{"two_factor": TwoFactor{
+		Enabled:            true,
+		Secret:             secret,
+		RecoveryCodeHashes: recoveryHashes,
+		LastStep:           step,
+		EnabledAt:          &now,
+	}}}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error enabling 2FA: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	log.Printf("Enabled 2FA for user %s", userID.Hex())
+	return nil
+}
+
+func DisableTwoFactor(collection *mongo.Collection, userID bson.ObjectID) error {
+	update := bson.M{"$unset": bson.M{"two_factor": ""}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": userID}, update)
+	if err != nil {
+		log.Printf("Error disabling 2FA: %v", err)
+		return err
+	}
+
+	log.Printf("Disabled 2FA for user %s", userID.Hex())
+	return nil
+}
+
+func ReplaceRecoveryCodes(collection *mongo.Collection, userID bson.ObjectID, recoveryHashes []string) error {
+	filter := bson.M{"_id": userID, "two_factor.enabled": true}
+	update := bson.M{"$set": bson.M{"two_factor.recovery_code_hashes": recoveryHashes}}
+
+	_, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error replacing recovery codes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// RecordTwoFactorStep remembers the newest TOTP time step used. It fails
+// with ErrTwoFactorCodeUsed if that step or a later one was already used, so
+// the same code can't be accepted twice even by concurrent requests.
+func RecordTwoFactorStep(collection *mongo.Collection, userID bson.ObjectID, step int64) error {
+	filter := bson.M{"_id": userID, "two_factor.last_step": bson.M{"$lt": step}}
+	update := bson.M{"$set": bson.M{"two_factor.last_step": step}}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error recording 2FA step: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTwoFactorCodeUsed
+	}
+
+	return nil
+}
+
+// RecordTwoFactorFailure counts a wrong code against the user and locks
+// their 2FA for TwoFactorLockout once they reach MaxTwoFactorFailures
+func RecordTwoFactorFailure(collection *mongo.Collection, userID bson.ObjectID) error {
+	ctx := context.Background()
+	filter := bson.M{"_id": userID, "two_factor.enabled": true}
+	update := bson.M{"$inc": bson.M{"two_factor.failed_attempts": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var user User
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error recording 2FA failure: %v", err)
+			return err
+		}
+		return nil
+	}
+	if user.TwoFactor == nil || user.TwoFactor.FailedAttempts < MaxTwoFactorFailures {
+		return nil
+	}
+
+	filter = bson.M{"_id": userID, "two_factor.failed_attempts": bson.M{"$gte": MaxTwoFactorFailures}}
+	update = bson.M{"$set": bson.M{
+		"two_factor.failed_attempts": 0,
+		"two_factor.locked_until":    time.Now().Add(TwoFactorLockout),
+	}}
+	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+		log.Printf("Error locking 2FA: %v", err)
+		return err
+	}
+
+	log.Printf("Locked 2FA for user %s after %d failed codes", userID.Hex(), MaxTwoFactorFailures)
+	return nil
+}
+
+// ResetTwoFactorFailures clears the failed code count after a right code
+func ResetTwoFactorFailures(collection *mongo.Collection, userID bson.ObjectID) error {
+	update := bson.M{
+		"$set":   bson.M{"two_factor.failed_attempts": 0},
+		"$unset": bson.M{"two_factor.locked_until": ""},
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": userID, "two_factor.enabled": true}, update)
+	if err != nil {
+		log.Printf("Error resetting 2FA failures: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeRecoveryCode removes a recovery code so it only works once. It
+// fails with mongo.ErrNoDocuments if the code isn't one of the user's.
+func ConsumeRecoveryCode(collection *mongo.Collection, userID bson.ObjectID, codeHash string) error {
+	filter := bson.M{"_id": userID, "two_factor.recovery_code_hashes": codeHash}
+	update := bson.M{"$pull": bson.M{"two_factor.recovery_code_hashes": codeHash}}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error consuming recovery code: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	log.Printf("Recovery code used by user %s", userID.Hex())
+	return nil
+}
+
+// TwoFactorChallenge is a login that got past the first factor and is
+// waiting for a code. The client only holds the token, we store its hash.
+type TwoFactorChallenge struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenHash string        `bson:"token_hash" json:"-"`
+	UserID    bson.ObjectID `bson:"user_id" json:"user_id"`
+	Attempts  int           `bson:"attempts" json:"attempts"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time     `bson:"expires_at" json:"expires_at"`
+}
+
+func EnsureTwoFactorChallengeIndexes(collection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+
+	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Printf("Error creating 2FA challenge indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateTwoFactorChallenge(collection *mongo.Collection, challenge *TwoFactorChallenge) error {
+	challenge.CreatedAt = time.Now()
+
+	_, err := collection.InsertOne(context.Background(), challenge)
+	if err != nil {
+		log.Printf("Error creating 2FA challenge: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// AttemptTwoFactorChallenge counts an attempt against a challenge and
+// returns it. Once a challenge runs out of attempts or expires it fails with
+// mongo.ErrNoDocuments.
+func AttemptTwoFactorChallenge(collection *mongo.Collection, tokenHash string) (*TwoFactorChallenge, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"attempts":   bson.M{"$lt": MaxTwoFactorAttempts},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	update := bson.M{"$inc": bson.M{"attempts": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var challenge TwoFactorChallenge
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&challenge)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error loading 2FA challenge: %v", err)
+		}
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+func DeleteTwoFactorChallenge(collection *mongo.Collection, id bson.ObjectID) error {
+	_, err := collection.DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting 2FA challenge: %v", err)
+		return err
+	}
+
+	return nil
+}
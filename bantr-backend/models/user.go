@@ -2,20 +2,100 @@ package models
 
 import (
 	"context"
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	// ErrIdentityInUse means the external account is already linked to a
+	// different user
+	ErrIdentityInUse = errors.New("identity is linked to another user")
+	// ErrEmailInUse means an unverified email matches an existing account,
+	// so we can neither link to it nor create a second user with it
+	ErrEmailInUse = errors.New("email belongs to an existing account")
+	// ErrLastIdentity stops a user from unlinking the only way they have to
+	// log in
+	ErrLastIdentity = errors.New("cannot unlink the last identity")
+	// ErrUserDeactivated means the user was switched off by their identity
+	// provider and can't sign in
+	ErrUserDeactivated = errors.New("user is deactivated")
+)
+
+// Identity is an account at an external login provider that is linked to a
+// user. Users are found by provider and subject, never by the email the
+// provider reports, since that can change or be unverified.
+type Identity struct {
+	Provider      string    `bson:"provider" json:"provider"`
+	Subject       string    `bson:"subject" json:"subject"`
+	Email         string    `bson:"email" json:"email"`
+	EmailVerified bool      `bson:"email_verified" json:"email_verified"`
+	LinkedAt      time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// Avatar points at an uploaded profile picture. Each upload gets a new
+// version so old thumbnails can be cached forever.
+type Avatar struct {
+	Version   string    `bson:"version" json:"version"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// DeletedUserID and DeletedUserName replace a deleted user's ID and name in
+// records that are kept for other people, like the meetings they hosted
+const (
+	DeletedUserID   = "deleted"
+	DeletedUserName = "Deleted user"
 )
 
 type User struct {
-	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string        `bson:"name" json:"name"`
-	Email     string        `bson:"email" json:"email"`
-	Picture   string        `bson:"picture" json:"picture"`
-	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string        `bson:"name" json:"name"`
+	Email      string        `bson:"email" json:"email"`
+	Picture    string        `bson:"picture" json:"picture"`
+	Identities []Identity    `bson:"identities,omitempty" json:"identities,omitempty"`
+	Avatar     *Avatar       `bson:"avatar,omitempty" json:"avatar,omitempty"`
+	TwoFactor  *TwoFactor    `bson:"two_factor,omitempty" json:"two_factor,omitempty"`
+	// ExternalID is the user's ID in the identity provider that provisions
+	// them over SCIM
+	ExternalID    string     `bson:"external_id,omitempty" json:"external_id,omitempty"`
+	Deactivated   bool       `bson:"deactivated,omitempty" json:"deactivated,omitempty"`
+	DeactivatedAt *time.Time `bson:"deactivated_at,omitempty" json:"deactivated_at,omitempty"`
+	// Bots are accounts owned by a user that only act through API keys
+	IsBot      bool   `bson:"is_bot,omitempty" json:"is_bot,omitempty"`
+	BotOwnerID string `bson:"bot_owner_id,omitempty" json:"bot_owner_id,omitempty"`
+	// EditedFields lists the profile fields the user changed themselves.
+	// Logins don't overwrite those with what the provider sends.
+	EditedFields []string  `bson:"edited_fields,omitempty" json:"edited_fields,omitempty"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Profile fields a user can edit
+const (
+	ProfileFieldName    = "name"
+	ProfileFieldPicture = "picture"
+)
+
+// HasEdited reports whether the user changed a profile field themselves
+func (u *User) HasEdited(field string) bool {
+	for _, edited := range u.EditedFields {
+		if edited == field {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkEdited records that the user changed a profile field themselves
+func (u *User) MarkEdited(field string) {
+	if !u.HasEdited(field) {
+		u.EditedFields = append(u.EditedFields, field)
+	}
 }
 
 // CreateUser creates a new user in the database
@@ -64,13 +144,15 @@ func UpdateUser(collection *mongo.Collection, user *User) error {
 	user.UpdatedAt = time.Now()
 
 	filter := bson.M{"_id": user.ID}
-	update := bson.M{
-		"$set": bson.M{
-			"name":       user.Name,
-			"picture":    user.Picture,
-			"updated_at": user.UpdatedAt,
-		},
+	fields := bson.M{
+		"name":       user.Name,
+		"picture":    user.Picture,
+		"updated_at": user.UpdatedAt,
+	}
+	if user.EditedFields != nil {
+		fields["edited_fields"] = user.EditedFields
 	}
+	update := bson.M{"$set": fields}
 
 	log.Printf("Updating user: %s (ID: %s)", user.Name, user.ID.Hex())
 	result, err := collection.UpdateOne(context.Background(), filter, update)
@@ -83,6 +165,36 @@ func UpdateUser(collection *mongo.Collection, user *User) error {
 	return nil
 }
 
+// SetUserAvatar points the user's picture at a newly uploaded avatar. It
+// counts as the user editing their picture, so logins won't replace it.
+// The previous avatar, if any, is returned so its blobs can be cleaned up.
+func SetUserAvatar(collection *mongo.Collection, userID bson.ObjectID, avatar Avatar, picture string) (*User, *Avatar, error) {
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"avatar":     avatar,
+			"picture":    picture,
+			"updated_at": time.Now(),
+		},
+		"$addToSet": bson.M{"edited_fields": ProfileFieldPicture},
+	}
+
+	var previous User
+	err := collection.FindOneAndUpdate(context.Background(), filter, update).Decode(&previous)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error setting avatar for user %s: %v", userID.Hex(), err)
+		}
+		return nil, nil, err
+	}
+
+	user := previous
+	user.Avatar = &avatar
+	user.Picture = picture
+	user.MarkEdited(ProfileFieldPicture)
+	return &user, previous.Avatar, nil
+}
+
 // FindOrCreateUser finds a user by email or creates a new one
 func FindOrCreateUser(collection *mongo.Collection, name, email, picture string) (*User, error) {
 	log.Printf("FindOrCreateUser called for: %s (%s)", name, email)
@@ -90,11 +202,8 @@ func FindOrCreateUser(collection *mongo.Collection, name, email, picture string)
 	// Try to find existing user
 	existingUser, err := FindUserByEmail(collection, email)
 	if err == nil {
-		// User exists, update their info
-		log.Printf("User exists, updating info")
-		existingUser.Name = name
-		existingUser.Picture = picture
-		err = UpdateUser(collection, existingUser)
+		// User exists, update whatever they haven't edited themselves
+		err = syncProviderProfile(collection, existingUser, name, picture)
 		return existingUser, err
 	}
 
@@ -121,3 +230,386 @@ func FindOrCreateUser(collection *mongo.Collection, name, email, picture string)
 	log.Printf("Unexpected error in FindOrCreateUser: %v", err)
 	return nil, err
 }
+
+// FindUserByID finds a user by their ID
+func FindUserByID(collection *mongo.Collection, id bson.ObjectID) (*User, error) {
+	var user User
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&user)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding user: %v", err)
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindUsersByIDs loads several users at once, keyed by their hex ID
+func FindUsersByIDs(collection *mongo.Collection, ids []bson.ObjectID) (map[string]User, error) {
+	cursor, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Printf("Error finding users: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var users []User
+	if err = cursor.All(context.Background(), &users); err != nil {
+		log.Printf("Error decoding users: %v", err)
+		return nil, err
+	}
+
+	byID := make(map[string]User, len(users))
+	for _, user := range users {
+		byID[user.ID.Hex()] = user
+	}
+	return byID, nil
+}
+
+// EnsureUserIndexes makes sure an external identity can only ever belong to
+// one user
+func EnsureUserIndexes(collection *mongo.Collection) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"identities.provider": bson.M{"$exists": true},
+		}),
+	}
+
+	_, err := collection.Indexes().CreateOne(context.Background(), index)
+	if err != nil {
+		log.Printf("Error creating user indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// FindUserByIdentity finds the user an external identity is linked to
+func FindUserByIdentity(collection *mongo.Collection, provider, subject string) (*User, error) {
+	var user User
+	filter := bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	}
+
+	err := collection.FindOne(context.Background(), filter).Decode(&user)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding user by identity: %v", err)
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindOrCreateUserByIdentity logs in through an external identity. A linked
+// identity always wins. Otherwise a verified email is linked to the account
+// that has it, and a new user is created if nobody does. Existing users get
+// the provider's name and picture unless they edited those themselves, and
+// empty values never replace anything.
+func FindOrCreateUserByIdentity(collection *mongo.Collection, identity Identity, name, picture string) (*User, error) {
+	user, err := FindUserByIdentity(collection, identity.Provider, identity.Subject)
+	if err == nil {
+		updateIdentityEmail(collection, user.ID, identity)
+		return user, syncProviderProfile(collection, user, name, picture)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, errors.New("identity has no email")
+	}
+
+	existingUser, err := FindUserByEmail(collection, identity.Email)
+	if err == nil {
+		if !identity.EmailVerified {
+			return nil, ErrEmailInUse
+		}
+		if err := LinkIdentity(collection, existingUser.ID, identity); err != nil {
+			return nil, err
+		}
+		existingUser.Identities = append(existingUser.Identities, identity)
+		return existingUser, syncProviderProfile(collection, existingUser, name, picture)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if identity.LinkedAt.IsZero() {
+		identity.LinkedAt = time.Now()
+	}
+	if name == "" {
+		name = strings.Split(identity.Email, "@")[0]
+	}
+	newUser := &User{
+		Name:       name,
+		Email:      identity.Email,
+		Picture:    picture,
+		Identities: []Identity{identity},
+	}
+	if err := CreateUser(collection, newUser); err != nil {
+		return nil, err
+	}
+	return newUser, nil
+}
+
+// LinkIdentity attaches an external identity to a user. Linking an identity
+// the user already has is a no-op, and one linked to someone else returns
+// ErrIdentityInUse.
+func LinkIdentity(collection *mongo.Collection, userID bson.ObjectID, identity Identity) error {
+	owner, err := FindUserByIdentity(collection, identity.Provider, identity.Subject)
+	if err == nil {
+		if owner.ID != userID {
+			return ErrIdentityInUse
+		}
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if identity.LinkedAt.IsZero() {
+		identity.LinkedAt = time.Now()
+	}
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$push": bson.M{"identities": identity},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	_, err = collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrIdentityInUse
+		}
+		log.Printf("Error linking identity: %v", err)
+		return err
+	}
+
+	log.Printf("Linked %s identity %s to user %s", identity.Provider, identity.Subject, userID.Hex())
+	return nil
+}
+
+// UnlinkIdentity removes an external identity from a user, as long as it
+// isn't the only one they have
+func UnlinkIdentity(collection *mongo.Collection, userID bson.ObjectID, provider, subject string) error {
+	filter := bson.M{
+		"_id":          userID,
+		"identities.1": bson.M{"$exists": true},
+		"identities":   bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	}
+	update := bson.M{
+		"$pull": bson.M{"identities": bson.M{"provider": provider, "subject": subject}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error unlinking identity: %v", err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		// Work out whether it wasn't linked at all or was the last one
+		user, err := FindUserByIdentity(collection, provider, subject)
+		if err != nil {
+			return err
+		}
+		if user.ID != userID {
+			return mongo.ErrNoDocuments
+		}
+		return ErrLastIdentity
+	}
+
+	log.Printf("Unlinked %s identity %s from user %s", provider, subject, userID.Hex())
+	return nil
+}
+
+// syncProviderProfile copies the name and picture a login provider sent onto
+// the user, skipping fields the user edited and values the provider left
+// empty
+func syncProviderProfile(collection *mongo.Collection, user *User, name, picture string) error {
+	changed := false
+	if name != "" && name != user.Name && !user.HasEdited(ProfileFieldName) {
+		user.Name = name
+		changed = true
+	}
+	if picture != "" && picture != user.Picture && !user.HasEdited(ProfileFieldPicture) {
+		user.Picture = picture
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return UpdateUser(collection, user)
+}
+
+// updateIdentityEmail keeps the stored email of an identity in step with the
+// provider. It doesn't touch the user's own email.
+func updateIdentityEmail(collection *mongo.Collection, userID bson.ObjectID, identity Identity) {
+	filter := bson.M{
+		"_id":        userID,
+		"identities": bson.M{"$elemMatch": bson.M{"provider": identity.Provider, "subject": identity.Subject}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"identities.$.email":          identity.Email,
+			"identities.$.email_verified": identity.EmailVerified,
+		},
+	}
+
+	if _, err := collection.UpdateOne(context.Background(), filter, update); err != nil {
+		log.Printf("Error updating identity email: %v", err)
+	}
+}
+
+func DeleteUser(collection *mongo.Collection, id bson.ObjectID) error {
+	log.Printf("Deleting user %s", id.Hex())
+	_, err := collection.DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting user: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateProvisionedUser saves the fields an identity provider manages over
+// SCIM. Unlike logins it overwrites the name even if the user edited it.
+func UpdateProvisionedUser(collection *mongo.Collection, user *User) error {
+	user.UpdatedAt = time.Now()
+
+	update := bson.M{"$set": bson.M{
+		"name":        user.Name,
+		"email":       user.Email,
+		"external_id": user.ExternalID,
+		"updated_at":  user.UpdatedAt,
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": user.ID}, update)
+	if err != nil {
+		log.Printf("Error updating provisioned user: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetUserDeactivated switches a user off or back on
+func SetUserDeactivated(collection *mongo.Collection, id bson.ObjectID, deactivated bool) error {
+	update := bson.M{
+		"$set": bson.M{"deactivated": true, "deactivated_at": time.Now(), "updated_at": time.Now()},
+	}
+	if !deactivated {
+		update = bson.M{
+			"$unset": bson.M{"deactivated": "", "deactivated_at": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		}
+	}
+
+	log.Printf("Setting user %s deactivated: %v", id.Hex(), deactivated)
+	result, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Printf("Error setting user deactivated: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// IsUserDeactivated checks whether a user was deactivated without loading
+// the whole document. Users that don't exist count as deactivated.
+func IsUserDeactivated(collection *mongo.Collection, id bson.ObjectID) (bool, error) {
+	opts := options.FindOne().SetProjection(bson.M{"deactivated": 1})
+
+	var user User
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		log.Printf("Error checking user status: %v", err)
+		return false, err
+	}
+
+	return user.Deactivated, nil
+}
+
+// ListUsers pages through the users matching filter, oldest first, and
+// counts how many match in total
+func ListUsers(collection *mongo.Collection, filter bson.M, skip, limit int64) ([]User, int64, error) {
+	ctx := context.Background()
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("Error counting users: %v", err)
+		return nil, 0, err
+	}
+
+	users := []User{}
+	if limit == 0 {
+		return users, total, nil
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &users); err != nil {
+		log.Printf("Error decoding users: %v", err)
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// GetUserBots lists the bots a user owns
+func GetUserBots(collection *mongo.Collection, ownerID string) ([]User, error) {
+	filter := bson.M{"is_bot": true, "bot_owner_id": ownerID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding bots: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	bots := []User{}
+	if err = cursor.All(context.Background(), &bots); err != nil {
+		log.Printf("Error decoding bots: %v", err)
+		return nil, err
+	}
+
+	return bots, nil
+}
+
+// FindUserBot finds one of a user's bots
+func FindUserBot(collection *mongo.Collection, id bson.ObjectID, ownerID string) (*User, error) {
+	var bot User
+	filter := bson.M{"_id": id, "is_bot": true, "bot_owner_id": ownerID}
+
+	err := collection.FindOne(context.Background(), filter).Decode(&bot)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding bot: %v", err)
+		}
+		return nil, err
+	}
+
+	return &bot, nil
+}
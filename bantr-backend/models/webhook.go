@@ -0,0 +1,303 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// maxDeliveryAttemptsLogged caps how many attempts a delivery keeps in its log
+const maxDeliveryAttemptsLogged = 20
+
+// Webhook sends meeting events to a URL. Personal webhooks get events for
+// meetings the user hosts, workspace webhooks for the workspace's meetings.
+type Webhook struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      string        `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	WorkspaceID string        `bson:"workspace_id,omitempty" json:"workspace_id,omitempty"`
+	URL         string        `bson:"url" json:"url"`
+	// Secret signs every payload. It's only shown when the webhook is created.
+	Secret    string    `bson:"secret" json:"-"`
+	Events    []string  `bson:"events" json:"events"`
+	Active    bool      `bson:"active" json:"active"`
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// DeliveryAttempt is one try at sending a delivery
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMs int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// WebhookDelivery is one event on its way to one webhook, along with the log
+// of every attempt to send it
+type WebhookDelivery struct {
+	ID            bson.ObjectID     `bson:"_id,omitempty" json:"id"`
+	WebhookID     bson.ObjectID     `bson:"webhook_id" json:"webhook_id"`
+	EventID       string            `bson:"event_id" json:"event_id"`
+	EventType     string            `bson:"event_type" json:"event_type"`
+	Payload       string            `bson:"payload" json:"payload"`
+	Status        string            `bson:"status" json:"status"`
+	AttemptCount  int               `bson:"attempt_count" json:"attempt_count"`
+	Attempts      []DeliveryAttempt `bson:"attempts,omitempty" json:"attempts"`
+	NextAttemptAt time.Time         `bson:"next_attempt_at" json:"next_attempt_at"`
+	// RedeliveryOf points at the delivery this one was manually resent from
+	RedeliveryOf *bson.ObjectID `bson:"redelivery_of,omitempty" json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time      `bson:"created_at" json:"created_at"`
+	DeliveredAt  *time.Time     `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureWebhookIndexes indexes webhooks by owner and lets the delivery log
+// expire after deliveryLogTTL
+func EnsureWebhookIndexes(webhooks, deliveries *mongo.Collection, deliveryLogTTL time.Duration) error {
+	ctx := context.Background()
+
+	_, err := webhooks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating webhook indexes: %v", err)
+		return err
+	}
+
+	_, err = deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(deliveryLogTTL.Seconds())),
+		},
+	})
+	if err != nil {
+		log.Printf("Error creating webhook delivery indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateWebhook(collection *mongo.Collection, webhook *Webhook) error {
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = time.Now()
+
+	result, err := collection.InsertOne(context.Background(), webhook)
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		webhook.ID = oid
+	}
+
+	log.Printf("Created webhook %s for %s", webhook.ID.Hex(), webhook.URL)
+	return nil
+}
+
+func FindWebhookByID(collection *mongo.Collection, id bson.ObjectID) (*Webhook, error) {
+	var webhook Webhook
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&webhook)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding webhook: %v", err)
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// GetUserWebhooks lists a user's personal webhooks
+func GetUserWebhooks(collection *mongo.Collection, userID string) ([]Webhook, error) {
+	return findWebhooks(collection, bson.M{"user_id": userID})
+}
+
+func GetWorkspaceWebhooks(collection *mongo.Collection, workspaceID string) ([]Webhook, error) {
+	return findWebhooks(collection, bson.M{"workspace_id": workspaceID})
+}
+
+// GetMeetingWebhooks finds the active webhooks that want an event for a
+// meeting: its host's and its workspace's
+func GetMeetingWebhooks(collection *mongo.Collection, meeting *Meeting, eventType string) ([]Webhook, error) {
+	owners := bson.A{bson.M{"user_id": meeting.CreatedBy}}
+	if meeting.WorkspaceID != "" {
+		owners = append(owners, bson.M{"workspace_id": meeting.WorkspaceID})
+	}
+
+	return findWebhooks(collection, bson.M{
+		"$or":    owners,
+		"active": true,
+		"events": eventType,
+	})
+}
+
+func findWebhooks(collection *mongo.Collection, filter bson.M) ([]Webhook, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding webhooks: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	webhooks := []Webhook{}
+	if err = cursor.All(context.Background(), &webhooks); err != nil {
+		log.Printf("Error decoding webhooks: %v", err)
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func UpdateWebhook(collection *mongo.Collection, webhook *Webhook) error {
+	webhook.UpdatedAt = time.Now()
+
+	update := bson.M{"$set": bson.M{
+		"url":        webhook.URL,
+		"events":     webhook.Events,
+		"active":     webhook.Active,
+		"updated_at": webhook.UpdatedAt,
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": webhook.ID}, update)
+	if err != nil {
+		log.Printf("Error updating webhook: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteWebhooks removes the webhooks matching filter along with their
+// delivery logs
+func DeleteWebhooks(webhooks, deliveries *mongo.Collection, filter bson.M) error {
+	ctx := context.Background()
+
+	matched, err := findWebhooks(webhooks, filter)
+	if err != nil {
+		return err
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	ids := make([]bson.ObjectID, 0, len(matched))
+	for _, webhook := range matched {
+		ids = append(ids, webhook.ID)
+	}
+
+	if _, err := deliveries.DeleteMany(ctx, bson.M{"webhook_id": bson.M{"$in": ids}}); err != nil {
+		log.Printf("Error deleting webhook deliveries: %v", err)
+		return err
+	}
+	if _, err := webhooks.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		log.Printf("Error deleting webhooks: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateWebhookDelivery(collection *mongo.Collection, delivery *WebhookDelivery) error {
+	delivery.CreatedAt = time.Now()
+	delivery.Status = DeliveryStatusPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = delivery.CreatedAt
+	}
+
+	result, err := collection.InsertOne(context.Background(), delivery)
+	if err != nil {
+		log.Printf("Error creating webhook delivery: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		delivery.ID = oid
+	}
+
+	return nil
+}
+
+func FindWebhookDelivery(collection *mongo.Collection, webhookID, id bson.ObjectID) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := collection.FindOne(context.Background(), bson.M{"_id": id, "webhook_id": webhookID}).Decode(&delivery)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding webhook delivery: %v", err)
+		}
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// GetWebhookDeliveries lists a webhook's most recent deliveries, newest first
+func GetWebhookDeliveries(collection *mongo.Collection, webhookID bson.ObjectID, limit int64) ([]WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(context.Background(), bson.M{"webhook_id": webhookID}, opts)
+	if err != nil {
+		log.Printf("Error finding webhook deliveries: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	deliveries := []WebhookDelivery{}
+	if err = cursor.All(context.Background(), &deliveries); err != nil {
+		log.Printf("Error decoding webhook deliveries: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordDeliveryAttempt logs an attempt and moves the delivery on. status is
+// the new status, and nextAttemptAt only matters while it's still pending.
+func RecordDeliveryAttempt(collection *mongo.Collection, id bson.ObjectID, attempt DeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	set := bson.M{"status": status, "next_attempt_at": nextAttemptAt}
+	if status == DeliveryStatusSucceeded {
+		set["delivered_at"] = attempt.At
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"attempt_count": 1},
+		"$push": bson.M{"attempts": bson.M{
+			"$each":  bson.A{attempt},
+			"$slice": -maxDeliveryAttemptsLogged,
+		}},
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Printf("Error recording webhook delivery attempt: %v", err)
+		return err
+	}
+
+	return nil
+}
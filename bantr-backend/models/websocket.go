@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 type MessageType string
@@ -18,8 +20,41 @@ const (
 	MessageTypeAnswer       MessageType = "answer"
 	MessageTypeIceCandidate MessageType = "ice-candidate"
 	MessageTypeError        MessageType = "error"
+
+	MessageTypeStartRecording MessageType = "start-recording"
+	MessageTypeStopRecording  MessageType = "stop-recording"
+	MessageTypeRecordingState MessageType = "recording-state"
+
+	MessageTypeSetPreferredLayer MessageType = "set-preferred-layer"
+
+	MessageTypeAudioLevel    MessageType = "audio-level"
+	MessageTypeActiveSpeaker MessageType = "active-speaker"
+
+	MessageTypeE2EEKey   MessageType = "e2ee-key"
+	MessageTypeE2EEEpoch MessageType = "e2ee-epoch"
+
+	MessageTypeRoomState      MessageType = "room-state"
+	MessageTypeProfileUpdated MessageType = "profile-updated"
+	MessageTypeRoleChanged    MessageType = "role-changed"
+
+	MessageTypeSubscribeNotifications  MessageType = "subscribe-notifications"
+	MessageTypeNotificationsSubscribed MessageType = "notifications-subscribed"
+	MessageTypeNotification            MessageType = "notification"
+	MessageTypeNotificationsRead       MessageType = "notifications-read"
 )
 
+// Simulcast layer preferences a subscriber can ask for besides a specific RID
+const (
+	LayerAuto   = "auto"
+	LayerLow    = "low"
+	LayerMedium = "medium"
+	LayerHigh   = "high"
+)
+
+// ServerTarget is the target used for signaling messages addressed to the
+// backend itself rather than to another participant (SFU mode)
+const ServerTarget = "server"
+
 type WebSocketMessage struct {
 	Type    MessageType     `json:"type"`
 	RoomID  string          `json:"room_id,omitempty"`
@@ -28,26 +63,90 @@ type WebSocketMessage struct {
 	Error   string          `json:"error,omitempty"`
 }
 
+// JoinRoomData is sent to enter a room. Token is either an access token or a
+// guest token for this room, and the user ID comes from it rather than from
+// UserID.
 type JoinRoomData struct {
-	RoomID string `json:"room_id"`
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
+	RoomID        string `json:"room_id"`
+	UserID        string `json:"user_id"`
+	Name          string `json:"name"`
+	Token         string `json:"token"`
+	E2EESupported bool   `json:"e2ee_supported"`
 }
 
 type UserJoinedData struct {
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	IsGuest bool   `json:"is_guest"`
+	IsBot   bool   `json:"is_bot"`
 }
 
 type UserLeftData struct {
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	IsGuest bool   `json:"is_guest"`
+	IsBot   bool   `json:"is_bot"`
+}
+
+// RoomStateData is sent to a client right after it joins so it knows who is
+// already there
+type RoomStateData struct {
+	Participants []ParticipantState `json:"participants"`
+	MediaMode    string             `json:"media_mode"`
+	KeyEpoch     uint64             `json:"key_epoch"`
+}
+
+type ProfileUpdatedData struct {
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+// RoleChangedData is broadcast when a participant is promoted or demoted
+type RoleChangedData struct {
+	UserID      string   `json:"user_id"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	ChangedBy   string   `json:"changed_by"`
+}
+
+// SubscribeNotificationsData starts a connection's notification feed.
+// Token is an access token, and the connection doesn't have to be in a room.
+type SubscribeNotificationsData struct {
+	Token string `json:"token"`
+}
+
+type NotificationsSubscribedData struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+type NotificationData struct {
+	Notification *Notification `json:"notification"`
+	UnreadCount  int64         `json:"unread_count"`
+}
+
+// NotificationsReadData tells a user's other tabs that notifications were
+// read. All is set when everything was marked read at once.
+type NotificationsReadData struct {
+	IDs         []string `json:"ids,omitempty"`
+	All         bool     `json:"all,omitempty"`
+	UnreadCount int64    `json:"unread_count"`
+}
+
+type ParticipantState struct {
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	IsGuest bool   `json:"is_guest"`
+	IsBot   bool   `json:"is_bot"`
 }
 
 type RTCOfferData struct {
 	SDP    string `json:"sdp"`
 	Type   string `json:"type"`
 	Target string `json:"target"` // Target user ID
+	// ScreenStreamIDs lists the offered streams that carry a screen share so
+	// the SFU can prioritize them
+	ScreenStreamIDs []string `json:"screen_stream_ids,omitempty"`
 }
 
 type RTCAnswerData struct {
@@ -63,19 +162,78 @@ type RTCIceCandidateData struct {
 	Target        string `json:"target"` // Target user ID
 }
 
+type RecordingStateData struct {
+	Recording bool       `json:"recording"`
+	StartedBy string     `json:"started_by,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// SetPreferredLayerData caps the simulcast layer a subscriber receives from a
+// publisher. Layer is a RID, one of the Layer* constants, or "auto".
+type SetPreferredLayerData struct {
+	PublisherID string `json:"publisher_id"`
+	TrackID     string `json:"track_id,omitempty"`
+	Layer       string `json:"layer"`
+}
+
+// AudioLevelData is a mesh client's own microphone level, from 0 (silent)
+// to 1 (loudest), as reported by the browser's audioLevel statistic
+type AudioLevelData struct {
+	Level float64 `json:"level"`
+}
+
+type ActiveSpeakerData struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+// E2EEKeyData carries a key-distribution message for insertable-streams
+// encryption. Key is encrypted by the sender for Target and is relayed as-is.
+type E2EEKeyData struct {
+	Target string `json:"target"` // Target user ID
+	Epoch  uint64 `json:"epoch"`
+	Key    string `json:"key"`
+}
+
+// E2EEEpochData announces a new key epoch. Clients rotate their media keys
+// whenever someone joins or leaves so departed participants can't decrypt
+// and new ones can't read what came before.
+type E2EEEpochData struct {
+	Epoch  uint64 `json:"epoch"`
+	Reason string `json:"reason"`
+	UserID string `json:"user_id"`
+}
+
 type Client struct {
-	ID     string
-	UserID string
-	Name   string
-	RoomID string
-	Conn   *websocket.Conn
-	Send   chan []byte
+	ID      string
+	UserID  string
+	Name    string
+	RoomID  string
+	IsGuest bool
+	// IsBot is set for bot accounts so everyone else can see it's not a person
+	IsBot bool
+	// SessionID is the login session of the token the client joined with,
+	// so revoking the session can close the connection
+	SessionID string
+	// APIKeyID is set instead of SessionID for clients that joined with an
+	// API key
+	APIKeyID string
+	// NotificationUserID is the user whose notifications the connection
+	// subscribed to, if any
+	NotificationUserID string
+	// AttendanceID is the attendance entry closed when the client leaves
+	AttendanceID bson.ObjectID
+	Conn         *websocket.Conn
+	Send         chan []byte
 }
 
 type Room struct {
-	ID      string
-	Clients map[string]*Client
-	mutex   sync.RWMutex
+	ID        string
+	MediaMode string
+	Clients   map[string]*Client
+	// KeyEpoch bumps on every join and leave so E2EE clients know to rotate
+	KeyEpoch uint64
+	mutex    sync.RWMutex
 }
 
 func NewRoom(id string) *Room {
@@ -95,8 +253,10 @@ func (r *Room) AddClient(client *Client) {
 	log.Printf("Client %s (%s) joined room %s", client.UserID, client.Name, r.ID)
 	
 	userJoinedData := UserJoinedData{
-		UserID: client.UserID,
-		Name:   client.Name,
+		UserID:  client.UserID,
+		Name:    client.Name,
+		IsGuest: client.IsGuest,
+		IsBot:   client.IsBot,
 	}
 	
 	message := WebSocketMessage{
@@ -109,6 +269,8 @@ func (r *Room) AddClient(client *Client) {
 		message.Data = data
 		r.broadcastToOthers(client.ID, message)
 	}
+	
+	r.bumpKeyEpoch("join", client.UserID)
 }
 
 func (r *Room) RemoveClient(clientID string) {
@@ -121,8 +283,10 @@ func (r *Room) RemoveClient(clientID string) {
 		log.Printf("Client %s (%s) left room %s", client.UserID, client.Name, r.ID)
 		
 		userLeftData := UserLeftData{
-			UserID: client.UserID,
-			Name:   client.Name,
+			UserID:  client.UserID,
+			Name:    client.Name,
+			IsGuest: client.IsGuest,
+			IsBot:   client.IsBot,
 		}
 		
 		message := WebSocketMessage{
@@ -135,6 +299,52 @@ func (r *Room) RemoveClient(clientID string) {
 			message.Data = data
 			r.broadcastToOthers(clientID, message)
 		}
+		
+		r.bumpKeyEpoch("leave", client.UserID)
+	}
+}
+
+// bumpKeyEpoch starts a new E2EE key epoch and announces it to everyone in
+// the room. Callers must hold the room mutex.
+func (r *Room) bumpKeyEpoch(reason, userID string) {
+	r.KeyEpoch++
+	
+	epochData := E2EEEpochData{
+		Epoch:  r.KeyEpoch,
+		Reason: reason,
+		UserID: userID,
+	}
+	
+	message := WebSocketMessage{
+		Type:   MessageTypeE2EEEpoch,
+		RoomID: r.ID,
+	}
+	
+	if data, err := json.Marshal(epochData); err == nil {
+		message.Data = data
+		r.broadcastToOthers("", message)
+	}
+}
+
+// State describes the room as seen by someone who just joined
+func (r *Room) State() RoomStateData {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	participants := make([]ParticipantState, 0, len(r.Clients))
+	for _, client := range r.Clients {
+		participants = append(participants, ParticipantState{
+			UserID:  client.UserID,
+			Name:    client.Name,
+			IsGuest: client.IsGuest,
+			IsBot:   client.IsBot,
+		})
+	}
+	
+	return RoomStateData{
+		Participants: participants,
+		MediaMode:    r.MediaMode,
+		KeyEpoch:     r.KeyEpoch,
 	}
 }
 
@@ -164,10 +374,9 @@ func (r *Room) BroadcastMessage(message WebSocketMessage) {
 	}
 }
 
+// broadcastToOthers sends a message to everyone but excludeClientID. Callers
+// must hold the room mutex for writing.
 func (r *Room) broadcastToOthers(excludeClientID string, message WebSocketMessage) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-	
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
@@ -0,0 +1,460 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Workspace member roles. Owners can do everything admins can, plus manage
+// other owners.
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleAdmin  = "admin"
+	WorkspaceRoleMember = "member"
+)
+
+var (
+	ErrAlreadyMember = errors.New("user is already a member of this workspace")
+	ErrDomainClaimed = errors.New("domain belongs to another workspace")
+	ErrLastOwner     = errors.New("workspace must keep at least one owner")
+)
+
+// Workspace groups users and the meetings they share. Users signing in with
+// a Google Workspace account on one of Domains join automatically.
+type Workspace struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string        `bson:"name" json:"name"`
+	Domains   []string      `bson:"domains" json:"domains"`
+	CreatedBy string        `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+	// ExternalID is the group's ID in the identity provider, for workspaces
+	// provisioned over SCIM
+	ExternalID string `bson:"external_id,omitempty" json:"external_id,omitempty"`
+	// DomainVerificationToken goes in a DNS TXT record to prove the
+	// workspace controls a domain before claiming it
+	DomainVerificationToken string `bson:"domain_verification_token,omitempty" json:"-"`
+	// SCIMTokenHash is the hash of the token the workspace's identity
+	// provider signs in to SCIM with
+	SCIMTokenHash string `bson:"scim_token_hash,omitempty" json:"-"`
+}
+
+type WorkspaceMember struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	WorkspaceID bson.ObjectID `bson:"workspace_id" json:"workspace_id"`
+	UserID      string        `bson:"user_id" json:"user_id"`
+	Role        string        `bson:"role" json:"role"`
+	JoinedAt    time.Time     `bson:"joined_at" json:"joined_at"`
+}
+
+func IsValidWorkspaceRole(role string) bool {
+	return role == WorkspaceRoleOwner || role == WorkspaceRoleAdmin || role == WorkspaceRoleMember
+}
+
+// IsWorkspaceAdmin reports whether a role can manage the workspace and
+// moderate its meetings
+func IsWorkspaceAdmin(role string) bool {
+	return role == WorkspaceRoleOwner || role == WorkspaceRoleAdmin
+}
+
+// EnsureWorkspaceIndexes makes each domain belong to one workspace at most
+// and each user a member of a workspace only once
+func EnsureWorkspaceIndexes(workspaces, members *mongo.Collection) error {
+	ctx := context.Background()
+
+	_, err := workspaces.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "domains", Value: 1}},
+			// Workspaces without domains would all collide on the empty array
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"domains.0": bson.M{"$exists": true}}),
+		},
+		{
+			Keys:    bson.D{{Key: "scim_token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"scim_token_hash": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		log.Printf("Error creating workspace indexes: %v", err)
+		return err
+	}
+
+	_, err = members.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating workspace member indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateWorkspace(collection *mongo.Collection, workspace *Workspace) error {
+	workspace.CreatedAt = time.Now()
+	workspace.UpdatedAt = time.Now()
+	if workspace.Domains == nil {
+		workspace.Domains = []string{}
+	}
+
+	log.Printf("Creating workspace: %s by %s", workspace.Name, workspace.CreatedBy)
+	result, err := collection.InsertOne(context.Background(), workspace)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDomainClaimed
+		}
+		log.Printf("Error creating workspace: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		workspace.ID = oid
+	}
+
+	return nil
+}
+
+func FindWorkspaceByID(collection *mongo.Collection, id bson.ObjectID) (*Workspace, error) {
+	var workspace Workspace
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&workspace)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding workspace: %v", err)
+		}
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// FindWorkspaceByDomain finds the workspace that claimed an email domain
+func FindWorkspaceByDomain(collection *mongo.Collection, domain string) (*Workspace, error) {
+	var workspace Workspace
+	err := collection.FindOne(context.Background(), bson.M{"domains": domain}).Decode(&workspace)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding workspace by domain: %v", err)
+		}
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// FindWorkspaceBySCIMToken finds the workspace a SCIM token was issued for
+func FindWorkspaceBySCIMToken(collection *mongo.Collection, tokenHash string) (*Workspace, error) {
+	var workspace Workspace
+	err := collection.FindOne(context.Background(), bson.M{"scim_token_hash": tokenHash}).Decode(&workspace)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding workspace by SCIM token: %v", err)
+		}
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+func FindWorkspacesByIDs(collection *mongo.Collection, ids []bson.ObjectID) ([]Workspace, error) {
+	cursor, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Printf("Error finding workspaces: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	workspaces := []Workspace{}
+	if err = cursor.All(context.Background(), &workspaces); err != nil {
+		log.Printf("Error decoding workspaces: %v", err)
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// ListWorkspaces pages through the workspaces matching filter, oldest first,
+// and counts how many match in total
+func ListWorkspaces(collection *mongo.Collection, filter bson.M, skip, limit int64) ([]Workspace, int64, error) {
+	ctx := context.Background()
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("Error counting workspaces: %v", err)
+		return nil, 0, err
+	}
+
+	workspaces := []Workspace{}
+	if limit == 0 {
+		return workspaces, total, nil
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error listing workspaces: %v", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &workspaces); err != nil {
+		log.Printf("Error decoding workspaces: %v", err)
+		return nil, 0, err
+	}
+
+	return workspaces, total, nil
+}
+
+func UpdateWorkspace(collection *mongo.Collection, workspace *Workspace) error {
+	workspace.UpdatedAt = time.Now()
+
+	update := bson.M{"$set": bson.M{
+		"name":        workspace.Name,
+		"domains":     workspace.Domains,
+		"external_id": workspace.ExternalID,
+		"updated_at":  workspace.UpdatedAt,
+	}}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": workspace.ID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDomainClaimed
+		}
+		log.Printf("Error updating workspace: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetWorkspaceVerificationToken gives a workspace its domain verification
+// token unless it already has one, and returns the token it ends up with
+func SetWorkspaceVerificationToken(collection *mongo.Collection, id bson.ObjectID, token string) (string, error) {
+	filter := bson.M{"_id": id, "domain_verification_token": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"domain_verification_token": token}}
+
+	if _, err := collection.UpdateOne(context.Background(), filter, update); err != nil {
+		log.Printf("Error setting workspace verification token: %v", err)
+		return "", err
+	}
+
+	workspace, err := FindWorkspaceByID(collection, id)
+	if err != nil {
+		return "", err
+	}
+	return workspace.DomainVerificationToken, nil
+}
+
+// SetWorkspaceSCIMToken replaces a workspace's SCIM token. An empty hash
+// turns SCIM off for the workspace.
+func SetWorkspaceSCIMToken(collection *mongo.Collection, id bson.ObjectID, tokenHash string) error {
+	update := bson.M{"$set": bson.M{"scim_token_hash": tokenHash}}
+	if tokenHash == "" {
+		update = bson.M{"$unset": bson.M{"scim_token_hash": ""}}
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Printf("Error setting workspace SCIM token: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteWorkspace removes a workspace and its memberships. Its meetings are
+// kept and go back to being owned by their creators alone.
+func DeleteWorkspace(workspaces, members, meetings *mongo.Collection, id bson.ObjectID) error {
+	ctx := context.Background()
+
+	log.Printf("Deleting workspace %s", id.Hex())
+	if _, err := members.DeleteMany(ctx, bson.M{"workspace_id": id}); err != nil {
+		log.Printf("Error deleting workspace members: %v", err)
+		return err
+	}
+
+	update := bson.M{"$unset": bson.M{"workspace_id": ""}}
+	if _, err := meetings.UpdateMany(ctx, bson.M{"workspace_id": id.Hex()}, update); err != nil {
+		log.Printf("Error detaching workspace meetings: %v", err)
+		return err
+	}
+
+	if _, err := workspaces.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		log.Printf("Error deleting workspace: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func AddWorkspaceMember(collection *mongo.Collection, member *WorkspaceMember) error {
+	member.JoinedAt = time.Now()
+
+	result, err := collection.InsertOne(context.Background(), member)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyMember
+		}
+		log.Printf("Error adding workspace member: %v", err)
+		return err
+	}
+
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		member.ID = oid
+	}
+
+	log.Printf("Added %s to workspace %s as %s", member.UserID, member.WorkspaceID.Hex(), member.Role)
+	return nil
+}
+
+func FindWorkspaceMember(collection *mongo.Collection, workspaceID bson.ObjectID, userID string) (*WorkspaceMember, error) {
+	filter := bson.M{"workspace_id": workspaceID, "user_id": userID}
+
+	var member WorkspaceMember
+	err := collection.FindOne(context.Background(), filter).Decode(&member)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error finding workspace member: %v", err)
+		}
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func GetWorkspaceMembers(collection *mongo.Collection, workspaceID bson.ObjectID) ([]WorkspaceMember, error) {
+	filter := bson.M{"workspace_id": workspaceID}
+	opts := options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}})
+
+	return findWorkspaceMembers(collection, filter, opts)
+}
+
+// GetUserMemberships lists every workspace a user belongs to
+func GetUserMemberships(collection *mongo.Collection, userID string) ([]WorkspaceMember, error) {
+	return findWorkspaceMembers(collection, bson.M{"user_id": userID}, options.Find())
+}
+
+func findWorkspaceMembers(collection *mongo.Collection, filter bson.M, opts *options.FindOptionsBuilder) ([]WorkspaceMember, error) {
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Error finding workspace members: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	members := []WorkspaceMember{}
+	if err = cursor.All(context.Background(), &members); err != nil {
+		log.Printf("Error decoding workspace members: %v", err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// UpdateWorkspaceMemberRole changes a member's role. Demoting the last owner
+// fails with ErrLastOwner.
+func UpdateWorkspaceMemberRole(collection *mongo.Collection, workspaceID bson.ObjectID, userID, role string) error {
+	if role != WorkspaceRoleOwner {
+		if err := checkNotLastOwner(collection, workspaceID, userID); err != nil {
+			return err
+		}
+	}
+
+	filter := bson.M{"workspace_id": workspaceID, "user_id": userID}
+	update := bson.M{"$set": bson.M{"role": role}}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Printf("Error updating workspace member role: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RemoveWorkspaceMember takes a user out of a workspace. Removing the last
+// owner fails with ErrLastOwner.
+func RemoveWorkspaceMember(collection *mongo.Collection, workspaceID bson.ObjectID, userID string) error {
+	if err := checkNotLastOwner(collection, workspaceID, userID); err != nil {
+		return err
+	}
+
+	filter := bson.M{"workspace_id": workspaceID, "user_id": userID}
+	result, err := collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error removing workspace member: %v", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	log.Printf("Removed %s from workspace %s", userID, workspaceID.Hex())
+	return nil
+}
+
+// RemoveUserMemberships takes a user out of every workspace, for when their
+// account goes away
+// SoleOwnedWorkspaces returns the workspaces the user is the only owner of,
+// which would be left without one if the user went away
+func SoleOwnedWorkspaces(collection *mongo.Collection, userID string) ([]bson.ObjectID, error) {
+	owned, err := findWorkspaceMembers(collection, bson.M{"user_id": userID, "role": WorkspaceRoleOwner}, options.Find())
+	if err != nil {
+		return nil, err
+	}
+
+	workspaceIDs := []bson.ObjectID{}
+	for _, member := range owned {
+		if err := checkNotLastOwner(collection, member.WorkspaceID, userID); err == ErrLastOwner {
+			workspaceIDs = append(workspaceIDs, member.WorkspaceID)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return workspaceIDs, nil
+}
+
+// RemoveUserMemberships takes a user out of every workspace. Callers check
+// SoleOwnedWorkspaces first, since this skips the last owner check.
+func RemoveUserMemberships(collection *mongo.Collection, userID string) error {
+	_, err := collection.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error removing workspace memberships: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func checkNotLastOwner(collection *mongo.Collection, workspaceID bson.ObjectID, userID string) error {
+	member, err := FindWorkspaceMember(collection, workspaceID, userID)
+	if err != nil || member.Role != WorkspaceRoleOwner {
+		return err
+	}
+
+	owners, err := collection.CountDocuments(context.Background(), bson.M{
+		"workspace_id": workspaceID,
+		"role":         WorkspaceRoleOwner,
+	})
+	if err != nil {
+		log.Printf("Error counting workspace owners: %v", err)
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
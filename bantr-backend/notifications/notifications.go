@@ -0,0 +1,168 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+)
+
+// TTL is how long notifications are kept, read or not
+const TTL = 90 * 24 * time.Hour
+
+const timeFormat = "Mon, 2 Jan 2006 15:04 MST"
+
+var hub *websocket.Hub
+
+// Setup has notifications pushed to users through the hub and starts
+// notifying people about meetings starting
+func Setup(h *websocket.Hub) {
+	hub = h
+	models.SubscribeEvents(func(event models.Event) {
+		if event.Type == models.EventMeetingStarted {
+			meetingStarted(event)
+		}
+	})
+}
+
+// Send saves a notification and pushes it to every connection the user has
+// subscribed, so it shows up without a refresh
+func Send(notification *models.Notification) error {
+	collection := utils.GetNotificationsCollection()
+	if err := models.CreateNotification(collection, notification); err != nil {
+		return err
+	}
+
+	if hub != nil {
+		unread, _ := models.CountUnreadNotifications(collection, notification.UserID)
+		hub.SendToUser(notification.UserID, models.MessageTypeNotification, models.NotificationData{
+			Notification: notification,
+			UnreadCount:  unread,
+		})
+	}
+	return nil
+}
+
+// Read lets a user's other tabs know notifications were read, so their
+// badges stay in step
+func Read(userID string, ids []string, all bool) {
+	if hub == nil {
+		return
+	}
+
+	unread, _ := models.CountUnreadNotifications(utils.GetNotificationsCollection(), userID)
+	hub.SendToUser(userID, models.MessageTypeNotificationsRead, models.NotificationsReadData{
+		IDs:         ids,
+		All:         all,
+		UnreadCount: unread,
+	})
+}
+
+// MeetingInvitations notifies the people invited to a meeting who have an
+// account. update is set when they were invited before and the meeting was
+// rescheduled.
+func MeetingInvitations(meeting *models.Meeting, emails []string, inviterID, inviterName string, update bool) {
+	notificationType := models.NotificationMeetingInvite
+	title := fmt.Sprintf("%s invited you to %s", inviterName, meeting.Title)
+	if update {
+		notificationType = models.NotificationMeetingRescheduled
+		title = meeting.Title + " was rescheduled"
+	}
+
+	body := ""
+	if meeting.Schedule != nil {
+		body = "Starts " + meeting.Schedule.StartsAt.UTC().Format(timeFormat)
+	}
+
+	for _, email := range emails {
+		user, err := models.FindUserByEmail(utils.GetUsersCollection(), email)
+		if err != nil || user.Deactivated || user.ID.Hex() == inviterID {
+			continue
+		}
+
+		err = Send(&models.Notification{
+			UserID: user.ID.Hex(),
+			Type:   notificationType,
+			Title:  title,
+			Body:   body,
+			RoomID: meeting.RoomID,
+			URL:    utils.MeetingURL(meeting.RoomID),
+		})
+		if err != nil {
+			log.Printf("Error notifying %s about meeting %s: %v", user.ID.Hex(), meeting.RoomID, err)
+		}
+	}
+}
+
+// RoleChanged tells someone they were promoted or demoted in a meeting
+func RoleChanged(meeting *models.Meeting, userID, role, changedByName string) {
+	title := fmt.Sprintf("You're now a %s in %s", role, meeting.Title)
+	if role == models.MeetingRoleAttendee {
+		title = fmt.Sprintf("You're back to being an attendee in %s", meeting.Title)
+	}
+
+	err := Send(&models.Notification{
+		UserID: userID,
+		Type:   models.NotificationRoleChanged,
+		Title:  title,
+		Body:   "Changed by " + changedByName,
+		RoomID: meeting.RoomID,
+		URL:    utils.MeetingURL(meeting.RoomID),
+	})
+	if err != nil {
+		log.Printf("Error notifying %s about their role in %s: %v", userID, meeting.RoomID, err)
+	}
+}
+
+// meetingStarted tells the host when someone else starts their meeting, and
+// everyone invited who hasn't declined that they can join
+func meetingStarted(event models.Event) {
+	meeting, err := models.FindMeetingByRoomID(utils.GetMeetingsCollection(), event.RoomID)
+	if err != nil || !meeting.IsActive {
+		return
+	}
+
+	starterID, starterName := "", "Someone"
+	if event.Participant != nil {
+		starterID, starterName = event.Participant.UserID, event.Participant.Name
+	}
+
+	recipients := []string{}
+	if starterID != meeting.CreatedBy {
+		recipients = append(recipients, meeting.CreatedBy)
+	}
+	for _, invitation := range meeting.Invitations {
+		if invitation.RSVP == models.RSVPDeclined {
+			continue
+		}
+		user, err := models.FindUserByEmail(utils.GetUsersCollection(), invitation.Email)
+		if err != nil || user.Deactivated {
+			continue
+		}
+		if id := user.ID.Hex(); id != starterID && id != meeting.CreatedBy {
+			recipients = append(recipients, id)
+		}
+	}
+
+	for _, userID := range recipients {
+		title := meeting.Title + " has started"
+		if userID == meeting.CreatedBy {
+			title = "Your meeting " + meeting.Title + " has started"
+		}
+
+		err := Send(&models.Notification{
+			UserID: userID,
+			Type:   models.NotificationMeetingStarted,
+			Title:  title,
+			Body:   starterName + " is in the meeting",
+			RoomID: meeting.RoomID,
+			URL:    utils.MeetingURL(meeting.RoomID),
+		})
+		if err != nil {
+			log.Printf("Error notifying %s that %s started: %v", userID, meeting.RoomID, err)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/storage"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// dataExportTTL is how long a finished export can be downloaded
+const dataExportTTL = 7 * 24 * time.Hour
+
+// deleteAccount erases the current user. Records other people still need,
+// like meetings they hosted and attendance lists, are kept with the user's
+// ID and name replaced. Everything else is deleted.
+func deleteAccount(c *gin.Context, hub *websocket.Hub) {
+	var req struct {
+		Confirm bool `json:"confirm"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !req.Confirm {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set confirm to true to delete your account"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	bots, err := models.GetUserBots(utils.GetUsersCollection(), user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	err = eraseUser(c.Request.Context(), user)
+	if err == models.ErrLastOwner {
+		c.JSON(http.StatusConflict, gin.H{"error": "Make someone else an owner of your workspaces, or delete them, before deleting your account"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting account %s: %v", user.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// Tokens without a session aren't covered by revoking the sessions
+	_, tokenID, expiresAt := middleware.GetSessionFromContext(c)
+	if tokenID != "" {
+		models.RevokeTokenID(utils.GetRevokedTokensCollection(), tokenID, expiresAt)
+	}
+
+	hub.DisconnectUser(user.ID.Hex())
+	for _, bot := range bots {
+		hub.DisconnectUser(bot.ID.Hex())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// eraseUser removes a user's data everywhere, their bots included. The user
+// document goes last so a failed attempt can simply be retried. It fails
+// with ErrLastOwner before touching anything if a workspace would be left
+// without an owner.
+func eraseUser(ctx context.Context, user *models.User) error {
+	userID := user.ID.Hex()
+
+	soleOwned, err := models.SoleOwnedWorkspaces(utils.GetWorkspaceMembersCollection(), userID)
+	if err != nil {
+		return err
+	}
+	if len(soleOwned) > 0 {
+		return models.ErrLastOwner
+	}
+
+	bots, err := models.GetUserBots(utils.GetUsersCollection(), userID)
+	if err != nil {
+		return err
+	}
+	for i := range bots {
+		if err := eraseUser(ctx, &bots[i]); err != nil {
+			return err
+		}
+	}
+	if err := models.DeleteUserAPIKeys(utils.GetAPIKeysCollection(), userID); err != nil {
+		return err
+	}
+	if err := utils.DeleteUserWebhooks(userID); err != nil {
+		return err
+	}
+	if err := models.DeleteUserChatLinks(utils.GetChatLinksCollection(), userID); err != nil {
+		return err
+	}
+	if err := models.DeleteUserNotifications(utils.GetNotificationsCollection(), userID); err != nil {
+		return err
+	}
+
+	if err := utils.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+	if err := models.DeleteUserSessions(utils.GetSessionsCollection(), userID); err != nil {
+		return err
+	}
+
+	if err := models.AnonymizeMeetingUser(utils.GetMeetingsCollection(), userID); err != nil {
+		return err
+	}
+	if err := models.RemoveUserMeetingRoles(utils.GetMeetingsCollection(), userID); err != nil {
+		return err
+	}
+	if err := models.RemoveUserInvitations(utils.GetMeetingsCollection(), userID, userEmails(user)); err != nil {
+		return err
+	}
+	if err := models.AnonymizeAttendance(utils.GetAttendanceCollection(), userID); err != nil {
+		return err
+	}
+	if err := models.AnonymizeAnalytics(utils.GetMeetingAnalyticsCollection(), userID); err != nil {
+		return err
+	}
+
+	recordings, err := models.DeleteUserRecordings(utils.GetRecordingsCollection(), userID)
+	if err != nil {
+		return err
+	}
+	for _, recording := range recordings {
+		if err := os.Remove(recording.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error deleting recording file %s: %v", recording.FilePath, err)
+		}
+	}
+
+	if err := models.RemoveUserMemberships(utils.GetWorkspaceMembersCollection(), userID); err != nil {
+		return err
+	}
+	if err := models.DeletePreferences(utils.GetPreferencesCollection(), user.ID); err != nil {
+		return err
+	}
+	if err := models.DeleteMagicLinks(utils.GetMagicLinksCollection(), user.Email); err != nil {
+		return err
+	}
+	if err := models.DeleteUserDataExports(utils.GetDataExportsCollection(), userID); err != nil {
+		return err
+	}
+
+	store := storage.Default()
+	if err := store.DeletePrefix(ctx, "avatars/"+userID); err != nil {
+		return err
+	}
+	if err := store.DeletePrefix(ctx, "exports/"+userID); err != nil {
+		return err
+	}
+
+	return models.DeleteUser(utils.GetUsersCollection(), user.ID)
+}
+
+// requestDataExport starts building a ZIP of the user's data. Only one export
+// can be in progress at a time.
+func requestDataExport(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	userID := user.ID.Hex()
+
+	collection := utils.GetDataExportsCollection()
+	latest, err := models.FindLatestDataExport(collection, userID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+	if latest != nil && latest.Status == models.ExportStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export is already in progress", "export": latest})
+		return
+	}
+
+	// Only the newest export can be downloaded, so older files can go
+	if err := storage.Default().DeletePrefix(c.Request.Context(), "exports/"+userID); err != nil {
+		log.Printf("Error deleting old exports for user %s: %v", userID, err)
+	}
+
+	export := &models.DataExport{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(dataExportTTL),
+	}
+	if err := models.CreateDataExport(collection, export); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+
+	go buildDataExport(export, user)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export started",
+		"export":  export,
+	})
+}
+
+// getDataExport reports on the user's latest export
+func getDataExport(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	export, err := models.FindLatestDataExport(utils.GetDataExportsCollection(), userID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No export found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load export"})
+		return
+	}
+
+	response := gin.H{"export": export}
+	if export.Status == models.ExportStatusReady {
+		response["download_url"] = "/api/user/export/download"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func downloadDataExport(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	export, err := models.FindLatestDataExport(utils.GetDataExportsCollection(), userID)
+	if err != nil || export.Status != models.ExportStatusReady {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No finished export found"})
+		return
+	}
+
+	reader, _, err := storage.Default().Get(c.Request.Context(), export.BlobKey)
+	if err != nil {
+		log.Printf("Error reading export %s: %v", export.ID.Hex(), err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export file not found"})
+		return
+	}
+	defer reader.Close()
+
+	fileName := fmt.Sprintf("bantr-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+	c.DataFromReader(http.StatusOK, export.SizeBytes, "application/zip", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, fileName),
+	})
+}
+
+// buildDataExport gathers the user's data into a ZIP of JSON files and stores
+// it. It runs in the background, so failures are recorded on the export.
+func buildDataExport(export *models.DataExport, user *models.User) {
+	collection := utils.GetDataExportsCollection()
+
+	data, err := collectUserData(user)
+	if err != nil {
+		log.Printf("Error collecting data for export %s: %v", export.ID.Hex(), err)
+		models.FailDataExport(collection, export.ID, "Failed to collect data")
+		return
+	}
+
+	archive, err := zipExport(data, user)
+	if err != nil {
+		log.Printf("Error building export %s: %v", export.ID.Hex(), err)
+		models.FailDataExport(collection, export.ID, "Failed to build archive")
+		return
+	}
+
+	ctx := context.Background()
+	userID := user.ID.Hex()
+	blobKey := fmt.Sprintf("exports/%s/%s.zip", userID, export.ID.Hex())
+	if err := storage.Default().Put(ctx, blobKey, "application/zip", archive); err != nil {
+		log.Printf("Error storing export %s: %v", export.ID.Hex(), err)
+		models.FailDataExport(collection, export.ID, "Failed to store archive")
+		return
+	}
+
+	if err := models.FinishDataExport(collection, export.ID, blobKey, int64(len(archive))); err != nil {
+		return
+	}
+	log.Printf("Data export %s for user %s is ready (%d bytes)", export.ID.Hex(), userID, len(archive))
+}
+
+// collectUserData loads everything we hold about a user, keyed by the file
+// name it goes in
+func collectUserData(user *models.User) (map[string]interface{}, error) {
+	userID := user.ID.Hex()
+
+	prefs, err := models.GetPreferences(utils.GetPreferencesCollection(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	hosted, err := models.GetUserMeetings(utils.GetMeetingsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	joined, err := models.GetParticipatedMeetings(utils.GetMeetingsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	attendance, err := models.GetUserAttendance(utils.GetAttendanceCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	analytics, err := models.GetUserAnalytics(utils.GetMeetingAnalyticsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	recordings, err := models.GetUserRecordings(utils.GetRecordingsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := models.GetUserSessions(utils.GetSessionsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := models.GetUserAPIKeys(utils.GetAPIKeysCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	bots, err := models.GetUserBots(utils.GetUsersCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	chatLinks, err := models.GetUserChatLinks(utils.GetChatLinksCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	notificationList, err := models.GetAllUserNotifications(utils.GetNotificationsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := models.GetUserMeetingRoles(utils.GetMeetingsCollection(), userID)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := models.GetUserInvitations(utils.GetMeetingsCollection(), userEmails(user))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"profile.json":            user,
+		"preferences.json":        prefs,
+		"meetings_hosted.json":    hosted,
+		"meetings_joined.json":    joined,
+		"attendance.json":         attendance,
+		"speaking_analytics.json": analytics,
+		"recordings.json":         recordings,
+		"sessions.json":           sessions,
+		"api_keys.json":           apiKeys,
+		"bots.json":               bots,
+		"chat_links.json":         chatLinks,
+		"notifications.json":      notificationList,
+		"meeting_roles.json":      roles,
+		"invitations.json":        invitations,
+	}, nil
+}
+
+// userEmails is every address a user is known to own and so could have
+// been invited on, in the lowercase form invitations are stored in
+func userEmails(user *models.User) []string {
+	emails := []string{}
+	add := func(email string) {
+		email = strings.ToLower(email)
+		if email != "" && !containsString(emails, email) {
+			emails = append(emails, email)
+		}
+	}
+
+	add(user.Email)
+	for _, identity := range user.Identities {
+		if identity.EmailVerified {
+			add(identity.Email)
+		}
+	}
+	return emails
+}
+
+func zipExport(data map[string]interface{}, user *models.User) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for name, value := range data {
+		file, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Include the uploaded avatar itself, not just its URL
+	if user.Avatar != nil {
+		key := avatarKey(user.ID.Hex(), user.Avatar.Version, utils.AvatarSizes[len(utils.AvatarSizes)-1])
+		if reader, _, err := storage.Default().Get(context.Background(), key); err == nil {
+			file, err := archive.Create("avatar.jpg")
+			if err == nil {
+				_, err = io.Copy(file, reader)
+			}
+			reader.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// maxAPIKeysPerUser keeps a runaway script from minting keys forever
+const maxAPIKeysPerUser = 50
+
+// listAPIKeys shows the user's keys and their bots' keys. The keys
+// themselves are only ever shown once, when they're created.
+func listAPIKeys(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	keys, err := models.GetUserAPIKeys(utils.GetAPIKeysCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys":         keys,
+		"count":            len(keys),
+		"available_scopes": models.APIKeyScopes(),
+	})
+}
+
+// createAPIKey makes a key for the user, or for one of their bots when
+// bot_id is given
+func createAPIKey(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		BotID         string   `json:"bot_id"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and scopes are required"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 64 characters"})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keys can expire after at most 365 days"})
+		return
+	}
+
+	collection := utils.GetAPIKeysCollection()
+	existing, err := models.GetUserAPIKeys(collection, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many API keys, delete one first"})
+		return
+	}
+
+	actingAs := userID
+	if req.BotID != "" {
+		botID, err := bson.ObjectIDFromHex(req.BotID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bot ID"})
+			return
+		}
+		if _, err := models.FindUserBot(utils.GetUsersCollection(), botID, userID); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Bot not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find bot"})
+			}
+			return
+		}
+		actingAs = botID.Hex()
+	}
+
+	key, hash, prefix := utils.GenerateAPIKey()
+	apiKey := &models.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		UserID:    actingAs,
+		CreatedBy: userID,
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := models.CreateAPIKey(collection, apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created. Copy it now, it won't be shown again.",
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+// deleteAPIKey revokes a key and closes any meeting connections made with it
+func deleteAPIKey(c *gin.Context, hub *websocket.Hub) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	keyID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := models.DeleteAPIKey(utils.GetAPIKeysCollection(), keyID, userID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API key"})
+		}
+		return
+	}
+
+	hub.DisconnectAPIKey(keyID.Hex())
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key deleted"})
+}
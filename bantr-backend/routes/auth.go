@@ -1,10 +1,308 @@
 package routes
 
 import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
 	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"golang.org/x/oauth2"
 )
 
-func AuthRoutes(router *gin.Engine) {
+func AuthRoutes(router *gin.Engine, hub *websocket.Hub) {
 	router.POST("/api/auth/google", middleware.GoogleAuthMiddleware())
+
+	router.POST("/api/auth/refresh", refreshToken)
+
+	router.POST("/api/auth/logout", middleware.AuthMiddleware(), func(c *gin.Context) {
+		logout(c, hub)
+	})
+
+	router.POST("/api/auth/magic-link", requestMagicLink)
+
+	router.POST("/api/auth/magic-link/verify", verifyMagicLink)
+
+	router.POST("/api/auth/2fa", verifyTwoFactorLogin)
+
+	router.GET("/.well-known/jwks.json", getJWKS)
+
+	router.GET("/api/auth/providers", listLoginProviders)
+
+	router.GET("/api/auth/:provider/login", startProviderLogin)
+
+	router.GET("/api/auth/:provider/callback", finishProviderLogin)
+}
+
+// oauthStateTTL is how long a user has to finish logging in at a provider
+const oauthStateTTL = 10 * time.Minute
+
+// oauthStateCookie holds a hash of the state in the browser that started a
+// login or link, so a callback URL handed to someone else does nothing
+const oauthStateCookie = "bantr_oauth_state"
+
+func listLoginProviders(c *gin.Context) {
+	providers := []gin.H{{"name": "google", "display_name": "Google", "type": "google"}}
+	for _, provider := range utils.ListLoginProviders() {
+		providers = append(providers, gin.H{
+			"name":         provider.Name(),
+			"display_name": provider.DisplayName(),
+			"type":         provider.Type(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+// startProviderLogin sends the browser off to the provider's login page. The
+// optional redirect query param is a frontend path to land on afterwards.
+func startProviderLogin(c *gin.Context) {
+	provider, ok := utils.GetLoginProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	authURL, ok := beginOAuthFlow(c, provider, c.Query("redirect"), "", "")
+	if !ok {
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// beginOAuthFlow stores a fresh state for a login or link and returns the
+// provider URL to send the browser to. It writes the error response itself
+// when it fails.
+func beginOAuthFlow(c *gin.Context, provider utils.LoginProvider, redirectPath, linkUserID, linkSessionID string) (string, bool) {
+	redirectPath = utils.SafeRedirectPath(redirectPath)
+
+	state := &models.OAuthState{
+		State:         utils.GenerateOpaqueToken(),
+		Provider:      provider.Name(),
+		Nonce:         utils.GenerateOpaqueToken(),
+		CodeVerifier:  oauth2.GenerateVerifier(),
+		RedirectPath:  redirectPath,
+		LinkUserID:    linkUserID,
+		LinkSessionID: linkSessionID,
+		ExpiresAt:     time.Now().Add(oauthStateTTL),
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		log.Printf("Error starting %s login: %v", provider.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		return "", false
+	}
+
+	if err := models.CreateOAuthState(utils.GetOAuthStatesCollection(), state); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return "", false
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, utils.HashToken(state.State), int(oauthStateTTL.Seconds()), "/api/auth", "", c.Request.TLS != nil, true)
+	return authURL, true
+}
+
+// checkOAuthStateCookie reports whether the callback came back to the
+// browser that started the flow. The cookie is cleared either way.
+func checkOAuthStateCookie(c *gin.Context, state string) bool {
+	cookie, err := c.Cookie(oauthStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, "", -1, "/api/auth", "", c.Request.TLS != nil, true)
+	if err != nil || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(utils.HashToken(state))) == 1
+}
+
+// finishProviderLogin handles the provider redirecting back to us, either to
+// log in or to link the identity to the user who started the flow. Tokens are
+// handed to the frontend in the URL fragment so they never reach a server log.
+func finishProviderLogin(c *gin.Context) {
+	providerName := c.Param("provider")
+	provider, ok := utils.GetLoginProvider(providerName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		redirectToFrontend(c, "/", url.Values{"error": {providerError}})
+		return
+	}
+
+	if !checkOAuthStateCookie(c, c.Query("state")) {
+		redirectToFrontend(c, "/", url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	state, err := models.ConsumeOAuthState(utils.GetOAuthStatesCollection(), providerName, c.Query("state"))
+	if err != nil {
+		redirectToFrontend(c, "/", url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	profile, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.Nonce, state.CodeVerifier)
+	if err != nil {
+		log.Printf("Error finishing %s login: %v", providerName, err)
+		redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	usersCollection := utils.GetUsersCollection()
+
+	if state.LinkUserID != "" {
+		userID, err := bson.ObjectIDFromHex(state.LinkUserID)
+		if err != nil || !linkSessionActive(state) {
+			redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"invalid_state"}})
+			return
+		}
+
+		err = models.LinkIdentity(usersCollection, userID, profile.Identity())
+		if err == models.ErrIdentityInUse {
+			redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"identity_in_use"}})
+			return
+		}
+		if err != nil {
+			redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"server_error"}})
+			return
+		}
+
+		redirectToFrontend(c, state.RedirectPath, url.Values{"linked": {providerName}})
+		return
+	}
+
+	user, err := models.FindOrCreateUserByIdentity(usersCollection, profile.Identity(), profile.Name, profile.Picture)
+	if err == models.ErrEmailInUse {
+		redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"email_in_use"}})
+		return
+	}
+	if err != nil {
+		redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	login, err := utils.BeginLogin(*user, c.Request.UserAgent(), c.ClientIP())
+	if err == models.ErrUserDeactivated {
+		redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"account_deactivated"}})
+		return
+	}
+	if err != nil {
+		log.Printf("Session creation error: %v", err)
+		redirectToFrontend(c, state.RedirectPath, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	if login.ChallengeToken != "" {
+		redirectToFrontend(c, state.RedirectPath, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {login.ChallengeToken},
+		})
+		return
+	}
+
+	tokens := login.Tokens
+	redirectToFrontend(c, state.RedirectPath, url.Values{
+		"token":         {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.Itoa(tokens.ExpiresIn)},
+	})
+}
+
+// linkSessionActive checks the user who started a link is still signed in
+// with the same session, so an identity is never linked to an account whose
+// login has since ended
+func linkSessionActive(state *models.OAuthState) bool {
+	sessionID, err := bson.ObjectIDFromHex(state.LinkSessionID)
+	if err != nil {
+		return false
+	}
+
+	session, err := models.FindSessionByID(utils.GetSessionsCollection(), sessionID)
+	if err != nil {
+		return false
+	}
+	return session.UserID == state.LinkUserID && session.RevokedAt == nil && session.ExpiresAt.After(time.Now())
+}
+
+// redirectToFrontend sends the browser to the frontend's auth callback page
+// with the result in the fragment
+func redirectToFrontend(c *gin.Context, redirectPath string, values url.Values) {
+	values.Set("redirect", redirectPath)
+	c.Redirect(http.StatusFound, utils.FrontendURL()+"/auth/callback#"+values.Encode())
+}
+
+// getJWKS publishes our token signing keys so other services can verify
+// Bantr tokens
+func getJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.PublicJWKS()})
+}
+
+// refreshToken trades a refresh token for a new access token. The refresh
+// token is rotated on every call.
+func refreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	tokens, user, err := utils.RefreshSession(req.RefreshToken)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == models.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		if err == models.ErrUserDeactivated {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+			return
+		}
+		log.Printf("Error refreshing session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          user,
+	})
+}
+
+// logout ends the session the request was made with and closes any meeting
+// connections opened with it
+func logout(c *gin.Context, hub *websocket.Hub) {
+	sessionID, tokenID, expiresAt := middleware.GetSessionFromContext(c)
+
+	if sessionID != "" {
+		if err := utils.RevokeSession(sessionID); err != nil {
+			log.Printf("Error revoking session %s: %v", sessionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+		hub.DisconnectSession(sessionID)
+	} else if tokenID != "" {
+		// Tokens without a session can only be denylisted one at a time
+		if err := models.RevokeTokenID(utils.GetRevokedTokensCollection(), tokenID, expiresAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
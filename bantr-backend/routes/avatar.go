@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/storage"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// avatarPictureSize is the thumbnail used for the user's picture URL
+const avatarPictureSize = 256
+
+func avatarPrefix(userID, version string) string {
+	return fmt.Sprintf("avatars/%s/%s", userID, version)
+}
+
+func avatarKey(userID, version string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", avatarPrefix(userID, version), size)
+}
+
+// uploadAvatar takes a PNG, JPEG or WebP from the "avatar" form field and
+// stores a set of square JPEG thumbnails for it. The user's picture is
+// switched over to the new upload.
+func uploadAvatar(c *gin.Context, hub *websocket.Hub) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	// Leave some room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, utils.MaxAvatarBytes+64<<10)
+	file, header, err := c.Request.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar file is required (max 5MB)"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > utils.MaxAvatarBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar must be 5MB or smaller"})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, utils.MaxAvatarBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read avatar"})
+		return
+	}
+	if len(data) > utils.MaxAvatarBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar must be 5MB or smaller"})
+		return
+	}
+
+	thumbnails, err := utils.ProcessAvatar(data)
+	if err != nil {
+		if err == utils.ErrUnsupportedImage || err == utils.ErrImageTooSmall || err == utils.ErrImageTooLarge {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error processing avatar for user %s: %v", user.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process avatar"})
+		return
+	}
+
+	userID := user.ID.Hex()
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	store := storage.Default()
+	ctx := c.Request.Context()
+
+	for size, thumbnail := range thumbnails {
+		if err := store.Put(ctx, avatarKey(userID, version, size), "image/jpeg", thumbnail); err != nil {
+			log.Printf("Error storing avatar for user %s: %v", userID, err)
+			store.DeletePrefix(ctx, avatarPrefix(userID, version))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store avatar"})
+			return
+		}
+	}
+
+	picture := fmt.Sprintf("%s/api/user/%s/avatar/%d?v=%s", utils.BackendURL(), userID, avatarPictureSize, version)
+	avatar := models.Avatar{Version: version, UpdatedAt: time.Now()}
+	updated, previous, err := models.SetUserAvatar(utils.GetUsersCollection(), user.ID, avatar, picture)
+	if err != nil {
+		store.DeletePrefix(ctx, avatarPrefix(userID, version))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if previous != nil && previous.Version != version {
+		if err := store.DeletePrefix(ctx, avatarPrefix(userID, previous.Version)); err != nil {
+			log.Printf("Error deleting old avatar for user %s: %v", userID, err)
+		}
+	}
+
+	hub.UpdateUserProfile(userID, updated.Name, updated.Picture)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Avatar updated successfully",
+		"user":    updated,
+	})
+}
+
+// getAvatar serves one of a user's avatar thumbnails. It's public since
+// picture URLs end up in img tags that can't send a token.
+func getAvatar(c *gin.Context) {
+	size, err := strconv.Atoi(c.Param("size"))
+	if err != nil || !utils.IsAvatarSize(size) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown avatar size"})
+		return
+	}
+
+	id, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+
+	user, err := models.FindUserByID(utils.GetUsersCollection(), id)
+	if err != nil || user.Avatar == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, user.Avatar.Version, size)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, contentType, err := storage.Default().Get(c.Request.Context(), avatarKey(id.Hex(), user.Avatar.Version, size))
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading avatar for user %s: %v", id.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load avatar"})
+		return
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load avatar"})
+		return
+	}
+
+	// A versioned URL never changes, so it can be cached for good. Without
+	// the version the browser has to check back.
+	if c.Query("v") == user.Avatar.Version {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=300")
+	}
+	c.Header("ETag", etag)
+	c.DataFromReader(http.StatusOK, int64(len(data)), contentType, bytes.NewReader(data), nil)
+}
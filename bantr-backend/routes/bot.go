@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const maxBotsPerUser = 10
+
+func listBots(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	bots, err := models.GetUserBots(utils.GetUsersCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bots":  bots,
+		"count": len(bots),
+	})
+}
+
+// createBot adds a bot account owned by the user. Bots can't log in, they
+// act through API keys the owner creates for them.
+func createBot(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 64 characters"})
+		return
+	}
+
+	usersCollection := utils.GetUsersCollection()
+	bots, err := models.GetUserBots(usersCollection, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+	if len(bots) >= maxBotsPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many bots, delete one first"})
+		return
+	}
+
+	bot := &models.User{
+		Name:       name,
+		IsBot:      true,
+		BotOwnerID: userID,
+	}
+	if err := models.CreateUser(usersCollection, bot); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Bot created",
+		"bot":     bot,
+	})
+}
+
+// deleteBot removes a bot along with its keys, and drops it from any
+// meeting it's in
+func deleteBot(c *gin.Context, hub *websocket.Hub) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	botID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bot ID"})
+		return
+	}
+
+	bot, err := models.FindUserBot(utils.GetUsersCollection(), botID, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bot not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find bot"})
+		}
+		return
+	}
+
+	err = eraseUser(c.Request.Context(), bot)
+	if err == models.ErrLastOwner {
+		c.JSON(http.StatusConflict, gin.H{"error": "The bot is the only owner of a workspace"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bot"})
+		return
+	}
+
+	hub.DisconnectUser(bot.ID.Hex())
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bot deleted"})
+}
@@ -0,0 +1,332 @@
+package routes
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// maxChatCommandBody is far more than a slash command ever sends
+const maxChatCommandBody = 64 << 10
+
+// ChatRoutes handles the /bantr slash command from Slack or Mattermost and
+// lets users manage which chat accounts are linked to them
+func ChatRoutes(router *gin.Engine) {
+	// The chat platform calls this one, so it's checked by signature
+	// instead of a login
+	router.POST("/api/integrations/chat/command", handleChatCommand)
+
+	chatGroup := router.Group("/api/integrations/chat/links")
+	chatGroup.Use(middleware.AuthMiddleware())
+	{
+		chatGroup.GET("", listChatLinks)
+
+		chatGroup.POST("/preview", previewChatLink)
+
+		chatGroup.POST("", createChatLink)
+
+		chatGroup.DELETE("/:id", deleteChatLink)
+	}
+}
+
+// chatReply answers a slash command. Ephemeral replies are only shown to
+// the person who ran the command.
+func chatReply(c *gin.Context, inChannel bool, text string) {
+	responseType := "ephemeral"
+	if inChannel {
+		responseType = "in_channel"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response_type": responseType,
+		"text":          text,
+	})
+}
+
+func handleChatCommand(c *gin.Context) {
+	if !utils.ChatCommandsEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat commands are not configured"})
+		return
+	}
+
+	// The body has to be read raw since Slack signs it byte for byte
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxChatCommandBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	platform, err := utils.VerifyChatCommand(c.Request.Header, body, form)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid request signature"})
+		return
+	}
+
+	if form.Get("team_id") == "" || form.Get("user_id") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "team_id and user_id are required"})
+		return
+	}
+
+	command := form.Get("command")
+	if command == "" {
+		command = "/bantr"
+	}
+
+	action, args := strings.TrimSpace(form.Get("text")), ""
+	if i := strings.IndexAny(action, " \t"); i >= 0 {
+		action, args = action[:i], strings.TrimSpace(action[i+1:])
+	}
+
+	switch strings.ToLower(action) {
+	case "start":
+		startChatMeeting(c, platform, form, command, args)
+	case "link":
+		linkChatAccount(c, platform, form, command)
+	case "unlink":
+		unlinkChatAccount(c, platform, form)
+	case "", "help":
+		chatReply(c, false, chatHelp(command))
+	default:
+		chatReply(c, false, fmt.Sprintf("Unknown command `%s`.\n%s", utils.EscapeChatText(action), chatHelp(command)))
+	}
+}
+
+func chatHelp(command string) string {
+	return fmt.Sprintf("`%[1]s start [title]` starts a meeting and posts the join link here\n"+
+		"`%[1]s link` connects your chat account to your Bantr account\n"+
+		"`%[1]s unlink` disconnects it", command)
+}
+
+// startChatMeeting creates a meeting hosted by the linked Bantr user, with
+// their usual meeting defaults
+func startChatMeeting(c *gin.Context, platform string, form url.Values, command, title string) {
+	link, err := models.FindChatLink(utils.GetChatLinksCollection(), platform, form.Get("team_id"), form.Get("user_id"))
+	if err == mongo.ErrNoDocuments {
+		chatReply(c, false, fmt.Sprintf("Your chat account isn't linked to Bantr yet. Run `%s link` first.", command))
+		return
+	}
+	if err != nil {
+		chatReply(c, false, "Something went wrong, please try again.")
+		return
+	}
+
+	user, err := chatLinkUser(link)
+	if err != nil {
+		chatReply(c, false, "Something went wrong, please try again.")
+		return
+	}
+	if user == nil || user.Deactivated {
+		chatReply(c, false, fmt.Sprintf("The Bantr account linked to you is no longer active. Run `%s unlink` and link another.", command))
+		return
+	}
+
+	prefs, err := models.GetPreferences(utils.GetPreferencesCollection(), user.ID)
+	if err != nil {
+		chatReply(c, false, "Something went wrong, please try again.")
+		return
+	}
+	settings := prefs.MeetingDefaults.Settings
+	if settings.RequireHost2FA && !user.HasTwoFactor() {
+		chatReply(c, false, "Your meetings require the host to have two-factor authentication. Turn it on in Bantr first.")
+		return
+	}
+
+	if title == "" {
+		title = "Quick meeting"
+	}
+
+	meeting := &models.Meeting{
+		Title:        title,
+		MediaMode:    prefs.MeetingDefaults.MediaMode,
+		Settings:     settings,
+		CreatedBy:    user.ID.Hex(),
+		CreatorName:  user.Name,
+		Participants: []string{},
+		Source:       models.MeetingSourceChat,
+	}
+
+	if err := models.CreateMeeting(utils.GetMeetingsCollection(), meeting); err != nil {
+		chatReply(c, false, "Failed to create the meeting, please try again.")
+		return
+	}
+
+	chatReply(c, true, fmt.Sprintf("%s started *%s*\nJoin here: %s",
+		utils.EscapeChatText(user.Name), utils.EscapeChatText(meeting.Title), utils.MeetingURL(meeting.RoomID)))
+}
+
+// chatLinkUser loads the user a chat account is linked to, or nil if
+// they've since been deleted
+func chatLinkUser(link *models.ChatLink) (*models.User, error) {
+	userID, err := bson.ObjectIDFromHex(link.UserID)
+	if err != nil {
+		return nil, nil
+	}
+
+	user, err := models.FindUserByID(utils.GetUsersCollection(), userID)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return user, err
+}
+
+// linkChatAccount replies with a link that connects the chat account to
+// whoever opens it while logged in to Bantr
+func linkChatAccount(c *gin.Context, platform string, form url.Values, command string) {
+	_, err := models.FindChatLink(utils.GetChatLinksCollection(), platform, form.Get("team_id"), form.Get("user_id"))
+	if err == nil {
+		chatReply(c, false, fmt.Sprintf("Your chat account is already linked. Run `%s unlink` first to link a different Bantr account.", command))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		chatReply(c, false, "Something went wrong, please try again.")
+		return
+	}
+
+	token, err := utils.GenerateChatLinkToken(&models.ChatLink{
+		Platform:     platform,
+		TeamID:       form.Get("team_id"),
+		TeamDomain:   form.Get("team_domain"),
+		ChatUserID:   form.Get("user_id"),
+		ChatUserName: form.Get("user_name"),
+	})
+	if err != nil {
+		chatReply(c, false, "Something went wrong, please try again.")
+		return
+	}
+
+	chatReply(c, false, fmt.Sprintf("Open this link within %d minutes to connect your Bantr account:\n%s",
+		int(utils.ChatLinkTTL.Minutes()), utils.ChatLinkURL(token)))
+}
+
+func unlinkChatAccount(c *gin.Context, platform string, form url.Values) {
+	collection := utils.GetChatLinksCollection()
+
+	link, err := models.FindChatLink(collection, platform, form.Get("team_id"), form.Get("user_id"))
+	if err == mongo.ErrNoDocuments {
+		chatReply(c, false, "Your chat account isn't linked to Bantr.")
+		return
+	}
+	if err == nil {
+		err = models.DeleteChatLink(collection, link.ID, link.UserID)
+	}
+	if err != nil {
+		chatReply(c, false, "Something went wrong, please try again.")
+		return
+	}
+
+	chatReply(c, false, "Your chat account is no longer linked to Bantr.")
+}
+
+func listChatLinks(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	links, err := models.GetUserChatLinks(utils.GetChatLinksCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat links"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat_links": links,
+		"count":      len(links),
+	})
+}
+
+// previewChatLink shows which chat account a link token is for, so the user
+// can check it's theirs before linking it
+func previewChatLink(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	link, err := utils.ParseChatLinkToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link is invalid or has expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chat_link": link})
+}
+
+// createChatLink finishes linking a chat account using the token from the
+// link the slash command replied with. Once linked, the chat account can
+// start meetings as the user, so they have to confirm it's theirs after
+// seeing the preview; opening a link someone else sent is not enough.
+func createChatLink(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	var req struct {
+		Token   string `json:"token" binding:"required"`
+		Confirm bool   `json:"confirm"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+	if !req.Confirm {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirm that this chat account is yours to link it"})
+		return
+	}
+
+	link, err := utils.ParseChatLinkToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link is invalid or has expired"})
+		return
+	}
+	link.UserID = userID
+
+	err = models.CreateChatLink(utils.GetChatLinksCollection(), link)
+	if err == models.ErrChatUserLinked {
+		c.JSON(http.StatusConflict, gin.H{"error": "This chat account is already linked to another user"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link chat account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Chat account linked",
+		"chat_link": link,
+	})
+}
+
+func deleteChatLink(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	linkID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat link ID"})
+		return
+	}
+
+	if err := models.DeleteChatLink(utils.GetChatLinksCollection(), linkID, userID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat link not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chat link"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Chat link deleted"})
+}
@@ -0,0 +1,397 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/jobs"
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/notifications"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	maxInvitationsPerMeeting = 200
+	defaultMeetingDuration   = 60
+	maxMeetingDuration       = 24 * 60
+	defaultReminderMinutes   = 15
+	maxReminderMinutes       = 7 * 24 * 60
+	maxScheduleAhead         = 365 * 24 * time.Hour
+	// At most maxInvitationsPerDay invitation emails go out on one user's
+	// behalf per invitationLimitWindow, counting resends when a meeting
+	// is rescheduled
+	maxInvitationsPerDay  = 500
+	invitationLimitWindow = 24 * time.Hour
+)
+
+// InvitationRoutes lets invitees look at and answer their invitation. The
+// token from the email is all they need, since most won't have an account.
+func InvitationRoutes(router *gin.Engine) {
+	router.GET("/api/invitations/:token", getInvitation)
+
+	router.POST("/api/invitations/:token", respondToInvitation)
+}
+
+// scheduleRequest is how meetings are scheduled, both when they're created
+// and later on
+type scheduleRequest struct {
+	ScheduledAt     *time.Time `json:"scheduled_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+	// ReminderMinutes defaults to 15 when left out, zero turns reminders off
+	ReminderMinutes *int `json:"reminder_minutes"`
+}
+
+// parseSchedule validates a schedule, writing the error response itself
+// when it's bad. It returns nil when no start time was given.
+func parseSchedule(c *gin.Context, req scheduleRequest, sequence int) (*models.MeetingSchedule, bool) {
+	if req.ScheduledAt == nil {
+		return nil, true
+	}
+
+	startsAt := req.ScheduledAt.UTC().Truncate(time.Second)
+	if startsAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled time must be in the future"})
+		return nil, false
+	}
+	if startsAt.After(time.Now().Add(maxScheduleAhead)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Meetings can be scheduled at most a year ahead"})
+		return nil, false
+	}
+
+	duration := req.DurationMinutes
+	if duration == 0 {
+		duration = defaultMeetingDuration
+	}
+	if duration < 0 || duration > maxMeetingDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Duration must be between 1 minute and 24 hours"})
+		return nil, false
+	}
+
+	reminder := defaultReminderMinutes
+	if req.ReminderMinutes != nil {
+		reminder = *req.ReminderMinutes
+	}
+	if reminder < 0 || reminder > maxReminderMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reminders can be sent at most a week ahead"})
+		return nil, false
+	}
+
+	return &models.MeetingSchedule{
+		StartsAt:        startsAt,
+		DurationMinutes: duration,
+		ReminderMinutes: reminder,
+		Sequence:        sequence,
+	}, true
+}
+
+// parseInvitees checks and normalizes invitee addresses, dropping
+// duplicates
+func parseInvitees(c *gin.Context, emails []string) ([]string, bool) {
+	seen := map[string]bool{}
+	invitees := []string{}
+	for _, email := range emails {
+		address, err := mail.ParseAddress(strings.TrimSpace(email))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address: " + email})
+			return nil, false
+		}
+		normalized := strings.ToLower(address.Address)
+		if !seen[normalized] {
+			seen[normalized] = true
+			invitees = append(invitees, normalized)
+		}
+	}
+	return invitees, true
+}
+
+// newInvitations creates invitations along with the RSVP token for each,
+// keyed by email
+func newInvitations(emails []string, invitedBy string) ([]models.Invitation, map[string]string) {
+	invitations := make([]models.Invitation, 0, len(emails))
+	tokens := map[string]string{}
+	for _, email := range emails {
+		token := utils.GenerateOpaqueToken()
+		tokens[email] = token
+		invitations = append(invitations, models.Invitation{
+			Email:     email,
+			TokenHash: utils.HashToken(token),
+			Status:    models.InvitationStatusQueued,
+			RSVP:      models.RSVPNeedsAction,
+			InvitedBy: invitedBy,
+			InvitedAt: time.Now(),
+		})
+	}
+	return invitations, tokens
+}
+
+// withinInvitationLimit checks that a user can send count more invitation
+// emails, writing the error response itself when they can't
+func withinInvitationLimit(c *gin.Context, userID string, count int) bool {
+	if count == 0 {
+		return true
+	}
+
+	sent, err := jobs.InvitationsSentSince(userID, time.Now().Add(-invitationLimitWindow))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitations"})
+		return false
+	}
+	if sent+int64(count) > maxInvitationsPerDay {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invitations sent today, try again later"})
+		return false
+	}
+	return true
+}
+
+// queueInvitations sends the invitation emails and reminders for the
+// people just invited. The meeting is already saved by now, so failures
+// are logged rather than failing the request.
+func queueInvitations(meeting *models.Meeting, tokens map[string]string, sentBy string, update bool) {
+	for email, token := range tokens {
+		if err := jobs.QueueInvitation(meeting.RoomID, email, token, sentBy, update); err != nil {
+			log.Printf("Error queueing invitation for %s to %s: %v", meeting.RoomID, email, err)
+			models.SetInvitationStatus(utils.GetMeetingsCollection(), meeting.RoomID, email, models.InvitationStatusFailed, "Failed to queue email")
+		}
+	}
+}
+
+func meetingInvitations(meeting *models.Meeting) []models.Invitation {
+	if meeting.Invitations == nil {
+		return []models.Invitation{}
+	}
+	return meeting.Invitations
+}
+
+// getMeetingInvitations needs PermissionInvite
+func getMeetingInvitations(c *gin.Context) {
+	meeting, _ := middleware.GetMeetingFromContext(c)
+
+	invitations := meetingInvitations(meeting)
+	c.JSON(http.StatusOK, gin.H{
+		"invitations": invitations,
+		"count":       len(invitations),
+		"schedule":    meeting.Schedule,
+	})
+}
+
+// inviteToMeeting needs PermissionInvite. People already invited are
+// skipped rather than emailed again.
+func inviteToMeeting(c *gin.Context) {
+	userID, _, userName, _, _ := middleware.GetUserFromContext(c)
+	meeting, _ := middleware.GetMeetingFromContext(c)
+
+	var req struct {
+		Emails []string `json:"emails" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Emails are required"})
+		return
+	}
+
+	if !meeting.IsActive {
+		c.JSON(http.StatusGone, gin.H{"error": "Meeting has ended"})
+		return
+	}
+
+	invitees, ok := parseInvitees(c, req.Emails)
+	if !ok {
+		return
+	}
+	fresh := []string{}
+	for _, email := range invitees {
+		if meeting.FindInvitation(email) == nil {
+			fresh = append(fresh, email)
+		}
+	}
+	if len(meeting.Invitations)+len(fresh) > maxInvitationsPerMeeting {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Meetings can have at most 200 invitations"})
+		return
+	}
+	if !withinInvitationLimit(c, userID, len(fresh)) {
+		return
+	}
+
+	if len(fresh) > 0 {
+		invitations, tokens := newInvitations(fresh, userID)
+		if err := models.AddInvitations(utils.GetMeetingsCollection(), meeting.RoomID, invitations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite"})
+			return
+		}
+		meeting.Invitations = append(meeting.Invitations, invitations...)
+
+		queueInvitations(meeting, tokens, userID, false)
+		go notifications.MeetingInvitations(meeting, fresh, userID, userName, false)
+		for _, email := range fresh {
+			if err := jobs.ScheduleReminder(meeting, email); err != nil {
+				log.Printf("Error scheduling reminder for %s to %s: %v", meeting.RoomID, email, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Invitations sent",
+		"invited":     len(fresh),
+		"invitations": meetingInvitations(meeting),
+	})
+}
+
+// uninviteFromMeeting needs PermissionInvite. Anything still queued for the
+// person is dropped when it comes up.
+func uninviteFromMeeting(c *gin.Context) {
+	meeting, _ := middleware.GetMeetingFromContext(c)
+	email := strings.ToLower(c.Param("email"))
+
+	err := models.RemoveInvitation(utils.GetMeetingsCollection(), meeting.RoomID, email)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation removed"})
+}
+
+// scheduleMeeting needs PermissionEditSettings. Everyone invited gets an
+// updated invitation, with a new RSVP link, and reminders move with the
+// meeting.
+func scheduleMeeting(c *gin.Context) {
+	userID, _, userName, _, _ := middleware.GetUserFromContext(c)
+	meeting, _ := middleware.GetMeetingFromContext(c)
+
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ScheduledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled_at is required"})
+		return
+	}
+
+	if !meeting.IsActive {
+		c.JSON(http.StatusGone, gin.H{"error": "Meeting has ended"})
+		return
+	}
+
+	sequence := 1
+	if meeting.Schedule != nil {
+		sequence = meeting.Schedule.Sequence + 1
+	}
+	schedule, ok := parseSchedule(c, req, sequence)
+	if !ok {
+		return
+	}
+	if !withinInvitationLimit(c, userID, len(meeting.Invitations)) {
+		return
+	}
+
+	meetings := utils.GetMeetingsCollection()
+	if err := models.UpdateMeetingSchedule(meetings, meeting.RoomID, schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule meeting"})
+		return
+	}
+	meeting.Schedule = schedule
+
+	tokens := map[string]string{}
+	emails := []string{}
+	for i := range meeting.Invitations {
+		invitation := &meeting.Invitations[i]
+		token := utils.GenerateOpaqueToken()
+		if err := models.SetInvitationToken(meetings, meeting.RoomID, invitation.Email, utils.HashToken(token)); err != nil {
+			continue
+		}
+		invitation.TokenHash = utils.HashToken(token)
+		invitation.Status = models.InvitationStatusQueued
+		tokens[invitation.Email] = token
+		emails = append(emails, invitation.Email)
+	}
+	queueInvitations(meeting, tokens, userID, true)
+	go notifications.MeetingInvitations(meeting, emails, userID, userName, true)
+
+	if err := jobs.ScheduleReminders(meeting); err != nil {
+		log.Printf("Error scheduling reminders for %s: %v", meeting.RoomID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Meeting scheduled",
+		"schedule": schedule,
+	})
+}
+
+// findInvitation looks up the invitation an RSVP token belongs to, writing
+// the error response itself when there isn't one
+func findInvitation(c *gin.Context) (*models.Meeting, *models.Invitation, bool) {
+	tokenHash := utils.HashToken(c.Param("token"))
+
+	meeting, invitation, err := models.FindMeetingByInvitationToken(utils.GetMeetingsCollection(), tokenHash)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find invitation"})
+		return nil, nil, false
+	}
+
+	return meeting, invitation, true
+}
+
+// getInvitation shows an invitee what they were invited to. It only gives
+// out what the invitation email already told them.
+func getInvitation(c *gin.Context) {
+	meeting, invitation, ok := findInvitation(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"meeting": gin.H{
+			"room_id":      meeting.RoomID,
+			"title":        meeting.Title,
+			"description":  meeting.Description,
+			"creator_name": meeting.CreatorName,
+			"schedule":     meeting.Schedule,
+			"is_active":    meeting.IsActive,
+			"join_url":     utils.MeetingURL(meeting.RoomID),
+		},
+		"invitation": invitation,
+	})
+}
+
+func respondToInvitation(c *gin.Context) {
+	var req struct {
+		Response string `json:"response" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || !models.IsValidRSVP(req.Response) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Response must be accepted, declined or tentative"})
+		return
+	}
+
+	meeting, invitation, ok := findInvitation(c)
+	if !ok {
+		return
+	}
+
+	if !meeting.IsActive {
+		c.JSON(http.StatusGone, gin.H{"error": "Meeting has ended"})
+		return
+	}
+
+	err := models.SetInvitationRSVP(utils.GetMeetingsCollection(), meeting.RoomID, invitation.Email, req.Response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save response"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Response saved",
+		"rsvp":    req.Response,
+	})
+}
@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/mailer"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// emailProvider is the provider name identities proven by a magic link are
+// stored under
+const emailProvider = "email"
+
+// At most magicLinkLimit links are sent to one address per MagicLinkTTL
+const magicLinkLimit = 5
+
+// requestMagicLink emails a single-use login link. Anyone can ask for one, so
+// the address doesn't need an account yet.
+func requestMagicLink(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"required"`
+		Name     string `json:"name"`
+		Redirect string `json:"redirect"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+
+	address, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+	email := strings.ToLower(address.Address)
+
+	redirectPath := utils.SafeRedirectPath(req.Redirect)
+
+	linksCollection := utils.GetMagicLinksCollection()
+	sent, err := models.CountRecentMagicLinks(linksCollection, email, time.Now().Add(-utils.MagicLinkTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+	if sent >= magicLinkLimit {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login links requested, try again later"})
+		return
+	}
+
+	link := &models.MagicLink{
+		TokenID:      utils.GenerateOpaqueToken(),
+		Email:        email,
+		Name:         strings.TrimSpace(req.Name),
+		RedirectPath: redirectPath,
+		ExpiresAt:    time.Now().Add(utils.MagicLinkTTL),
+	}
+	token, err := utils.GenerateMagicLinkToken(email, link.TokenID)
+	if err != nil {
+		log.Printf("Error signing magic link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+	if err := models.CreateMagicLink(linksCollection, link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	loginURL := utils.FrontendURL() + "/auth/magic-link?token=" + url.QueryEscape(token)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      []string{email},
+		Subject: "Your Bantr login link",
+		Text: "Use this link to log in to Bantr:\n\n" + loginURL +
+			"\n\nThe link expires in 15 minutes and can only be used once. If you didn't ask for it, you can ignore this email.\n",
+		HTML: `<p>Use this link to log in to Bantr:</p><p><a href="` + loginURL + `">Log in to Bantr</a></p>` +
+			`<p>The link expires in 15 minutes and can only be used once. If you didn't ask for it, you can ignore this email.</p>`,
+	})
+	if err != nil {
+		log.Printf("Error sending magic link to %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login link sent"})
+}
+
+// verifyMagicLink exchanges the token from a login link for a session
+func verifyMagicLink(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	claims, err := utils.VerifyTokenOfType(req.Token, utils.TokenTypeMagicLink)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+
+	link, err := models.ConsumeMagicLink(utils.GetMagicLinksCollection(), claims.ID)
+	if err == mongo.ErrNoDocuments || (err == nil && link.Email != claims.Email) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This login link was already used or has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify login link"})
+		return
+	}
+
+	identity := models.Identity{
+		Provider:      emailProvider,
+		Subject:       link.Email,
+		Email:         link.Email,
+		EmailVerified: true,
+	}
+
+	user, err := models.FindOrCreateUserByIdentity(utils.GetUsersCollection(), identity, link.Name, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	login, err := utils.BeginLogin(*user, c.Request.UserAgent(), c.ClientIP())
+	if err == models.ErrUserDeactivated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+		return
+	}
+	if err != nil {
+		log.Printf("Session creation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	if login.ChallengeToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     login.ChallengeToken,
+			"expires_in":          int(utils.TwoFactorChallengeTTL.Seconds()),
+			"redirect":            link.RedirectPath,
+		})
+		return
+	}
+
+	tokens := login.Tokens
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"redirect":      link.RedirectPath,
+		"user":          user,
+	})
+}
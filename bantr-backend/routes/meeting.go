@@ -1,35 +1,74 @@
 package routes
 
 import (
+	"log"
 	"net/http"
+	"strings"
 
+	"github.com/AnshX01/Bantr/bantr-backend/jobs"
 	"github.com/AnshX01/Bantr/bantr-backend/middleware"
 	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/notifications"
 	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
-func MeetingRoutes(router *gin.Engine) {
+func MeetingRoutes(router *gin.Engine, hub *websocket.Hub) {
 	meetingGroup := router.Group("/api/meetings")
 	meetingGroup.Use(middleware.AuthMiddleware())
 	{
 		meetingGroup.POST("", createMeeting)
 
-		meetingGroup.GET("/:roomId", getMeeting)
-
 		meetingGroup.GET("/user/list", getUserMeetings)
 
-		meetingGroup.DELETE("/:roomId", endMeeting)
+		meetingGroup.DELETE("/:roomId", middleware.RequireMeetingPermission(models.PermissionEndMeeting), endMeeting)
+
+		meetingGroup.GET("/:roomId/analytics", middleware.RequireMeetingPermission(models.PermissionViewAnalytics), getMeetingAnalytics)
+
+		meetingGroup.PUT("/:roomId/settings", middleware.RequireMeetingPermission(models.PermissionEditSettings), updateMeetingSettings)
+
+		meetingGroup.GET("/:roomId/attendance", middleware.RequireMeetingPermission(models.PermissionViewAttendance), getMeetingAttendance)
+
+		meetingGroup.GET("/:roomId/roles", getMeetingRoles)
+
+		meetingGroup.PUT("/:roomId/roles/:userId", middleware.RequireMeetingPermission(models.PermissionManageRoles), func(c *gin.Context) {
+			setMeetingRole(c, hub)
+		})
+
+		meetingGroup.DELETE("/:roomId/roles/:userId", middleware.RequireMeetingPermission(models.PermissionManageRoles), func(c *gin.Context) {
+			resetMeetingRole(c, hub)
+		})
+
+		meetingGroup.PUT("/:roomId/schedule", middleware.RequireMeetingPermission(models.PermissionEditSettings), scheduleMeeting)
+
+		meetingGroup.GET("/:roomId/invitations", middleware.RequireMeetingPermission(models.PermissionInvite), getMeetingInvitations)
+
+		meetingGroup.POST("/:roomId/invitations", middleware.RequireMeetingPermission(models.PermissionInvite), inviteToMeeting)
+
+		meetingGroup.DELETE("/:roomId/invitations/:email", middleware.RequireMeetingPermission(models.PermissionInvite), uninviteFromMeeting)
 	}
+
+	// Guests can load the meeting they were let into, so these sit outside
+	// the authenticated group
+	router.GET("/api/meetings/:roomId", middleware.OptionalAuthMiddleware(), getMeeting)
+
+	router.POST("/api/meetings/:roomId/guests", createGuest)
 }
 
 func createMeeting(c *gin.Context) {
 	userID, _, userName, _, _ := middleware.GetUserFromContext(c)
 
 	var req struct {
-		Title       string `json:"title" binding:"required"`
-		Description string `json:"description"`
+		Title       string                `json:"title" binding:"required"`
+		Description string                `json:"description"`
+		MediaMode   string                `json:"media_mode"`
+		WorkspaceID string                `json:"workspace_id"`
+		Settings    *meetingSettingsPatch `json:"settings"`
+		Invitees    []string              `json:"invitees"`
+		scheduleRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -37,12 +76,71 @@ func createMeeting(c *gin.Context) {
 		return
 	}
 
+	if req.MediaMode != "" && !models.IsValidMediaMode(req.MediaMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Media mode must be either mesh or sfu"})
+		return
+	}
+
+	if req.WorkspaceID != "" {
+		role, err := utils.WorkspaceRole(req.WorkspaceID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check workspace"})
+			return
+		}
+		if role == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this workspace"})
+			return
+		}
+	}
+
+	// Anything the request leaves out comes from the creator's defaults
+	mediaMode := req.MediaMode
+	var settings models.MeetingSettings
+	if creatorID, err := bson.ObjectIDFromHex(userID); err == nil {
+		prefs, err := models.GetPreferences(utils.GetPreferencesCollection(), creatorID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load preferences"})
+			return
+		}
+		if mediaMode == "" {
+			mediaMode = prefs.MeetingDefaults.MediaMode
+		}
+		settings = prefs.MeetingDefaults.Settings
+	}
+	req.Settings.apply(&settings)
+
+	if !checkHostTwoFactor(c, userID, settings) {
+		return
+	}
+
+	schedule, ok := parseSchedule(c, req.scheduleRequest, 0)
+	if !ok {
+		return
+	}
+	invitees, ok := parseInvitees(c, req.Invitees)
+	if !ok {
+		return
+	}
+	if len(invitees) > maxInvitationsPerMeeting {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Meetings can have at most 200 invitations"})
+		return
+	}
+	if !withinInvitationLimit(c, userID, len(invitees)) {
+		return
+	}
+	invitations, tokens := newInvitations(invitees, userID)
+
 	meeting := &models.Meeting{
 		Title:        req.Title,
 		Description:  req.Description,
+		MediaMode:    mediaMode,
+		Settings:     settings,
 		CreatedBy:    userID,
 		CreatorName:  userName,
+		WorkspaceID:  req.WorkspaceID,
 		Participants: []string{},
+		Schedule:     schedule,
+		Invitations:  invitations,
 	}
 
 	meetingsCollection := utils.GetMeetingsCollection()
@@ -52,15 +150,27 @@ func createMeeting(c *gin.Context) {
 		return
 	}
 
+	queueInvitations(meeting, tokens, userID, false)
+	go notifications.MeetingInvitations(meeting, invitees, userID, userName, false)
+	if err := jobs.ScheduleReminders(meeting); err != nil {
+		log.Printf("Error scheduling reminders for %s: %v", meeting.RoomID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Meeting created successfully",
-		"meeting": meeting,
+		"message":     "Meeting created successfully",
+		"meeting":     meeting,
+		"invitations": meetingInvitations(meeting),
 	})
 }
 
 func getMeeting(c *gin.Context) {
 	roomID := c.Param("roomId")
-	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+	userID, _, _, _, authenticated := middleware.GetUserFromContext(c)
+	if !authenticated {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+		return
+	}
+	guestRoomID, isGuest := middleware.GetGuestFromContext(c)
 
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -83,6 +193,20 @@ func getMeeting(c *gin.Context) {
 		return
 	}
 
+	// Guests only ever show up in attendance, not in the participants list
+	if isGuest {
+		if guestRoomID != roomID || !meeting.Settings.AllowGuests {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Guest access is not allowed for this meeting"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"meeting": meeting,
+			"message": "Successfully joined meeting",
+		})
+		return
+	}
+
 	err = models.AddParticipant(meetingsCollection, roomID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join meeting"})
@@ -112,12 +236,104 @@ func getUserMeetings(c *gin.Context) {
 	})
 }
 
+// endMeeting needs PermissionEndMeeting
 func endMeeting(c *gin.Context) {
-	roomID := c.Param("roomId")
+	meeting, _ := middleware.GetMeetingFromContext(c)
+	roomID := meeting.RoomID
+
+	err := models.DeactivateMeeting(utils.GetMeetingsCollection(), roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end meeting"})
+		return
+	}
+
+	if err := jobs.CancelMeetingJobs(roomID); err != nil {
+		log.Printf("Error cancelling jobs for meeting %s: %v", roomID, err)
+	}
+
+	meeting.IsActive = false
+	models.PublishEvent(models.Event{Type: models.EventMeetingEnded, RoomID: roomID, Meeting: meeting})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Meeting ended successfully",
+		"room_id": roomID,
+	})
+}
+
+// updateMeetingSettings needs PermissionEditSettings
+func updateMeetingSettings(c *gin.Context) {
 	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+	meeting, _ := middleware.GetMeetingFromContext(c)
 
-	if roomID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
+	var patch meetingSettingsPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Settings the request leaves out keep their current values
+	settings := meeting.Settings
+	patch.apply(&settings)
+
+	// The requirement protects the host's account, so co-hosts who can edit
+	// the other settings still can't lift it
+	if meeting.Settings.RequireHost2FA && !settings.RequireHost2FA && userID != meeting.CreatedBy {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the host can stop requiring two-factor authentication"})
+		return
+	}
+
+	if !checkHostTwoFactor(c, meeting.CreatedBy, settings) {
+		return
+	}
+
+	err := models.UpdateMeetingSettings(utils.GetMeetingsCollection(), meeting.RoomID, settings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Meeting settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// getMeetingAnalytics needs PermissionViewAnalytics
+func getMeetingAnalytics(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	analytics, err := models.GetMeetingAnalytics(utils.GetMeetingAnalyticsCollection(), roomID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			analytics = &models.MeetingAnalytics{RoomID: roomID, Participants: []models.ParticipantAnalytics{}}
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analytics"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"analytics": analytics,
+	})
+}
+
+// createGuest lets someone without an account into a meeting that allows
+// guests. The token it returns only works for this meeting.
+func createGuest(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Display name is required"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Display name must be between 1 and 64 characters"})
 		return
 	}
 
@@ -132,19 +348,47 @@ func endMeeting(c *gin.Context) {
 		return
 	}
 
-	if meeting.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only the meeting creator can end the meeting"})
+	if !meeting.IsActive {
+		c.JSON(http.StatusGone, gin.H{"error": "Meeting has ended"})
+		return
+	}
+
+	if !meeting.Settings.AllowGuests {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Guest access is not allowed for this meeting"})
 		return
 	}
 
-	err = models.DeactivateMeeting(meetingsCollection, roomID)
+	guestID := "guest_" + utils.GenerateOpaqueToken()[:16]
+	token, err := utils.GenerateGuestToken(guestID, name, roomID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end meeting"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"expires_in": int(utils.GuestTokenTTL.Seconds()),
+		"guest": gin.H{
+			"id":       guestID,
+			"name":     name,
+			"room_id":  roomID,
+			"is_guest": true,
+		},
+	})
+}
+
+// getMeetingAttendance needs PermissionViewAttendance
+func getMeetingAttendance(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	attendance, err := models.GetRoomAttendance(utils.GetAttendanceCollection(), roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attendance"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Meeting ended successfully",
-		"room_id": roomID,
+		"attendance": attendance,
+		"count":      len(attendance),
 	})
 }
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/notifications"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// getMeetingRoles returns the caller's own role and permissions along with
+// every role given out in the meeting
+func getMeetingRoles(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	meeting, err := models.FindMeetingByRoomID(utils.GetMeetingsCollection(), c.Param("roomId"))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meeting not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find meeting"})
+		}
+		return
+	}
+
+	role := utils.MeetingRole(userID, false, meeting)
+
+	roles := map[string]string{meeting.CreatedBy: models.MeetingRoleHost}
+	for id, r := range meeting.Roles {
+		roles[id] = r
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":        role,
+		"permissions": models.RolePermissions(role),
+		"roles":       roles,
+	})
+}
+
+// setMeetingRole promotes or demotes a participant. Nobody can hand out a
+// role as high as their own, so only hosts make co-hosts.
+func setMeetingRole(c *gin.Context, hub *websocket.Hub) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is required"})
+		return
+	}
+
+	changeMeetingRole(c, hub, req.Role)
+}
+
+// resetMeetingRole puts a participant back to attendee
+func resetMeetingRole(c *gin.Context, hub *websocket.Hub) {
+	changeMeetingRole(c, hub, models.MeetingRoleAttendee)
+}
+
+func changeMeetingRole(c *gin.Context, hub *websocket.Hub, role string) {
+	userID, _, userName, _, _ := middleware.GetUserFromContext(c)
+	meeting, callerRole := middleware.GetMeetingFromContext(c)
+	targetID := c.Param("userId")
+
+	switch role {
+	case models.MeetingRoleCoHost, models.MeetingRolePresenter, models.MeetingRoleAttendee:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be co-host, presenter or attendee"})
+		return
+	}
+
+	if targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't change your own role"})
+		return
+	}
+
+	if targetID == meeting.CreatedBy {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The host's role can't be changed"})
+		return
+	}
+
+	// Guests only live in their token, so there's nobody to store a role for
+	targetOID, err := bson.ObjectIDFromHex(targetID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if _, err := models.FindUserByID(utils.GetUsersCollection(), targetOID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user"})
+		}
+		return
+	}
+
+	callerRank := models.MeetingRoleRank(callerRole)
+	targetRole := utils.MeetingRole(targetID, false, meeting)
+	if models.MeetingRoleRank(role) >= callerRank || models.MeetingRoleRank(targetRole) >= callerRank {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't change the role of someone at or above your own"})
+		return
+	}
+
+	if err := models.SetMeetingRole(utils.GetMeetingsCollection(), meeting.RoomID, targetID, role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	hub.BroadcastRoleChange(meeting.RoomID, targetID, role, userID)
+	go notifications.RoleChanged(meeting, targetID, role, userName)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Role updated successfully",
+		"user_id":     targetID,
+		"role":        role,
+		"permissions": models.RolePermissions(role),
+	})
+}
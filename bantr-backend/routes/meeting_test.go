@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/drivertest"
+)
+
+// useMockDatabase points utils.Database at a deployment whose server replies
+// are scripted, one per command, in order
+func useMockDatabase(t *testing.T, replies ...bson.D) {
+	t.Helper()
+
+	deployment := drivertest.NewMockDeployment()
+	deployment.AddResponses(replies...)
+	opts := options.Client()
+	opts.Deployment = deployment
+
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		t.Fatalf("connecting to mock deployment: %v", err)
+	}
+
+	previous := utils.Database
+	utils.Database = client.Database("bantr_test")
+	t.Cleanup(func() { utils.Database = previous })
+}
+
+func findReply(ns string, docs ...interface{}) bson.D {
+	batch := bson.A{}
+	for _, doc := range docs {
+		batch = append(batch, doc)
+	}
+	return bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: int64(0)},
+			{Key: "ns", Value: ns},
+			{Key: "firstBatch", Value: batch},
+		}},
+	}
+}
+
+func updateReply(modified int) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: modified}, {Key: "nModified", Value: modified}}
+}
+
+// putMeetingSettings runs updateMeetingSettings as userID, with the context
+// AuthMiddleware and RequireMeetingPermission leave for it
+func putMeetingSettings(meeting *models.Meeting, userID, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/api/meetings/:roomId/settings", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("user_email", "")
+		c.Set("user_name", "")
+		c.Set("user_picture", "")
+		c.Set("meeting", meeting)
+		c.Set("meeting_role", meeting.RoleOf(userID, false))
+		updateMeetingSettings(c)
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/meetings/"+meeting.RoomID+"/settings", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestUpdateMeetingSettings(t *testing.T) {
+	hostID := bson.NewObjectID()
+	coHostID := bson.NewObjectID().Hex()
+	host := bson.D{
+		{Key: "_id", Value: hostID},
+		{Key: "two_factor", Value: bson.D{{Key: "enabled", Value: true}}},
+	}
+
+	tests := []struct {
+		name    string
+		current models.MeetingSettings
+		// asCoHost sends the update as a co-host instead of the host
+		asCoHost bool
+		body     string
+		replies  []bson.D
+		wantCode int
+		want     models.MeetingSettings
+	}{
+		{
+			name:     "other settings keep guests allowed",
+			current:  models.MeetingSettings{AllowGuests: true},
+			body:     `{"e2ee_required":true}`,
+			replies:  []bson.D{updateReply(1)},
+			wantCode: http.StatusOK,
+			want:     models.MeetingSettings{AllowGuests: true, E2EERequired: true},
+		},
+		{
+			name:     "guests turned off",
+			current:  models.MeetingSettings{AllowGuests: true, E2EERequired: true},
+			body:     `{"allow_guests":false}`,
+			replies:  []bson.D{updateReply(1)},
+			wantCode: http.StatusOK,
+			want:     models.MeetingSettings{E2EERequired: true},
+		},
+		{
+			name:     "empty update changes nothing",
+			current:  models.MeetingSettings{AllowGuests: true},
+			body:     `{}`,
+			replies:  []bson.D{updateReply(0)},
+			wantCode: http.StatusOK,
+			want:     models.MeetingSettings{AllowGuests: true},
+		},
+		{
+			name:     "other settings keep the 2FA requirement",
+			current:  models.MeetingSettings{RequireHost2FA: true, AllowGuests: true},
+			asCoHost: true,
+			body:     `{"e2ee_required":true}`,
+			replies:  []bson.D{findReply("bantr_test.users", host), updateReply(1)},
+			wantCode: http.StatusOK,
+			want:     models.MeetingSettings{RequireHost2FA: true, AllowGuests: true, E2EERequired: true},
+		},
+		{
+			name:     "host stops requiring 2FA",
+			current:  models.MeetingSettings{RequireHost2FA: true},
+			body:     `{"require_host_2fa":false}`,
+			replies:  []bson.D{updateReply(1)},
+			wantCode: http.StatusOK,
+			want:     models.MeetingSettings{},
+		},
+		{
+			name:     "co-host can't stop requiring 2FA",
+			current:  models.MeetingSettings{RequireHost2FA: true},
+			asCoHost: true,
+			body:     `{"require_host_2fa":false}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "host without 2FA can't turn it on",
+			current:  models.MeetingSettings{},
+			body:     `{"require_host_2fa":true}`,
+			replies:  []bson.D{findReply("bantr_test.users", bson.D{{Key: "_id", Value: hostID}})},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "invalid body",
+			current:  models.MeetingSettings{AllowGuests: true},
+			body:     `{"allow_guests":"yes"}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMockDatabase(t, tt.replies...)
+			meeting := &models.Meeting{
+				RoomID:    "abc-defg-hij",
+				CreatedBy: hostID.Hex(),
+				Roles:     map[string]string{coHostID: models.MeetingRoleCoHost},
+				Settings:  tt.current,
+			}
+
+			userID := meeting.CreatedBy
+			if tt.asCoHost {
+				userID = coHostID
+			}
+			recorder := putMeetingSettings(meeting, userID, tt.body)
+			if recorder.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantCode, recorder.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Settings models.MeetingSettings `json:"settings"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if response.Settings != tt.want {
+				t.Errorf("settings = %+v, want %+v", response.Settings, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/notifications"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Default and largest page sizes for the notification list
+const (
+	notificationsDefaultLimit = 20
+	notificationsMaxLimit     = 100
+)
+
+// NotificationRoutes is the notification center. New notifications are
+// also pushed over the websocket to connections that subscribed.
+func NotificationRoutes(router *gin.Engine) {
+	notificationGroup := router.Group("/api/notifications")
+	notificationGroup.Use(middleware.AuthMiddleware())
+	{
+		notificationGroup.GET("", getNotifications)
+
+		notificationGroup.POST("/read-all", markAllNotificationsRead)
+
+		notificationGroup.POST("/:id/read", markNotificationRead)
+	}
+}
+
+// getNotifications lists the user's notifications, newest first. Pages
+// start at 1, and unread=true leaves out the ones already read.
+func getNotifications(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(notificationsDefaultLimit)))
+	if err != nil || limit < 1 || limit > notificationsMaxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+		return
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	collection := utils.GetNotificationsCollection()
+	list, total, err := models.GetUserNotifications(collection, userID, unreadOnly, int64((page-1)*limit), int64(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	unread, err := models.CountUnreadNotifications(collection, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": list,
+		"total":         total,
+		"unread_count":  unread,
+		"page":          page,
+		"limit":         limit,
+		"has_more":      int64(page*limit) < total,
+	})
+}
+
+func markNotificationRead(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	notificationID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	notification, err := models.MarkNotificationRead(utils.GetNotificationsCollection(), notificationID, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification read"})
+		}
+		return
+	}
+
+	notifications.Read(userID, []string{notification.ID.Hex()}, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Notification marked read",
+		"notification": notification,
+	})
+}
+
+func markAllNotificationsRead(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	count, err := models.MarkAllNotificationsRead(utils.GetNotificationsCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	if count > 0 {
+		notifications.Read(userID, nil, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notifications marked read",
+		"marked":  count,
+	})
+}
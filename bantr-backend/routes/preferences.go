@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// Embed the zone database so time zones validate even on hosts
+	// without one
+	_ "time/tzdata"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// localePattern loosely matches BCP 47 tags like "en", "pt-BR" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8}){0,3}$`)
+
+func getPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	prefs, err := models.GetPreferences(utils.GetPreferencesCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// updatePreferences changes only the preferences present in the request
+func updatePreferences(c *gin.Context) {
+	var req struct {
+		MicOnJoin     *bool   `json:"mic_on_join"`
+		CameraOnJoin  *bool   `json:"camera_on_join"`
+		DisplayName   *string `json:"display_name"`
+		TimeZone      *string `json:"time_zone"`
+		Locale        *string `json:"locale"`
+		Notifications *struct {
+			MeetingInvites   *bool `json:"meeting_invites"`
+			MeetingReminders *bool `json:"meeting_reminders"`
+			RecordingReady   *bool `json:"recording_ready"`
+			ProductUpdates   *bool `json:"product_updates"`
+		} `json:"notifications"`
+		MeetingDefaults *struct {
+			MediaMode *string               `json:"media_mode"`
+			Settings  *meetingSettingsPatch `json:"settings"`
+		} `json:"meeting_defaults"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	collection := utils.GetPreferencesCollection()
+	prefs, err := models.GetPreferences(collection, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load preferences"})
+		return
+	}
+
+	setBool(&prefs.MicOnJoin, req.MicOnJoin)
+	setBool(&prefs.CameraOnJoin, req.CameraOnJoin)
+
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(displayName) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Display name must be at most 64 characters"})
+			return
+		}
+		prefs.DisplayName = displayName
+	}
+
+	if req.TimeZone != nil {
+		// LoadLocation treats "" and "Local" specially, neither of which
+		// means anything for another user's browser
+		if *req.TimeZone == "" || *req.TimeZone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+			return
+		}
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+			return
+		}
+		prefs.TimeZone = *req.TimeZone
+	}
+
+	if req.Locale != nil {
+		if !localePattern.MatchString(*req.Locale) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale"})
+			return
+		}
+		prefs.Locale = *req.Locale
+	}
+
+	if n := req.Notifications; n != nil {
+		setBool(&prefs.Notifications.MeetingInvites, n.MeetingInvites)
+		setBool(&prefs.Notifications.MeetingReminders, n.MeetingReminders)
+		setBool(&prefs.Notifications.RecordingReady, n.RecordingReady)
+		setBool(&prefs.Notifications.ProductUpdates, n.ProductUpdates)
+	}
+
+	if d := req.MeetingDefaults; d != nil {
+		if d.MediaMode != nil {
+			if !models.IsValidMediaMode(*d.MediaMode) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Media mode must be either mesh or sfu"})
+				return
+			}
+			prefs.MeetingDefaults.MediaMode = *d.MediaMode
+		}
+		d.Settings.apply(&prefs.MeetingDefaults.Settings)
+	}
+
+	if err := models.SavePreferences(collection, prefs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Preferences updated successfully",
+		"preferences": prefs,
+	})
+}
+
+// meetingSettingsPatch is MeetingSettings with every field optional, so we
+// can tell a false apart from a field that was left out
+type meetingSettingsPatch struct {
+	E2EERequired   *bool `json:"e2ee_required"`
+	AllowGuests    *bool `json:"allow_guests"`
+	RequireHost2FA *bool `json:"require_host_2fa"`
+}
+
+func (p *meetingSettingsPatch) apply(settings *models.MeetingSettings) {
+	if p == nil {
+		return
+	}
+	setBool(&settings.E2EERequired, p.E2EERequired)
+	setBool(&settings.AllowGuests, p.AllowGuests)
+	setBool(&settings.RequireHost2FA, p.RequireHost2FA)
+}
+
+func setBool(dst *bool, value *bool) {
+	if value != nil {
+		*dst = *value
+	}
+}
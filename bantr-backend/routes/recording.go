@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func RecordingRoutes(router *gin.Engine) {
+	recordingGroup := router.Group("/api")
+	recordingGroup.Use(middleware.AuthMiddleware())
+	{
+		recordingGroup.GET("/meetings/:roomId/recordings", middleware.RequireMeetingPermission(models.PermissionRecord), getMeetingRecordings)
+
+		recordingGroup.GET("/recordings/:id/download", downloadRecording)
+	}
+}
+
+// getMeetingRecordings needs PermissionRecord
+func getMeetingRecordings(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	recordings, err := models.GetRoomRecordings(utils.GetRecordingsCollection(), roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recordings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recordings": recordings,
+		"count":      len(recordings),
+	})
+}
+
+func downloadRecording(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	recordingID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording ID"})
+		return
+	}
+
+	recording, err := models.FindRecordingByID(utils.GetRecordingsCollection(), recordingID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find recording"})
+		}
+		return
+	}
+
+	meeting, err := models.FindMeetingByRoomID(utils.GetMeetingsCollection(), recording.RoomID)
+	if err != nil || !utils.HasMeetingPermission(userID, false, meeting, models.PermissionRecord) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access recordings"})
+		return
+	}
+
+	if recording.EndedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Recording is still in progress"})
+		return
+	}
+
+	c.FileAttachment(recording.FilePath, recording.FileName)
+}
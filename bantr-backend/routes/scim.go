@@ -0,0 +1,603 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// SCIMRoutes lets an identity provider provision users and sync groups,
+// which map to workspaces. Each workspace issues its own token, which only
+// reaches that workspace and the users on its verified domains. Only the
+// parts of SCIM 2.0 that providers use in practice are here: no bulk,
+// sorting or complex filters.
+func SCIMRoutes(router *gin.Engine, hub *websocket.Hub) {
+	scimGroup := router.Group("/scim/v2")
+	scimGroup.Use(middleware.SCIMAuthMiddleware())
+	{
+		scimGroup.GET("/Users", listSCIMUsers)
+
+		scimGroup.POST("/Users", createSCIMUser)
+
+		scimGroup.GET("/Users/:id", getSCIMUser)
+
+		scimGroup.PUT("/Users/:id", func(c *gin.Context) {
+			replaceSCIMUser(c, hub)
+		})
+
+		scimGroup.PATCH("/Users/:id", func(c *gin.Context) {
+			patchSCIMUser(c, hub)
+		})
+
+		scimGroup.DELETE("/Users/:id", func(c *gin.Context) {
+			deleteSCIMUser(c, hub)
+		})
+
+		scimGroup.GET("/Groups", listSCIMGroups)
+
+		scimGroup.POST("/Groups", createSCIMGroup)
+
+		scimGroup.GET("/Groups/:id", getSCIMGroup)
+
+		scimGroup.PUT("/Groups/:id", replaceSCIMGroup)
+
+		scimGroup.PATCH("/Groups/:id", patchSCIMGroup)
+
+		scimGroup.DELETE("/Groups/:id", deleteSCIMGroup)
+	}
+}
+
+// Default and largest page sizes for list requests
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+const scimDomainDetail = "userName must be on one of the workspace's verified domains"
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// scimUser is a user as SCIM sees it. userName is the user's email, which
+// is also how they are matched when they first sign in.
+type scimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *scimName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []scimEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Meta        *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{utils.SCIMSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func scimLocation(resource, id string) string {
+	return utils.BackendURL() + "/scim/v2/" + resource + "/" + id
+}
+
+// scimListResponse wraps a page of resources. SCIM pages start at 1.
+func scimListResponse(resources interface{}, total int64, startIndex, count int) gin.H {
+	return gin.H{
+		"schemas":      []string{utils.SCIMSchemaListResponse},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": count,
+		"Resources":    resources,
+	}
+}
+
+// scimPage reads startIndex and count from the query
+func scimPage(c *gin.Context) (startIndex, count int) {
+	startIndex, err := strconv.Atoi(c.Query("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(scimDefaultCount)))
+	if err != nil || count < 0 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func toSCIMUser(user *models.User) scimUser {
+	active := !user.Deactivated
+	id := user.ID.Hex()
+
+	return scimUser{
+		Schemas:     []string{utils.SCIMSchemaUser},
+		ID:          id,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		Name:        &scimName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []scimEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimLocation("Users", id),
+		},
+	}
+}
+
+// scimUserFilter turns a SCIM filter into a users query, limited to the
+// users the workspace's provider manages
+func scimUserFilter(workspace *models.Workspace, filter string) (bson.M, error) {
+	// Bots belong to whoever made them, not to the identity provider
+	query := bson.M{"is_bot": bson.M{"$ne": true}}
+	if filter == "" {
+		return scopeSCIMUsers(workspace, query), nil
+	}
+
+	conditions, err := utils.ParseSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, condition := range conditions {
+		switch condition.Attribute {
+		case "id":
+			id, err := bson.ObjectIDFromHex(condition.Value)
+			if err != nil {
+				// Nothing can match, but that isn't the caller's mistake
+				id = bson.NilObjectID
+			}
+			query["_id"] = id
+		case "username", "emails.value", "emails":
+			query["email"] = strings.ToLower(condition.Value)
+		case "externalid":
+			query["external_id"] = condition.Value
+		case "displayname":
+			query["name"] = condition.Value
+		case "active":
+			if strings.EqualFold(condition.Value, "false") {
+				query["deactivated"] = true
+			} else {
+				query["deactivated"] = bson.M{"$ne": true}
+			}
+		default:
+			return nil, utils.ErrInvalidSCIMFilter
+		}
+	}
+
+	return scopeSCIMUsers(workspace, query), nil
+}
+
+// scopeSCIMUsers limits a users query to emails on the workspace's verified
+// domains
+func scopeSCIMUsers(workspace *models.Workspace, query bson.M) bson.M {
+	nothing := bson.M{"$in": bson.A{}}
+
+	if email, ok := query["email"].(string); ok {
+		if !utils.SCIMManagesEmail(workspace, email) {
+			query["email"] = nothing
+		}
+		return query
+	}
+
+	if len(workspace.Domains) == 0 {
+		query["email"] = nothing
+		return query
+	}
+	domains := make([]string, 0, len(workspace.Domains))
+	for _, domain := range workspace.Domains {
+		domains = append(domains, regexp.QuoteMeta(domain))
+	}
+	query["email"] = bson.M{"$regex": "@(" + strings.Join(domains, "|") + ")$"}
+	return query
+}
+
+func listSCIMUsers(c *gin.Context) {
+	filter, err := scimUserFilter(middleware.GetSCIMWorkspaceFromContext(c), c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", "Only eq filters joined with and are supported")
+		return
+	}
+
+	startIndex, count := scimPage(c)
+	users, total, err := models.ListUsers(utils.GetUsersCollection(), filter, int64(startIndex-1), int64(count))
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to list users")
+		return
+	}
+
+	resources := make([]scimUser, 0, len(users))
+	for i := range users {
+		resources = append(resources, toSCIMUser(&users[i]))
+	}
+
+	scimJSON(c, http.StatusOK, scimListResponse(resources, total, startIndex, len(resources)))
+}
+
+// findSCIMUser loads the user in the :id param, answering with a SCIM
+// error if there isn't one the workspace's provider manages
+func findSCIMUser(c *gin.Context) (*models.User, bool) {
+	id, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+
+	user, err := models.FindUserByID(utils.GetUsersCollection(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			scimError(c, http.StatusNotFound, "", "User not found")
+		} else {
+			scimError(c, http.StatusInternalServerError, "", "Failed to find user")
+		}
+		return nil, false
+	}
+	if user.IsBot || !utils.SCIMManagesEmail(middleware.GetSCIMWorkspaceFromContext(c), user.Email) {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func getSCIMUser(c *gin.Context) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(user))
+}
+
+// scimDisplayName picks the best name a SCIM user resource offers
+func scimDisplayName(resource scimUser) string {
+	if name := strings.TrimSpace(resource.DisplayName); name != "" {
+		return name
+	}
+	if resource.Name != nil {
+		if name := strings.TrimSpace(resource.Name.Formatted); name != "" {
+			return name
+		}
+		if name := strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	return strings.Split(resource.UserName, "@")[0]
+}
+
+func normalizeSCIMUserName(userName string) (string, bool) {
+	email := strings.ToLower(strings.TrimSpace(userName))
+	return email, strings.Contains(email, "@")
+}
+
+func createSCIMUser(c *gin.Context) {
+	var resource scimUser
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid user")
+		return
+	}
+
+	email, ok := normalizeSCIMUserName(resource.UserName)
+	if !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+		return
+	}
+	if !utils.SCIMManagesEmail(middleware.GetSCIMWorkspaceFromContext(c), email) {
+		scimError(c, http.StatusBadRequest, "invalidValue", scimDomainDetail)
+		return
+	}
+
+	usersCollection := utils.GetUsersCollection()
+	if _, err := models.FindUserByEmail(usersCollection, email); err == nil {
+		scimError(c, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+		return
+	} else if err != mongo.ErrNoDocuments {
+		scimError(c, http.StatusInternalServerError, "", "Failed to check for existing user")
+		return
+	}
+
+	resource.UserName = email
+	user := &models.User{
+		Name:       scimDisplayName(resource),
+		Email:      email,
+		ExternalID: resource.ExternalID,
+	}
+	if resource.Active != nil && !*resource.Active {
+		now := time.Now()
+		user.Deactivated = true
+		user.DeactivatedAt = &now
+	}
+
+	if err := models.CreateUser(usersCollection, user); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to create user")
+		return
+	}
+
+	c.Header("Location", scimLocation("Users", user.ID.Hex()))
+	scimJSON(c, http.StatusCreated, toSCIMUser(user))
+}
+
+func replaceSCIMUser(c *gin.Context, hub *websocket.Hub) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	var resource scimUser
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid user")
+		return
+	}
+
+	updated := *user
+	updated.Email = resource.UserName
+	updated.Name = scimDisplayName(resource)
+	updated.ExternalID = resource.ExternalID
+	active := resource.Active == nil || *resource.Active
+
+	saveSCIMUser(c, hub, user, updated, active)
+}
+
+func patchSCIMUser(c *gin.Context, hub *websocket.Hub) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Operations) == 0 {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid patch request")
+		return
+	}
+
+	updated := *user
+	active := !user.Deactivated
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if err := applySCIMUserPatch(&updated, &active, op.Path, op.Value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		case "remove":
+			if strings.EqualFold(op.Path, "externalId") {
+				updated.ExternalID = ""
+			}
+		default:
+			scimError(c, http.StatusBadRequest, "invalidSyntax", "Unsupported patch operation "+op.Op)
+			return
+		}
+	}
+
+	saveSCIMUser(c, hub, user, updated, active)
+}
+
+// applySCIMUserPatch sets one attribute from a PATCH operation. Without a
+// path the value is an object of attributes. Attributes we don't store are
+// ignored, which is what providers expect.
+func applySCIMUserPatch(user *models.User, active *bool, path string, value json.RawMessage) error {
+	switch strings.ToLower(path) {
+	case "":
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attributes); err != nil {
+			return invalidSCIMValue("value")
+		}
+		for name, attribute := range attributes {
+			if err := applySCIMUserPatch(user, active, name, attribute); err != nil {
+				return err
+			}
+		}
+	case "active":
+		b, err := parseSCIMBool(value)
+		if err != nil {
+			return invalidSCIMValue(path)
+		}
+		*active = b
+	case "username":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return invalidSCIMValue(path)
+		}
+		user.Email = s
+	case "displayname", "name.formatted":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return invalidSCIMValue(path)
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			user.Name = s
+		}
+	case "name.givenname", "name.familyname":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return invalidSCIMValue(path)
+		}
+		given, family := splitName(user.Name)
+		if strings.EqualFold(path, "name.givenName") {
+			given = s
+		} else {
+			family = s
+		}
+		if name := strings.TrimSpace(given + " " + family); name != "" {
+			user.Name = name
+		}
+	case "name":
+		var name scimName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return invalidSCIMValue(path)
+		}
+		if formatted := scimDisplayName(scimUser{Name: &name}); formatted != "" {
+			user.Name = formatted
+		}
+	case "externalid":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return invalidSCIMValue(path)
+		}
+		user.ExternalID = s
+	}
+	return nil
+}
+
+func invalidSCIMValue(attribute string) error {
+	return fmt.Errorf("Invalid value for %s", attribute)
+}
+
+// parseSCIMBool accepts real booleans as well as the "True" and "False"
+// strings some providers send
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// splitName splits a full name at the first space
+func splitName(name string) (given, family string) {
+	given, family, _ = strings.Cut(strings.TrimSpace(name), " ")
+	return given, family
+}
+
+// saveSCIMUser stores the result of a PUT or PATCH. Deactivating a user ends
+// their sessions and drops them from any meeting they're in.
+func saveSCIMUser(c *gin.Context, hub *websocket.Hub, before *models.User, after models.User, active bool) {
+	email, ok := normalizeSCIMUserName(after.Email)
+	if !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+		return
+	}
+	if !utils.SCIMManagesEmail(middleware.GetSCIMWorkspaceFromContext(c), email) {
+		scimError(c, http.StatusBadRequest, "invalidValue", scimDomainDetail)
+		return
+	}
+	after.Email = email
+
+	usersCollection := utils.GetUsersCollection()
+	if email != before.Email {
+		existing, err := models.FindUserByEmail(usersCollection, email)
+		if err == nil && existing.ID != before.ID {
+			scimError(c, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+			return
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			scimError(c, http.StatusInternalServerError, "", "Failed to check for existing user")
+			return
+		}
+	}
+
+	if err := models.UpdateProvisionedUser(usersCollection, &after); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to update user")
+		return
+	}
+
+	if active == before.Deactivated {
+		if err := setUserActive(hub, before.ID, active); err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to update user")
+			return
+		}
+	}
+
+	user, err := models.FindUserByID(usersCollection, before.ID)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to load user")
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(user))
+}
+
+func setUserActive(hub *websocket.Hub, userID bson.ObjectID, active bool) error {
+	if err := models.SetUserDeactivated(utils.GetUsersCollection(), userID, !active); err != nil {
+		return err
+	}
+	if active {
+		return nil
+	}
+
+	if err := utils.RevokeUserSessions(userID.Hex()); err != nil {
+		return err
+	}
+	hub.DisconnectUser(userID.Hex())
+	return nil
+}
+
+// deleteSCIMUser deactivates rather than erases, so the meetings and
+// recordings of someone who was offboarded stay around for their colleagues.
+// A later PUT or PATCH with active set brings them back.
+func deleteSCIMUser(c *gin.Context, hub *websocket.Hub) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.Deactivated {
+		if err := setUserActive(hub, user.ID, false); err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to deactivate user")
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
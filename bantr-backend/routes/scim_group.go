@@ -0,0 +1,557 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// scimGroup is a workspace as SCIM sees it. Members the provider adds join
+// as plain members. Roles given out in the app are left alone, and so are
+// members off the workspace's verified domains, which the provider doesn't
+// see.
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members,omitempty"`
+	Meta        *scimMeta    `json:"meta,omitempty"`
+}
+
+// toSCIMGroup builds the SCIM view of a workspace. Members are only looked
+// up when withMembers is set, since providers often leave them out of lists.
+func toSCIMGroup(workspace *models.Workspace, withMembers bool) (scimGroup, error) {
+	id := workspace.ID.Hex()
+	group := scimGroup{
+		Schemas:     []string{utils.SCIMSchemaGroup},
+		ID:          id,
+		ExternalID:  workspace.ExternalID,
+		DisplayName: workspace.Name,
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      workspace.CreatedAt,
+			LastModified: workspace.UpdatedAt,
+			Location:     scimLocation("Groups", id),
+		},
+	}
+	if !withMembers {
+		return group, nil
+	}
+
+	members, err := models.GetWorkspaceMembers(utils.GetWorkspaceMembersCollection(), workspace.ID)
+	if err != nil {
+		return group, err
+	}
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+	users, err := scimManagedUsers(workspace, userIDs)
+	if err != nil {
+		return group, err
+	}
+
+	group.Members = make([]scimMember, 0, len(users))
+	for _, member := range members {
+		user, ok := users[member.UserID]
+		if !ok {
+			continue
+		}
+		group.Members = append(group.Members, scimMember{
+			Value:   member.UserID,
+			Display: user.Name,
+			Ref:     scimLocation("Users", member.UserID),
+		})
+	}
+	return group, nil
+}
+
+// scimManagedUsers looks up the users the workspace's provider manages out
+// of userIDs, keyed by ID. IDs that aren't valid are skipped.
+func scimManagedUsers(workspace *models.Workspace, userIDs []string) (map[string]models.User, error) {
+	ids := make([]bson.ObjectID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if oid, err := bson.ObjectIDFromHex(userID); err == nil {
+			ids = append(ids, oid)
+		}
+	}
+
+	users, err := models.FindUsersByIDs(utils.GetUsersCollection(), ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, user := range users {
+		if user.IsBot || !utils.SCIMManagesEmail(workspace, user.Email) {
+			delete(users, id)
+		}
+	}
+	return users, nil
+}
+
+// scimGroupFilter turns a SCIM filter into a workspaces query. The only
+// group a token can see is its own workspace.
+func scimGroupFilter(workspace *models.Workspace, filter string) (bson.M, error) {
+	query := bson.M{"_id": workspace.ID}
+	if filter == "" {
+		return query, nil
+	}
+
+	conditions, err := utils.ParseSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, condition := range conditions {
+		switch condition.Attribute {
+		case "id":
+			id, err := bson.ObjectIDFromHex(condition.Value)
+			if err != nil || id != workspace.ID {
+				id = bson.NilObjectID
+			}
+			query["_id"] = id
+		case "displayname":
+			query["name"] = condition.Value
+		case "externalid":
+			query["external_id"] = condition.Value
+		default:
+			return nil, utils.ErrInvalidSCIMFilter
+		}
+	}
+
+	return query, nil
+}
+
+// excludesMembers reports whether the request asked to leave members out
+func excludesMembers(c *gin.Context) bool {
+	for _, attribute := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func listSCIMGroups(c *gin.Context) {
+	filter, err := scimGroupFilter(middleware.GetSCIMWorkspaceFromContext(c), c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", "Only eq filters joined with and are supported")
+		return
+	}
+
+	startIndex, count := scimPage(c)
+	workspaces, total, err := models.ListWorkspaces(utils.GetWorkspacesCollection(), filter, int64(startIndex-1), int64(count))
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to list groups")
+		return
+	}
+
+	withMembers := !excludesMembers(c)
+	resources := make([]scimGroup, 0, len(workspaces))
+	for i := range workspaces {
+		group, err := toSCIMGroup(&workspaces[i], withMembers)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to load group members")
+			return
+		}
+		resources = append(resources, group)
+	}
+
+	scimJSON(c, http.StatusOK, scimListResponse(resources, total, startIndex, len(resources)))
+}
+
+// findSCIMGroup loads the workspace in the :id param, answering with a SCIM
+// error unless it's the one the token belongs to
+func findSCIMGroup(c *gin.Context) (*models.Workspace, bool) {
+	id, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil || id != middleware.GetSCIMWorkspaceFromContext(c).ID {
+		scimError(c, http.StatusNotFound, "", "Group not found")
+		return nil, false
+	}
+
+	workspace, err := models.FindWorkspaceByID(utils.GetWorkspacesCollection(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			scimError(c, http.StatusNotFound, "", "Group not found")
+		} else {
+			scimError(c, http.StatusInternalServerError, "", "Failed to find group")
+		}
+		return nil, false
+	}
+
+	return workspace, true
+}
+
+// respondSCIMGroup reloads a workspace after a change and sends it back
+func respondSCIMGroup(c *gin.Context, status int, id bson.ObjectID) {
+	workspace, err := models.FindWorkspaceByID(utils.GetWorkspacesCollection(), id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to load group")
+		return
+	}
+
+	group, err := toSCIMGroup(workspace, !excludesMembers(c))
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to load group members")
+		return
+	}
+
+	scimJSON(c, status, group)
+}
+
+func getSCIMGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	respondSCIMGroup(c, http.StatusOK, workspace.ID)
+}
+
+// scimMemberIDs checks that every member in a request is a user the
+// workspace's provider manages
+func scimMemberIDs(workspace *models.Workspace, members []scimMember) ([]string, bool, error) {
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.Value)
+	}
+
+	users, err := scimManagedUsers(workspace, userIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, userID := range userIDs {
+		if _, ok := users[userID]; !ok {
+			return nil, false, nil
+		}
+	}
+	return userIDs, true, nil
+}
+
+// createSCIMGroup links the token's workspace to the provider's group, since
+// that's the one group the token can manage
+func createSCIMGroup(c *gin.Context) {
+	workspace := middleware.GetSCIMWorkspaceFromContext(c)
+
+	var resource scimGroup
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid group")
+		return
+	}
+
+	name := strings.TrimSpace(resource.DisplayName)
+	if name == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	if workspace.ExternalID != "" && workspace.ExternalID != resource.ExternalID {
+		scimError(c, http.StatusConflict, "uniqueness", "The workspace is already linked to a group")
+		return
+	}
+
+	userIDs, ok, err := scimMemberIDs(workspace, resource.Members)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to check members")
+		return
+	}
+	if !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", scimMemberDetail)
+		return
+	}
+
+	workspace.Name = name
+	workspace.ExternalID = resource.ExternalID
+	if err := models.UpdateWorkspace(utils.GetWorkspacesCollection(), workspace); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to create group")
+		return
+	}
+
+	if err := addSCIMMembers(workspace.ID, userIDs); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to add members")
+		return
+	}
+
+	c.Header("Location", scimLocation("Groups", workspace.ID.Hex()))
+	respondSCIMGroup(c, http.StatusCreated, workspace.ID)
+}
+
+func addSCIMMembers(workspaceID bson.ObjectID, userIDs []string) error {
+	membersCollection := utils.GetWorkspaceMembersCollection()
+	for _, userID := range userIDs {
+		err := models.AddWorkspaceMember(membersCollection, &models.WorkspaceMember{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        models.WorkspaceRoleMember,
+		})
+		if err != nil && err != models.ErrAlreadyMember {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSCIMMembers removes the members the provider manages out of userIDs
+func removeSCIMMembers(workspace *models.Workspace, userIDs []string) error {
+	users, err := scimManagedUsers(workspace, userIDs)
+	if err != nil {
+		return err
+	}
+
+	membersCollection := utils.GetWorkspaceMembersCollection()
+	for userID := range users {
+		err := models.RemoveWorkspaceMember(membersCollection, workspace.ID, userID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncSCIMMembers makes the workspace's members the provider manages
+// exactly userIDs
+func syncSCIMMembers(workspace *models.Workspace, userIDs []string) error {
+	members, err := models.GetWorkspaceMembers(utils.GetWorkspaceMembersCollection(), workspace.ID)
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for _, member := range members {
+		if !containsString(userIDs, member.UserID) {
+			removed = append(removed, member.UserID)
+		}
+	}
+
+	if err := addSCIMMembers(workspace.ID, userIDs); err != nil {
+		return err
+	}
+	return removeSCIMMembers(workspace, removed)
+}
+
+const scimMemberDetail = "Every member must be a user on the workspace's verified domains"
+
+var (
+	errUnknownSCIMMember = errors.New("member is not a user the workspace manages")
+	errUnsupportedSCIMOp = errors.New("unsupported patch operation")
+)
+
+// respondSCIMMemberError turns a failed membership change into a SCIM error
+func respondSCIMMemberError(c *gin.Context, err error) {
+	switch err {
+	case models.ErrLastOwner:
+		scimError(c, http.StatusBadRequest, "mutability", "The workspace's last owner can't be removed")
+		return
+	case errUnknownSCIMMember:
+		scimError(c, http.StatusBadRequest, "invalidValue", scimMemberDetail)
+		return
+	case errUnsupportedSCIMOp:
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Unsupported patch operation")
+		return
+	}
+	scimError(c, http.StatusInternalServerError, "", "Failed to update members")
+}
+
+func replaceSCIMGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	var resource scimGroup
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid group")
+		return
+	}
+
+	name := strings.TrimSpace(resource.DisplayName)
+	if name == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	userIDs, ok, err := scimMemberIDs(workspace, resource.Members)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to check members")
+		return
+	}
+	if !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", scimMemberDetail)
+		return
+	}
+
+	workspace.Name = name
+	workspace.ExternalID = resource.ExternalID
+	if err := models.UpdateWorkspace(utils.GetWorkspacesCollection(), workspace); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to update group")
+		return
+	}
+
+	if err := syncSCIMMembers(workspace, userIDs); err != nil {
+		respondSCIMMemberError(c, err)
+		return
+	}
+
+	respondSCIMGroup(c, http.StatusOK, workspace.ID)
+}
+
+// patchSCIMGroup handles renames and member changes. Providers remove a
+// single member with a path like members[value eq "<id>"].
+func patchSCIMGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Operations) == 0 {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid patch request")
+		return
+	}
+
+	renamed := false
+	for _, op := range req.Operations {
+		path := strings.TrimSpace(op.Path)
+		lowerPath := strings.ToLower(path)
+
+		var err error
+		switch {
+		case strings.HasPrefix(lowerPath, "members["):
+			if !strings.EqualFold(op.Op, "remove") {
+				scimError(c, http.StatusBadRequest, "invalidPath", "Only remove is supported on a member filter")
+				return
+			}
+			conditions, filterErr := utils.ParseSCIMFilter(strings.TrimSuffix(path[len("members["):], "]"))
+			if filterErr != nil || len(conditions) != 1 || conditions[0].Attribute != "value" {
+				scimError(c, http.StatusBadRequest, "invalidFilter", "Unsupported member filter")
+				return
+			}
+			err = removeSCIMMembers(workspace, []string{conditions[0].Value})
+
+		case lowerPath == "members":
+			var members []scimMember
+			if len(op.Value) > 0 {
+				if json.Unmarshal(op.Value, &members) != nil {
+					scimError(c, http.StatusBadRequest, "invalidValue", "Invalid value for members")
+					return
+				}
+			}
+			err = patchSCIMMembers(workspace, strings.ToLower(op.Op), members)
+
+		case lowerPath == "" || lowerPath == "displayname" || lowerPath == "externalid":
+			if strings.EqualFold(op.Op, "remove") {
+				scimError(c, http.StatusBadRequest, "mutability", "Only members can be removed")
+				return
+			}
+			var changes scimGroup
+			if lowerPath == "" {
+				if json.Unmarshal(op.Value, &changes) != nil {
+					scimError(c, http.StatusBadRequest, "invalidValue", "Invalid value")
+					return
+				}
+				if len(changes.Members) > 0 {
+					err = patchSCIMMembers(workspace, strings.ToLower(op.Op), changes.Members)
+				}
+			} else {
+				var s string
+				if json.Unmarshal(op.Value, &s) != nil {
+					scimError(c, http.StatusBadRequest, "invalidValue", "Invalid value for "+path)
+					return
+				}
+				if lowerPath == "displayname" {
+					changes.DisplayName = s
+				} else {
+					changes.ExternalID = s
+				}
+			}
+			if name := strings.TrimSpace(changes.DisplayName); name != "" {
+				workspace.Name = name
+				renamed = true
+			}
+			if changes.ExternalID != "" {
+				workspace.ExternalID = changes.ExternalID
+				renamed = true
+			}
+
+		default:
+			scimError(c, http.StatusBadRequest, "invalidPath", "Unsupported path "+path)
+			return
+		}
+
+		if err != nil {
+			respondSCIMMemberError(c, err)
+			return
+		}
+	}
+
+	if renamed {
+		if err := models.UpdateWorkspace(utils.GetWorkspacesCollection(), workspace); err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to update group")
+			return
+		}
+	}
+
+	respondSCIMGroup(c, http.StatusOK, workspace.ID)
+}
+
+// patchSCIMMembers adds, removes or replaces members
+func patchSCIMMembers(workspace *models.Workspace, op string, members []scimMember) error {
+	// Removing without a value clears the workspace
+	if op == "remove" && len(members) == 0 {
+		return syncSCIMMembers(workspace, nil)
+	}
+
+	userIDs, ok, err := scimMemberIDs(workspace, members)
+	if err != nil {
+		return err
+	}
+	if !ok && op != "remove" {
+		return errUnknownSCIMMember
+	}
+
+	switch op {
+	case "add":
+		return addSCIMMembers(workspace.ID, userIDs)
+	case "replace":
+		return syncSCIMMembers(workspace, userIDs)
+	case "remove":
+		ids := make([]string, 0, len(members))
+		for _, member := range members {
+			ids = append(ids, member.Value)
+		}
+		return removeSCIMMembers(workspace, ids)
+	}
+
+	return errUnsupportedSCIMOp
+}
+
+// deleteSCIMGroup unlinks the workspace from the provider's group. The
+// workspace itself stays, since only its owners can delete it.
+func deleteSCIMGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	workspace.ExternalID = ""
+	if err := models.UpdateWorkspace(utils.GetWorkspacesCollection(), workspace); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to delete group")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
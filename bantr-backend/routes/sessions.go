@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// listSessions shows the devices the user is signed in on. Last seen is when
+// the device last refreshed its access token.
+func listSessions(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+	currentSessionID, _, _ := middleware.GetSessionFromContext(c)
+
+	sessions, err := models.GetUserSessions(utils.GetSessionsCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sessions"})
+		return
+	}
+
+	now := time.Now()
+	devices := []gin.H{}
+	for _, session := range sessions {
+		if session.RevokedAt != nil || session.ExpiresAt.Before(now) {
+			continue
+		}
+		devices = append(devices, gin.H{
+			"id":           session.ID.Hex(),
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastUsedAt,
+			"current":      session.ID.Hex() == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": devices})
+}
+
+// revokeUserSession signs one of the user's devices out. Its tokens stop
+// working straight away and any meeting it's in is disconnected.
+func revokeUserSession(c *gin.Context, hub *websocket.Hub) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	id, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	session, err := models.FindSessionByID(utils.GetSessionsCollection(), id)
+	if err == mongo.ErrNoDocuments || (err == nil && session.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load session"})
+		return
+	}
+
+	sessionID := session.ID.Hex()
+	if err := utils.RevokeSession(sessionID); err != nil {
+		log.Printf("Error revoking session %s: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	hub.DisconnectSession(sessionID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
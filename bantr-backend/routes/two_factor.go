@@ -0,0 +1,291 @@
+package routes
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// verifyTwoFactorLogin finishes a login for a user with 2FA. The challenge
+// token comes from the first login step.
+func verifyTwoFactorLogin(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge token and code are required"})
+		return
+	}
+
+	challengesCollection := utils.GetTwoFactorChallengesCollection()
+	challenge, err := models.AttemptTwoFactorChallenge(challengesCollection, utils.HashToken(req.ChallengeToken))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	user, err := models.FindUserByID(utils.GetUsersCollection(), challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	valid, err := utils.VerifyTwoFactorCode(user, req.Code)
+	if err == models.ErrTwoFactorLocked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, try again later"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":              "Invalid code",
+			"attempts_remaining": models.MaxTwoFactorAttempts - challenge.Attempts,
+		})
+		return
+	}
+
+	models.DeleteTwoFactorChallenge(challengesCollection, challenge.ID)
+
+	tokens, err := utils.IssueSession(*user, c.Request.UserAgent(), c.ClientIP())
+	if err == models.ErrUserDeactivated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+		return
+	}
+	if err != nil {
+		log.Printf("Session creation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          user,
+	})
+}
+
+func getTwoFactorStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	status := gin.H{"enabled": user.HasTwoFactor()}
+	if user.HasTwoFactor() {
+		status["enabled_at"] = user.TwoFactor.EnabledAt
+		status["recovery_codes_remaining"] = len(user.TwoFactor.RecoveryCodeHashes)
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// enrollTwoFactor hands out a new secret for the user to add to their
+// authenticator app. 2FA only turns on once they confirm it with a code.
+func enrollTwoFactor(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.HasTwoFactor() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	uri := utils.TOTPURI(secret, user.Email)
+	qrCode, err := utils.TOTPQRCode(uri)
+	if err != nil {
+		log.Printf("Error rendering 2FA QR code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	if err := models.SetPendingTwoFactorSecret(utils.GetUsersCollection(), user.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	})
+}
+
+// confirmTwoFactor turns 2FA on once the user proves their app has the
+// pending secret. The recovery codes are only ever shown in this response.
+func confirmTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactor == nil || user.TwoFactor.PendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+
+	secret := user.TwoFactor.PendingSecret
+	step, valid := utils.ValidateTOTP(secret, req.Code, 0)
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	err = models.EnableTwoFactor(utils.GetUsersCollection(), user.ID, secret, hashes, step)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "Enrollment changed, please start again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// disableTwoFactor turns 2FA off. It takes a current code so a stolen
+// access token alone can't remove the second factor.
+func disableTwoFactor(c *gin.Context) {
+	user, ok := requireTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DisableTwoFactor(utils.GetUsersCollection(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// regenerateRecoveryCodes replaces all of the user's recovery codes
+func regenerateRecoveryCodes(c *gin.Context) {
+	user, ok := requireTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err := models.ReplaceRecoveryCodes(utils.GetUsersCollection(), user.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// requireTwoFactorCode loads the current user and checks the 2FA code in the
+// request body. It writes the error response itself when it fails.
+func requireTwoFactorCode(c *gin.Context) (*models.User, bool) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return nil, false
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	if !user.HasTwoFactor() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return nil, false
+	}
+
+	valid, err := utils.VerifyTwoFactorCode(user, req.Code)
+	if err == models.ErrTwoFactorLocked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, try again later"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return nil, false
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// checkHostTwoFactor stops RequireHost2FA from being turned on for a meeting
+// whose host doesn't have 2FA yet. It writes the error response
+// itself when it fails.
+func checkHostTwoFactor(c *gin.Context, hostID string, settings models.MeetingSettings) bool {
+	if !settings.RequireHost2FA {
+		return true
+	}
+
+	id, err := bson.ObjectIDFromHex(hostID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The host must enable two-factor authentication first"})
+		return false
+	}
+
+	host, err := models.FindUserByID(utils.GetUsersCollection(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return false
+	}
+	if !host.HasTwoFactor() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The host must enable two-factor authentication first"})
+		return false
+	}
+
+	return true
+}
@@ -2,55 +2,302 @@ package routes
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/AnshX01/Bantr/bantr-backend/websocket"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
-func UserRoutes(router *gin.Engine) {
+func UserRoutes(router *gin.Engine, hub *websocket.Hub) {
+	router.GET("/api/user/:id/avatar/:size", getAvatar)
+
 	userGroup := router.Group("/api/user")
 	userGroup.Use(middleware.AuthMiddleware())
 	{
 		userGroup.GET("/profile", getUserProfile)
-		
-		userGroup.PUT("/profile", updateUserProfile)
-		
-	
+
+		userGroup.DELETE("", func(c *gin.Context) {
+			deleteAccount(c, hub)
+		})
+
+		userGroup.GET("/sessions", listSessions)
+
+		userGroup.DELETE("/sessions/:id", func(c *gin.Context) {
+			revokeUserSession(c, hub)
+		})
+
+		userGroup.POST("/export", requestDataExport)
+
+		userGroup.GET("/export", getDataExport)
+
+		userGroup.GET("/export/download", downloadDataExport)
+
+		userGroup.PUT("/profile", func(c *gin.Context) {
+			updateUserProfile(c, hub)
+		})
+
+		userGroup.POST("/avatar", func(c *gin.Context) {
+			uploadAvatar(c, hub)
+		})
+
+		userGroup.GET("/preferences", getPreferences)
+
+		userGroup.PATCH("/preferences", updatePreferences)
+
+		userGroup.GET("/2fa", getTwoFactorStatus)
+
+		userGroup.POST("/2fa/enroll", enrollTwoFactor)
+
+		userGroup.POST("/2fa/confirm", confirmTwoFactor)
+
+		userGroup.POST("/2fa/disable", disableTwoFactor)
+
+		userGroup.POST("/2fa/recovery-codes", regenerateRecoveryCodes)
+
+		userGroup.GET("/identities", getUserIdentities)
+
+		userGroup.POST("/identities/:provider", linkIdentity)
+
+		userGroup.DELETE("/identities/:provider/:subject", unlinkIdentity)
+
+		userGroup.GET("/api-keys", listAPIKeys)
+
+		userGroup.POST("/api-keys", createAPIKey)
+
+		userGroup.DELETE("/api-keys/:id", func(c *gin.Context) {
+			deleteAPIKey(c, hub)
+		})
+
+		userGroup.GET("/bots", listBots)
+
+		userGroup.POST("/bots", createBot)
+
+		userGroup.DELETE("/bots/:id", func(c *gin.Context) {
+			deleteBot(c, hub)
+		})
 	}
 }
 
 func getUserProfile(c *gin.Context) {
-	userID, email, name, picture, _ := middleware.GetUserFromContext(c)
-	
-	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":      userID,
-			"email":   email,
-			"name":    name,
-			"picture": picture,
-		},
-	})
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
-// updateUserProfile updates the authenticated user's profile
-func updateUserProfile(c *gin.Context) {
-	userID, _, _, _, _ := middleware.GetUserFromContext(c)
-	
+// updateUserProfile saves the authenticated user's profile. Fields left out
+// of the request are not changed. Since the old access token still carries
+// the old name, a fresh one is returned and rooms the user is in are told
+// about the change.
+func updateUserProfile(c *gin.Context, hub *websocket.Hub) {
 	var req struct {
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+		Name    *string `json:"name"`
+		Picture *string `json:"picture"`
 	}
-	
+
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 64 characters"})
+			return
+		}
+		user.Name = name
+		user.MarkEdited(models.ProfileFieldName)
+	}
+
+	if req.Picture != nil {
+		picture := strings.TrimSpace(*req.Picture)
+		if picture != "" && !isValidPictureURL(picture) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Picture must be an http or https URL"})
+			return
+		}
+		user.Picture = picture
+		user.MarkEdited(models.ProfileFieldPicture)
+	}
+
+	if err := models.UpdateUser(utils.GetUsersCollection(), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	sessionID, _, _ := middleware.GetSessionFromContext(c)
+	token, err := utils.GenerateToken(*user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	hub.UpdateUserProfile(user.ID.Hex(), user.Name, user.Picture)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Profile updated successfully",
-		"user_id": userID,
-		"updates": req,
+		"message":    "Profile updated successfully",
+		"user":       user,
+		"token":      token,
+		"expires_in": int(utils.AccessTokenTTL.Seconds()),
 	})
 }
 
+func isValidPictureURL(picture string) bool {
+	if len(picture) > 2048 {
+		return false
+	}
+
+	parsed, err := url.Parse(picture)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func getUserIdentities(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	identities := user.Identities
+	if identities == nil {
+		identities = []models.Identity{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// linkIdentity adds another login provider to the current account. Google
+// identities are linked straight away from an ID token in the body. Other
+// providers return a URL the frontend sends the browser to, and the link is
+// made when the provider redirects back to the callback. The request has to
+// be made with credentials so the state cookie lands in the browser that
+// comes back, and it has to come from a login session, which must still be
+// active at the callback.
+func linkIdentity(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	providerName := c.Param("provider")
+	if providerName == utils.GoogleProvider {
+		var req struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Google ID token is required"})
+			return
+		}
+
+		profile, err := utils.VerifyGoogleIDToken(c.Request.Context(), req.Token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google token"})
+			return
+		}
+
+		err = models.LinkIdentity(utils.GetUsersCollection(), user.ID, profile.Identity())
+		if err == models.ErrIdentityInUse {
+			c.JSON(http.StatusConflict, gin.H{"error": "This Google account is linked to another user"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Identity linked successfully"})
+		return
+	}
+
+	provider, ok := utils.GetLoginProvider(providerName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	sessionID, _, _ := middleware.GetSessionFromContext(c)
+	if sessionID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign in again to link an account"})
+		return
+	}
+
+	authURL, ok := beginOAuthFlow(c, provider, c.Query("redirect"), user.ID.Hex(), sessionID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+func unlinkIdentity(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
 
+	err := models.UnlinkIdentity(utils.GetUsersCollection(), user.ID, c.Param("provider"), c.Param("subject"))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+	if err == models.ErrLastIdentity {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot unlink your only login method"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked successfully"})
+}
+
+// currentUser loads the authenticated user from the database. It writes the
+// error response itself when it fails.
+func currentUser(c *gin.Context) (*models.User, bool) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := models.FindUserByID(utils.GetUsersCollection(), id)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// currentUserID parses the authenticated user's ID. It writes the error
+// response itself when it fails.
+func currentUserID(c *gin.Context) (bson.ObjectID, bool) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	id, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		return bson.ObjectID{}, false
+	}
+	return id, true
+}
@@ -0,0 +1,310 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/jobs"
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	maxWebhooksPerOwner   = 20
+	webhookDeliveriesPage = 50
+)
+
+func WebhookRoutes(router *gin.Engine) {
+	webhookGroup := router.Group("/api/webhooks")
+	webhookGroup.Use(middleware.AuthMiddleware())
+	{
+		webhookGroup.GET("", listWebhooks)
+
+		webhookGroup.POST("", createWebhook)
+
+		webhookGroup.PATCH("/:id", updateWebhook)
+
+		webhookGroup.DELETE("/:id", deleteWebhook)
+
+		webhookGroup.GET("/:id/deliveries", listWebhookDeliveries)
+
+		webhookGroup.POST("/:id/deliveries/:deliveryId/redeliver", redeliverWebhook)
+	}
+}
+
+// requireWorkspaceAdmin makes sure the user can manage a workspace's webhooks
+func requireWorkspaceAdmin(c *gin.Context, workspaceID, userID string) bool {
+	role, err := utils.WorkspaceRole(workspaceID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check workspace membership"})
+		return false
+	}
+	if role == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return false
+	}
+	if !models.IsWorkspaceAdmin(role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only workspace admins can manage its webhooks"})
+		return false
+	}
+	return true
+}
+
+// validWebhookEvents checks the events list, writing the error if it's bad
+func validWebhookEvents(c *gin.Context, events []string) bool {
+	if len(events) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one event is required"})
+		return false
+	}
+	for _, event := range events {
+		if !models.IsValidEventType(event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event: " + event})
+			return false
+		}
+	}
+	return true
+}
+
+// loadWebhook finds the webhook in the URL and checks the user may manage
+// it: their own, or one for a workspace they administer
+func loadWebhook(c *gin.Context) (*models.Webhook, bool) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	webhookID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	webhook, err := models.FindWebhookByID(utils.GetWebhooksCollection(), webhookID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find webhook"})
+		}
+		return nil, false
+	}
+
+	if webhook.WorkspaceID != "" {
+		if !requireWorkspaceAdmin(c, webhook.WorkspaceID, userID) {
+			return nil, false
+		}
+	} else if webhook.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// listWebhooks shows the user's personal webhooks, or a workspace's when
+// workspace_id is given
+func listWebhooks(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+	workspaceID := c.Query("workspace_id")
+
+	var webhooks []models.Webhook
+	var err error
+	if workspaceID != "" {
+		if !requireWorkspaceAdmin(c, workspaceID, userID) {
+			return
+		}
+		webhooks, err = models.GetWorkspaceWebhooks(utils.GetWebhooksCollection(), workspaceID)
+	} else {
+		webhooks, err = models.GetUserWebhooks(utils.GetWebhooksCollection(), userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks":         webhooks,
+		"count":            len(webhooks),
+		"available_events": models.EventTypes(),
+	})
+}
+
+// createWebhook subscribes a URL to events for the user's meetings, or for
+// a workspace's meetings when workspace_id is given
+func createWebhook(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	var req struct {
+		URL         string   `json:"url" binding:"required"`
+		Events      []string `json:"events" binding:"required"`
+		WorkspaceID string   `json:"workspace_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL and events are required"})
+		return
+	}
+
+	url := strings.TrimSpace(req.URL)
+	if err := utils.ValidateWebhookURL(url); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validWebhookEvents(c, req.Events) {
+		return
+	}
+
+	webhook := &models.Webhook{
+		URL:       url,
+		Events:    req.Events,
+		Active:    true,
+		Secret:    utils.GenerateWebhookSecret(),
+		CreatedBy: userID,
+	}
+
+	collection := utils.GetWebhooksCollection()
+	var existing []models.Webhook
+	var err error
+	if req.WorkspaceID != "" {
+		if !requireWorkspaceAdmin(c, req.WorkspaceID, userID) {
+			return
+		}
+		webhook.WorkspaceID = req.WorkspaceID
+		existing, err = models.GetWorkspaceWebhooks(collection, req.WorkspaceID)
+	} else {
+		webhook.UserID = userID
+		existing, err = models.GetUserWebhooks(collection, userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+	if len(existing) >= maxWebhooksPerOwner {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many webhooks, delete one first"})
+		return
+	}
+
+	if err := models.CreateWebhook(collection, webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created. Copy the secret now, it won't be shown again.",
+		"secret":  webhook.Secret,
+		"webhook": webhook,
+	})
+}
+
+func updateWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if req.URL != nil {
+		url := strings.TrimSpace(*req.URL)
+		if err := utils.ValidateWebhookURL(url); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		webhook.URL = url
+	}
+	if req.Events != nil {
+		if !validWebhookEvents(c, req.Events) {
+			return
+		}
+		webhook.Events = req.Events
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+
+	if err := models.UpdateWebhook(utils.GetWebhooksCollection(), webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook})
+}
+
+func deleteWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := models.DeleteWebhooks(utils.GetWebhooksCollection(), utils.GetWebhookDeliveriesCollection(), bson.M{"_id": webhook.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// listWebhookDeliveries shows the most recent deliveries and their attempts
+func listWebhookDeliveries(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(utils.GetWebhookDeliveriesCollection(), webhook.ID, webhookDeliveriesPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// redeliverWebhook sends a past delivery again, whether it failed or not
+func redeliverWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := bson.ObjectIDFromHex(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	delivery, err := models.FindWebhookDelivery(utils.GetWebhookDeliveriesCollection(), webhook.ID, deliveryID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find delivery"})
+		}
+		return
+	}
+
+	redelivery, err := jobs.RedeliverWebhook(delivery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue redelivery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Redelivery queued",
+		"delivery": redelivery,
+	})
+}
@@ -0,0 +1,613 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AnshX01/Bantr/bantr-backend/middleware"
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func WorkspaceRoutes(router *gin.Engine) {
+	workspaceGroup := router.Group("/api/workspaces")
+	workspaceGroup.Use(middleware.AuthMiddleware())
+	{
+		workspaceGroup.POST("", createWorkspace)
+
+		workspaceGroup.GET("", listWorkspaces)
+
+		workspaceGroup.GET("/:id", getWorkspace)
+
+		workspaceGroup.PATCH("/:id", updateWorkspace)
+
+		workspaceGroup.DELETE("/:id", deleteWorkspace)
+
+		workspaceGroup.GET("/:id/domain-verification", getDomainVerification)
+
+		workspaceGroup.POST("/:id/scim-token", createSCIMToken)
+
+		workspaceGroup.DELETE("/:id/scim-token", deleteSCIMToken)
+
+		workspaceGroup.GET("/:id/members", listWorkspaceMembers)
+
+		workspaceGroup.POST("/:id/members", addWorkspaceMember)
+
+		workspaceGroup.PATCH("/:id/members/:userId", updateWorkspaceMember)
+
+		workspaceGroup.DELETE("/:id/members/:userId", removeWorkspaceMember)
+
+		workspaceGroup.GET("/:id/meetings", listWorkspaceMeetings)
+	}
+}
+
+func createWorkspace(c *gin.Context) {
+	var req struct {
+		Name    string   `json:"name" binding:"required"`
+		Domains []string `json:"domains"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	name, ok := validWorkspaceName(c, req.Name)
+	if !ok {
+		return
+	}
+	// Domains need the workspace's DNS record, which can only be published
+	// once the workspace exists
+	if len(req.Domains) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add domains after creating the workspace and publishing its verification record"})
+		return
+	}
+
+	workspace := &models.Workspace{
+		Name:                    name,
+		CreatedBy:               user.ID.Hex(),
+		DomainVerificationToken: utils.GenerateOpaqueToken(),
+	}
+	err := models.CreateWorkspace(utils.GetWorkspacesCollection(), workspace)
+	if err == models.ErrDomainClaimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "One of these domains belongs to another workspace"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workspace"})
+		return
+	}
+
+	owner := &models.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID.Hex(),
+		Role:        models.WorkspaceRoleOwner,
+	}
+	if err := models.AddWorkspaceMember(utils.GetWorkspaceMembersCollection(), owner); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workspace"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Workspace created successfully",
+		"workspace": workspace,
+		"role":      owner.Role,
+	})
+}
+
+// listWorkspaces shows the workspaces the user belongs to and their role in
+// each
+func listWorkspaces(c *gin.Context) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	memberships, err := models.GetUserMemberships(utils.GetWorkspaceMembersCollection(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspaces"})
+		return
+	}
+
+	roles := make(map[bson.ObjectID]string, len(memberships))
+	ids := make([]bson.ObjectID, 0, len(memberships))
+	for _, membership := range memberships {
+		roles[membership.WorkspaceID] = membership.Role
+		ids = append(ids, membership.WorkspaceID)
+	}
+
+	workspaces, err := models.FindWorkspacesByIDs(utils.GetWorkspacesCollection(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspaces"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		result = append(result, gin.H{"workspace": workspace, "role": roles[workspace.ID]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspaces": result,
+		"count":      len(result),
+	})
+}
+
+func getWorkspace(c *gin.Context) {
+	workspace, member, ok := loadWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workspace": workspace, "role": member.Role})
+}
+
+func updateWorkspace(c *gin.Context) {
+	var req struct {
+		Name    *string   `json:"name"`
+		Domains *[]string `json:"domains"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	workspace, _, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		name, ok := validWorkspaceName(c, *req.Name)
+		if !ok {
+			return
+		}
+		workspace.Name = name
+	}
+
+	if req.Domains != nil {
+		// Domains the workspace already has can stay, only new ones need
+		// proving
+		var added []string
+		for _, domain := range *req.Domains {
+			if !containsString(workspace.Domains, strings.ToLower(strings.TrimSpace(domain))) {
+				added = append(added, domain)
+			}
+		}
+		if _, ok := validWorkspaceDomains(c, workspace, added); !ok {
+			return
+		}
+		domains, _ := normalizeDomains(*req.Domains)
+		workspace.Domains = domains
+	}
+
+	err := models.UpdateWorkspace(utils.GetWorkspacesCollection(), workspace)
+	if err == models.ErrDomainClaimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "One of these domains belongs to another workspace"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workspace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Workspace updated successfully",
+		"workspace": workspace,
+	})
+}
+
+// getDomainVerification gives admins the TXT record to publish before the
+// workspace can claim a domain. Workspaces from before verification get
+// their token here.
+func getDomainVerification(c *gin.Context) {
+	workspace, _, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	token := workspace.DomainVerificationToken
+	if token == "" {
+		var err error
+		token, err = models.SetWorkspaceVerificationToken(utils.GetWorkspacesCollection(), workspace.ID, utils.GenerateOpaqueToken())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get verification record"})
+			return
+		}
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(c.DefaultQuery("domain", "example.com")))
+	name, value := utils.DomainVerificationRecord(domain, token)
+	c.JSON(http.StatusOK, gin.H{
+		"type":  "TXT",
+		"name":  name,
+		"value": value,
+	})
+}
+
+// createSCIMToken issues the token the workspace's identity provider uses,
+// replacing any earlier one. Only owners can, since the provider can
+// deactivate everyone on the workspace's domains.
+func createSCIMToken(c *gin.Context) {
+	workspace, member, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	if member.Role != models.WorkspaceRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can manage SCIM tokens"})
+		return
+	}
+
+	token, hash := utils.GenerateSCIMToken()
+	if err := models.SetWorkspaceSCIMToken(utils.GetWorkspacesCollection(), workspace.ID, hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create SCIM token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "SCIM token created. Copy it now, it won't be shown again.",
+		"token":    token,
+		"scim_url": utils.BackendURL() + "/scim/v2",
+	})
+}
+
+func deleteSCIMToken(c *gin.Context) {
+	workspace, member, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	if member.Role != models.WorkspaceRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can manage SCIM tokens"})
+		return
+	}
+
+	if err := models.SetWorkspaceSCIMToken(utils.GetWorkspacesCollection(), workspace.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke SCIM token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SCIM token revoked"})
+}
+
+func deleteWorkspace(c *gin.Context) {
+	workspace, member, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	if member.Role != models.WorkspaceRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can delete a workspace"})
+		return
+	}
+
+	err := models.DeleteWorkspace(utils.GetWorkspacesCollection(), utils.GetWorkspaceMembersCollection(), utils.GetMeetingsCollection(), workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete workspace"})
+		return
+	}
+	if err := utils.DeleteWorkspaceWebhooks(workspace.ID.Hex()); err != nil {
+		log.Printf("Error deleting webhooks for workspace %s: %v", workspace.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted successfully"})
+}
+
+func listWorkspaceMembers(c *gin.Context) {
+	workspace, _, ok := loadWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	members, err := models.GetWorkspaceMembers(utils.GetWorkspaceMembersCollection(), workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get members"})
+		return
+	}
+
+	ids := make([]bson.ObjectID, 0, len(members))
+	for _, member := range members {
+		if id, err := bson.ObjectIDFromHex(member.UserID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	users, err := models.FindUsersByIDs(utils.GetUsersCollection(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get members"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(members))
+	for _, member := range members {
+		user := users[member.UserID]
+		result = append(result, gin.H{
+			"user_id":   member.UserID,
+			"name":      user.Name,
+			"email":     user.Email,
+			"picture":   user.Picture,
+			"role":      member.Role,
+			"joined_at": member.JoinedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": result,
+		"count":   len(result),
+	})
+}
+
+// addWorkspaceMember adds an existing Bantr user to the workspace by email
+func addWorkspaceMember(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.WorkspaceRoleMember
+	}
+	if !models.IsValidWorkspaceRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be owner, admin or member"})
+		return
+	}
+
+	workspace, member, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	if req.Role == models.WorkspaceRoleOwner && member.Role != models.WorkspaceRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can add owners"})
+		return
+	}
+
+	user, err := models.FindUserByEmail(utils.GetUsersCollection(), strings.ToLower(strings.TrimSpace(req.Email)))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No user with that email"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	newMember := &models.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID.Hex(),
+		Role:        req.Role,
+	}
+	err = models.AddWorkspaceMember(utils.GetWorkspaceMembersCollection(), newMember)
+	if err == models.ErrAlreadyMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Member added successfully",
+		"member":  newMember,
+	})
+}
+
+func updateWorkspaceMember(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || !models.IsValidWorkspaceRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be owner, admin or member"})
+		return
+	}
+
+	workspace, member, ok := loadWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	membersCollection := utils.GetWorkspaceMembersCollection()
+	targetID := c.Param("userId")
+	target, err := models.FindWorkspaceMember(membersCollection, workspace.ID, targetID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	// Admins manage members and other admins, but owners are off limits
+	if (req.Role == models.WorkspaceRoleOwner || target.Role == models.WorkspaceRoleOwner) && member.Role != models.WorkspaceRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can change owners"})
+		return
+	}
+
+	err = models.UpdateWorkspaceMemberRole(membersCollection, workspace.ID, targetID, req.Role)
+	if err == models.ErrLastOwner {
+		c.JSON(http.StatusConflict, gin.H{"error": "A workspace needs at least one owner"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated successfully"})
+}
+
+// removeWorkspaceMember lets admins remove members, and anyone leave
+func removeWorkspaceMember(c *gin.Context) {
+	workspace, member, ok := loadWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	membersCollection := utils.GetWorkspaceMembersCollection()
+	targetID := c.Param("userId")
+	if targetID != member.UserID {
+		if !models.IsWorkspaceAdmin(member.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only workspace admins can remove members"})
+			return
+		}
+
+		target, err := models.FindWorkspaceMember(membersCollection, workspace.ID, targetID)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+			return
+		}
+		if target.Role == models.WorkspaceRoleOwner && member.Role != models.WorkspaceRoleOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can remove owners"})
+			return
+		}
+	}
+
+	err := models.RemoveWorkspaceMember(membersCollection, workspace.ID, targetID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if err == models.ErrLastOwner {
+		c.JSON(http.StatusConflict, gin.H{"error": "A workspace needs at least one owner"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+func listWorkspaceMeetings(c *gin.Context) {
+	workspace, _, ok := loadWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	meetings, err := models.GetWorkspaceMeetings(utils.GetMeetingsCollection(), workspace.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get meetings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"meetings": meetings,
+		"count":    len(meetings),
+	})
+}
+
+// loadWorkspace loads the workspace in the URL along with the current user's
+// membership. Non-members get a 404 so they can't probe for workspaces. With
+// adminOnly set, members without an admin role get a 403. It writes the
+// error response itself when it fails.
+func loadWorkspace(c *gin.Context, adminOnly bool) (*models.Workspace, *models.WorkspaceMember, bool) {
+	userID, _, _, _, _ := middleware.GetUserFromContext(c)
+
+	id, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return nil, nil, false
+	}
+
+	member, err := models.FindWorkspaceMember(utils.GetWorkspaceMembersCollection(), id, userID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workspace"})
+		return nil, nil, false
+	}
+
+	if adminOnly && !models.IsWorkspaceAdmin(member.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only workspace admins can do that"})
+		return nil, nil, false
+	}
+
+	workspace, err := models.FindWorkspaceByID(utils.GetWorkspacesCollection(), id)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workspace"})
+		return nil, nil, false
+	}
+
+	return workspace, member, true
+}
+
+func validWorkspaceName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 100 characters"})
+		return "", false
+	}
+	return name, true
+}
+
+// validWorkspaceDomains checks the domains a workspace wants to claim.
+// Claiming a domain auto-joins everyone from it, and anyone can have an
+// email on a domain they don't run, so each one has to publish the
+// workspace's verification record in DNS. It writes the error response
+// itself when it fails.
+func validWorkspaceDomains(c *gin.Context, workspace *models.Workspace, domains []string) ([]string, bool) {
+	normalized, ok := normalizeDomains(domains)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain"})
+		return nil, false
+	}
+
+	for _, domain := range normalized {
+		if !utils.HasDomainVerification(domain, workspace.DomainVerificationToken) {
+			name, _ := utils.DomainVerificationRecord(domain, "")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Publish the workspace's verification TXT record at " + name + " to claim " + domain})
+			return nil, false
+		}
+	}
+	return normalized, true
+}
+
+func normalizeDomains(domains []string) ([]string, bool) {
+	normalized := []string{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@/ ") {
+			return nil, false
+		}
+		if !containsString(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized, true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// ErrNotFound is returned when a blob doesn't exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps binary files like avatars under slash-separated keys
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Get returns the blob's contents and content type. Callers must close
+	// the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	// DeletePrefix removes every blob under a key prefix. The prefix has to
+	// end at a slash boundary, like "avatars/123".
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+var defaultStore BlobStore
+
+// Setup picks the blob store from STORAGE_DRIVER. Only "file" is supported
+// for now, which keeps blobs under STORAGE_DIR.
+func Setup() error {
+	driver := os.Getenv("STORAGE_DRIVER")
+	switch driver {
+	case "", "file":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		store, err := NewFileStore(dir)
+		if err != nil {
+			return err
+		}
+		defaultStore = store
+		log.Printf("Storing blobs in %s", dir)
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+
+	return nil
+}
+
+// Default returns the configured blob store
+func Default() BlobStore {
+	return defaultStore
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// APIKeyPrefix starts every API key so they can be told apart from JWTs
+// and spotted by secret scanners
+const APIKeyPrefix = "bantr_"
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// GenerateAPIKey returns a new key, the hash to store for it, and a short
+// prefix that identifies it in lists without giving it away
+func GenerateAPIKey() (key, hash, prefix string) {
+	key = APIKeyPrefix + GenerateOpaqueToken()
+	return key, HashToken(key), key[:len(APIKeyPrefix)+6]
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// AuthenticateAPIKey finds the key and the user it acts as. Expired keys,
+// deactivated users and bots whose owner was deactivated all fail with
+// ErrInvalidAPIKey.
+func AuthenticateAPIKey(token string) (*models.APIKey, *models.User, error) {
+	collection := GetAPIKeysCollection()
+	key, err := models.FindAPIKeyByHash(collection, HashToken(token))
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if key.IsExpired() {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	userID, err := bson.ObjectIDFromHex(key.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	user, err := models.FindUserByID(GetUsersCollection(), userID)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Deactivated {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.CreatedBy != key.UserID {
+		deactivated, err := IsUserDeactivated(key.CreatedBy)
+		if err != nil {
+			return nil, nil, err
+		}
+		if deactivated {
+			return nil, nil, ErrInvalidAPIKey
+		}
+	}
+
+	models.TouchAPIKey(collection, key.ID)
+	return key, user, nil
+}
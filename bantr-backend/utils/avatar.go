@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// AvatarSizes are the square thumbnail sizes generated for every avatar
+var AvatarSizes = []int{32, 64, 128, 256, 512}
+
+const (
+	// MaxAvatarBytes is the largest upload we accept
+	MaxAvatarBytes = 5 << 20
+	minAvatarSide  = 64
+	maxAvatarSide  = 4096
+)
+
+var (
+	ErrUnsupportedImage = errors.New("image must be PNG, JPEG or WebP")
+	ErrImageTooSmall    = errors.New("image must be at least 64x64 pixels")
+	ErrImageTooLarge    = errors.New("image must be at most 4096x4096 pixels")
+)
+
+// ProcessAvatar decodes an uploaded image and returns a JPEG thumbnail for
+// every size in AvatarSizes. Re-encoding drops EXIF and any other metadata,
+// but JPEG orientation is applied first so photos from phones stay upright.
+func ProcessAvatar(data []byte) (map[int][]byte, error) {
+	format, decode := detectImageFormat(data)
+	if decode == nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	// Check dimensions before decoding the whole thing so a small file that
+	// claims to be huge can't eat all our memory
+	config, err := decodeConfig(format, data)
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width < minAvatarSide || config.Height < minAvatarSide {
+		return nil, ErrImageTooSmall
+	}
+	if config.Width > maxAvatarSide || config.Height > maxAvatarSide {
+		return nil, ErrImageTooLarge
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	square := cropSquare(img)
+	thumbnails := make(map[int][]byte, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		// JPEG has no alpha, so flatten onto white instead of black
+		thumb := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(thumb, thumb.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(thumb, thumb.Bounds(), square, square.Bounds(), draw.Over, nil)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+
+	return thumbnails, nil
+}
+
+// IsAvatarSize reports whether a thumbnail size is one we generate
+func IsAvatarSize(size int) bool {
+	for _, s := range AvatarSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// detectImageFormat sniffs the magic bytes rather than trusting the
+// uploaded content type
+func detectImageFormat(data []byte) (string, func(r *bytes.Reader) (image.Image, error)) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png", func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "jpeg", func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp", func(r *bytes.Reader) (image.Image, error) { return webp.Decode(r) }
+	}
+	return "", nil
+}
+
+func decodeConfig(format string, data []byte) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch format {
+	case "png":
+		return png.DecodeConfig(r)
+	case "jpeg":
+		return jpeg.DecodeConfig(r)
+	default:
+		return webp.DecodeConfig(r)
+	}
+}
+
+func cropSquare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x, y), draw.Src)
+	return square
+}
+
+// jpegOrientation reads the EXIF orientation tag from a JPEG, returning 1
+// (upright) when there isn't one
+func jpegOrientation(data []byte) int {
+	// Walk the segments up to the start of the image data looking for the
+	// APP1 Exif block
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation turns an image upright according to its EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	// Orientations 5-8 swap width and height
+	outW, outH := w, h
+	if orientation >= 5 {
+		outW, outH = h, w
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+)
+
+// defaultInviteDuration is how long the calendar event for a meeting
+// without a schedule lasts
+const defaultInviteDuration = time.Hour
+
+const icsTimeFormat = "20060102T150405Z"
+
+// MeetingICS builds the calendar invitation sent to an invitee. Meetings
+// without a schedule get an event starting when they were created.
+func MeetingICS(meeting *models.Meeting, attendee string) []byte {
+	start := meeting.CreatedAt
+	end := start.Add(defaultInviteDuration)
+	sequence := 0
+	if meeting.Schedule != nil {
+		start = meeting.Schedule.StartsAt
+		end = meeting.Schedule.EndsAt()
+		sequence = meeting.Schedule.Sequence
+	}
+
+	joinURL := MeetingURL(meeting.RoomID)
+	description := "Join the meeting: " + joinURL
+	if meeting.Description != "" {
+		description = meeting.Description + "\n\n" + description
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Bantr//Meetings//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:REQUEST",
+		"BEGIN:VEVENT",
+		// The UID stays the same across updates so calendars replace the event
+		"UID:" + meeting.RoomID + "@bantr",
+		"SEQUENCE:" + strconv.Itoa(sequence),
+		"DTSTAMP:" + time.Now().UTC().Format(icsTimeFormat),
+		"DTSTART:" + start.UTC().Format(icsTimeFormat),
+		"DTEND:" + end.UTC().Format(icsTimeFormat),
+		"SUMMARY:" + escapeICSText(meeting.Title),
+		"DESCRIPTION:" + escapeICSText(description),
+		"LOCATION:" + escapeICSText(joinURL),
+		"URL:" + joinURL,
+	}
+	// Calendars want the organizer as an address, and the only one we send
+	// from is MAIL_FROM
+	if from, err := mail.ParseAddress(os.Getenv("MAIL_FROM")); err == nil {
+		lines = append(lines, "ORGANIZER;CN="+quoteICSParam(meeting.CreatorName)+":mailto:"+from.Address)
+	}
+	lines = append(lines,
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:"+attendee,
+		"STATUS:CONFIRMED",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	)
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldICSLine(line))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+func escapeICSText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+// quoteICSParam quotes a parameter value. Double quotes can't be escaped
+// inside one, so they're dropped.
+func quoteICSParam(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, "") + `"`
+}
+
+// foldICSLine splits lines longer than 75 bytes, continuing them on the
+// next line after a space. It never splits inside a UTF-8 character.
+func foldICSLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
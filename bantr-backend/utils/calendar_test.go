@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+)
+
+// unfoldICS undoes line folding the way calendar clients do
+func unfoldICS(text string) string {
+	return strings.ReplaceAll(text, "\r\n ", "")
+}
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		lines int
+	}{
+		{"short", "SUMMARY:Standup", 1},
+		{"exactly 75 bytes", "SUMMARY:" + strings.Repeat("a", 67), 1},
+		{"76 bytes", "SUMMARY:" + strings.Repeat("a", 68), 2},
+		{"long", "DESCRIPTION:" + strings.Repeat("a", 300), 5},
+		{"multibyte", "SUMMARY:" + strings.Repeat("é", 100), 3},
+		{"emoji", "SUMMARY:" + strings.Repeat("🎉", 40), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := foldICSLine(tt.line)
+
+			physical := strings.Split(folded, "\r\n")
+			if len(physical) != tt.lines {
+				t.Errorf("folded into %d lines, want %d", len(physical), tt.lines)
+			}
+			for i, line := range physical {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d bytes, want at most 75", i, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a UTF-8 character: %q", i, line)
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d doesn't start with a space", i)
+				}
+			}
+
+			if got := unfoldICS(folded); got != tt.line {
+				t.Errorf("unfolded = %q, want %q", got, tt.line)
+			}
+		})
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Standup", "Standup"},
+		{"Plan; review, ship", `Plan\; review\, ship`},
+		{`C:\temp`, `C:\\temp`},
+		{"one\ntwo\r\nthree", `one\ntwo\nthree`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeICSText(tt.text); got != tt.want {
+			t.Errorf("escapeICSText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMeetingICS(t *testing.T) {
+	t.Setenv("MAIL_FROM", "Bantr <meetings@example.com>")
+
+	startsAt := time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC)
+	meeting := &models.Meeting{
+		RoomID:      "abc-defg-hij",
+		Title:       "Quarterly planning, part 2",
+		Description: strings.Repeat("A long agenda that needs folding. ", 5),
+		CreatorName: `Jane "JD" Doe`,
+		Schedule: &models.MeetingSchedule{
+			StartsAt:        startsAt,
+			DurationMinutes: 90,
+			Sequence:        3,
+		},
+	}
+
+	ics := string(MeetingICS(meeting, "guest@example.com"))
+
+	if !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+		t.Error("calendar doesn't end with END:VCALENDAR and CRLF")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d bytes, want at most 75", i, len(line))
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("line %d has a bare newline", i)
+		}
+	}
+
+	unfolded := unfoldICS(ics)
+	for _, want := range []string{
+		"UID:abc-defg-hij@bantr\r\n",
+		"SEQUENCE:3\r\n",
+		"DTSTART:20300102T150000Z\r\n",
+		"DTEND:20300102T163000Z\r\n",
+		`SUMMARY:Quarterly planning\, part 2` + "\r\n",
+		`ORGANIZER;CN="Jane JD Doe":mailto:meetings@example.com` + "\r\n",
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:guest@example.com\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("calendar is missing %q", want)
+		}
+	}
+}
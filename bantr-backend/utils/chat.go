@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Slash commands are verified with SLACK_SIGNING_SECRET for Slack and
+// MATTERMOST_COMMAND_TOKEN for Mattermost. Either can be left unset to turn
+// that platform off. CHAT_SUMMARY_WEBHOOK_URL is the optional incoming
+// webhook summaries of meetings started from chat are posted to.
+
+// slackRequestMaxAge is how old a signed Slack request can be before we
+// treat it as a replay
+const slackRequestMaxAge = 5 * time.Minute
+
+var ErrChatCommandUnverified = errors.New("chat command could not be verified")
+
+var chatClient = &http.Client{Timeout: 10 * time.Second}
+
+// ChatCommandsEnabled reports whether any chat platform is set up
+func ChatCommandsEnabled() bool {
+	return os.Getenv("SLACK_SIGNING_SECRET") != "" || os.Getenv("MATTERMOST_COMMAND_TOKEN") != ""
+}
+
+// VerifyChatCommand checks a slash command really came from a chat platform
+// and returns which one. Slack signs the raw body, Mattermost sends back the
+// token it gave the command in the form.
+func VerifyChatCommand(header http.Header, body []byte, form url.Values) (string, error) {
+	if signature := header.Get("X-Slack-Signature"); signature != "" {
+		secret := os.Getenv("SLACK_SIGNING_SECRET")
+		if secret == "" {
+			return "", ErrChatCommandUnverified
+		}
+		if !verifySlackSignature(secret, header.Get("X-Slack-Request-Timestamp"), signature, body, time.Now()) {
+			return "", ErrChatCommandUnverified
+		}
+		return models.ChatPlatformSlack, nil
+	}
+
+	token := os.Getenv("MATTERMOST_COMMAND_TOKEN")
+	if token != "" && subtle.ConstantTimeCompare([]byte(form.Get("token")), []byte(token)) == 1 {
+		return models.ChatPlatformMattermost, nil
+	}
+
+	return "", ErrChatCommandUnverified
+}
+
+// verifySlackSignature checks Slack's v0 signature, an HMAC-SHA256 of
+// "v0:<timestamp>:<body>"
+func verifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// GenerateChatLinkToken creates the token in the link a chat user follows
+// to connect their chat account to whoever is logged in
+func GenerateChatLinkToken(link *models.ChatLink) (string, error) {
+	now := time.Now()
+
+	claims := &Claims{
+		Name:      link.ChatUserName,
+		TokenType: TokenTypeChatLink,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strings.Join([]string{link.Platform, link.TeamID, link.ChatUserID, link.TeamDomain}, "|"),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ChatLinkTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// ParseChatLinkToken returns the chat account a link token was made for.
+// The caller fills in the user it gets linked to.
+func ParseChatLinkToken(token string) (*models.ChatLink, error) {
+	claims, err := VerifyTokenOfType(token, TokenTypeChatLink)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(claims.Subject, "|")
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, errors.New("malformed chat link token")
+	}
+
+	return &models.ChatLink{
+		Platform:     parts[0],
+		TeamID:       parts[1],
+		ChatUserID:   parts[2],
+		TeamDomain:   parts[3],
+		ChatUserName: claims.Name,
+	}, nil
+}
+
+// ChatLinkURL is the page that finishes linking a chat account
+func ChatLinkURL(token string) string {
+	return FrontendURL() + "/integrations/chat/link?token=" + url.QueryEscape(token)
+}
+
+// EscapeChatText escapes the characters Slack treats as markup
+func EscapeChatText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// StartChatSummaries posts a summary of each meeting started from chat when
+// it ends. It does nothing unless CHAT_SUMMARY_WEBHOOK_URL is set.
+func StartChatSummaries() {
+	webhookURL := os.Getenv("CHAT_SUMMARY_WEBHOOK_URL")
+	if webhookURL == "" {
+		return
+	}
+
+	models.SubscribeEvents(func(event models.Event) {
+		if event.Type != models.EventMeetingEnded || event.Meeting == nil || event.Meeting.Source != models.MeetingSourceChat {
+			return
+		}
+
+		attendance, err := models.GetRoomAttendance(GetAttendanceCollection(), event.RoomID)
+		if err != nil {
+			return
+		}
+
+		text := chatSummary(event.Meeting, attendance, event.OccurredAt)
+		if err := postChatMessage(webhookURL, text); err != nil {
+			log.Printf("Error posting summary of meeting %s: %v", event.RoomID, err)
+		}
+	})
+}
+
+func chatSummary(meeting *models.Meeting, attendance []models.Attendance, endedAt time.Time) string {
+	title := "*" + EscapeChatText(meeting.Title) + "*"
+	if len(attendance) == 0 {
+		return title + " ended without anyone joining."
+	}
+
+	seen := map[string]bool{}
+	names := []string{}
+	for _, entry := range attendance {
+		if seen[entry.UserID] {
+			continue
+		}
+		seen[entry.UserID] = true
+		names = append(names, EscapeChatText(entry.Name))
+	}
+
+	// Attendance is sorted by join time, so the first entry is when it began
+	duration := endedAt.Sub(attendance[0].JoinedAt)
+
+	return fmt.Sprintf("%s ended after %s.\nAttendees (%d): %s",
+		title, formatChatDuration(duration), len(names), strings.Join(names, ", "))
+}
+
+func formatChatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes < 1 {
+		return "less than a minute"
+	}
+
+	hours, minutes := minutes/60, minutes%60
+	parts := []string{}
+	if hours == 1 {
+		parts = append(parts, "1 hour")
+	} else if hours > 1 {
+		parts = append(parts, fmt.Sprintf("%d hours", hours))
+	}
+	if minutes == 1 {
+		parts = append(parts, "1 minute")
+	} else if minutes > 1 {
+		parts = append(parts, fmt.Sprintf("%d minutes", minutes))
+	}
+	return strings.Join(parts, " ")
+}
+
+// postChatMessage sends a message to an incoming webhook. Slack and
+// Mattermost both take the same {"text": ...} body.
+func postChatMessage(webhookURL, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	resp, err := chatClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("incoming webhook responded with %d", resp.StatusCode)
+	}
+	return nil
+}
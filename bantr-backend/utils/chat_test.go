@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+)
+
+// The example request from Slack's "Verifying requests from Slack" guide
+const (
+	slackTestSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	slackTestTimestamp = "1531420618"
+	slackTestBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	slackTestSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+)
+
+func TestVerifySlackSignature(t *testing.T) {
+	sent := time.Unix(1531420618, 0)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		now       time.Time
+		want      bool
+	}{
+		{"valid", slackTestSecret, slackTestTimestamp, slackTestSignature, slackTestBody, sent, true},
+		{"a little clock skew", slackTestSecret, slackTestTimestamp, slackTestSignature, slackTestBody, sent.Add(-time.Minute), true},
+		{"replayed later", slackTestSecret, slackTestTimestamp, slackTestSignature, slackTestBody, sent.Add(slackRequestMaxAge + time.Second), false},
+		{"from the future", slackTestSecret, slackTestTimestamp, slackTestSignature, slackTestBody, sent.Add(-slackRequestMaxAge - time.Second), false},
+		{"wrong secret", "another-secret", slackTestTimestamp, slackTestSignature, slackTestBody, sent, false},
+		{"body changed", slackTestSecret, slackTestTimestamp, slackTestSignature, slackTestBody + "&text=hi", sent, false},
+		{"timestamp changed", slackTestSecret, "1531420619", slackTestSignature, slackTestBody, sent, false},
+		{"timestamp not a number", slackTestSecret, "soon", slackTestSignature, slackTestBody, sent, false},
+		{"missing version", slackTestSecret, slackTestTimestamp, slackTestSignature[3:], slackTestBody, sent, false},
+		{"empty signature", slackTestSecret, slackTestTimestamp, "", slackTestBody, sent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := verifySlackSignature(tt.secret, tt.timestamp, tt.signature, []byte(tt.body), tt.now)
+			if got != tt.want {
+				t.Errorf("verifySlackSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChatCommand(t *testing.T) {
+	slackHeader := http.Header{}
+	slackHeader.Set("X-Slack-Signature", "v0=00")
+	slackHeader.Set("X-Slack-Request-Timestamp", slackTestTimestamp)
+
+	tests := []struct {
+		name            string
+		slackSecret     string
+		mattermostToken string
+		header          http.Header
+		form            url.Values
+		want            string
+		wantErr         bool
+	}{
+		{
+			name:            "mattermost token",
+			mattermostToken: "mm-token",
+			header:          http.Header{},
+			form:            url.Values{"token": {"mm-token"}},
+			want:            models.ChatPlatformMattermost,
+		},
+		{
+			name:            "wrong mattermost token",
+			mattermostToken: "mm-token",
+			header:          http.Header{},
+			form:            url.Values{"token": {"guess"}},
+			wantErr:         true,
+		},
+		{
+			name:    "mattermost not set up",
+			header:  http.Header{},
+			form:    url.Values{"token": {""}},
+			wantErr: true,
+		},
+		{
+			name:            "bad slack signature doesn't fall back to mattermost",
+			slackSecret:     slackTestSecret,
+			mattermostToken: "mm-token",
+			header:          slackHeader,
+			form:            url.Values{"token": {"mm-token"}},
+			wantErr:         true,
+		},
+		{
+			name:    "slack not set up",
+			header:  slackHeader,
+			form:    url.Values{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SLACK_SIGNING_SECRET", tt.slackSecret)
+			t.Setenv("MATTERMOST_COMMAND_TOKEN", tt.mattermostToken)
+
+			got, err := VerifyChatCommand(tt.header, nil, tt.form)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("platform = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
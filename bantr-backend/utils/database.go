@@ -81,3 +81,75 @@ func GetUsersCollection() *mongo.Collection {
 func GetMeetingsCollection() *mongo.Collection {
 	return GetCollection("meetings")
 }
+
+func GetRecordingsCollection() *mongo.Collection {
+	return GetCollection("recordings")
+}
+
+func GetMeetingAnalyticsCollection() *mongo.Collection {
+	return GetCollection("meeting_analytics")
+}
+
+func GetSessionsCollection() *mongo.Collection {
+	return GetCollection("sessions")
+}
+
+func GetRevokedTokensCollection() *mongo.Collection {
+	return GetCollection("revoked_tokens")
+}
+
+func GetOAuthStatesCollection() *mongo.Collection {
+	return GetCollection("oauth_states")
+}
+
+func GetMagicLinksCollection() *mongo.Collection {
+	return GetCollection("magic_links")
+}
+
+func GetAttendanceCollection() *mongo.Collection {
+	return GetCollection("attendance")
+}
+
+func GetPreferencesCollection() *mongo.Collection {
+	return GetCollection("preferences")
+}
+
+func GetDataExportsCollection() *mongo.Collection {
+	return GetCollection("data_exports")
+}
+
+func GetTwoFactorChallengesCollection() *mongo.Collection {
+	return GetCollection("two_factor_challenges")
+}
+
+func GetWorkspacesCollection() *mongo.Collection {
+	return GetCollection("workspaces")
+}
+
+func GetWorkspaceMembersCollection() *mongo.Collection {
+	return GetCollection("workspace_members")
+}
+
+func GetAPIKeysCollection() *mongo.Collection {
+	return GetCollection("api_keys")
+}
+
+func GetWebhooksCollection() *mongo.Collection {
+	return GetCollection("webhooks")
+}
+
+func GetWebhookDeliveriesCollection() *mongo.Collection {
+	return GetCollection("webhook_deliveries")
+}
+
+func GetChatLinksCollection() *mongo.Collection {
+	return GetCollection("chat_links")
+}
+
+func GetJobsCollection() *mongo.Collection {
+	return GetCollection("jobs")
+}
+
+func GetNotificationsCollection() *mongo.Collection {
+	return GetCollection("notifications")
+}
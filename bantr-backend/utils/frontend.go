@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FrontendURL is the base URL of the web app, used for links we send users
+// to. It comes from FRONTEND_URL and has no trailing slash.
+func FrontendURL() string {
+	frontendURL := strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	return frontendURL
+}
+
+// BackendURL is the public base URL of this API, used for links to files we
+// serve like avatars. It comes from PUBLIC_URL and has no trailing slash.
+func BackendURL() string {
+	backendURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if backendURL == "" {
+		backendURL = "http://localhost:8080"
+	}
+	return backendURL
+}
+
+// SafeRedirectPath returns path if it's a path on the frontend, or "/" if it
+// isn't. Browsers treat backslashes like slashes, so "/\evil.com" would
+// leave the site as surely as "//evil.com" does.
+func SafeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsAny(path, "\\\r\n\t") {
+		return "/"
+	}
+	parsed, err := url.Parse(path)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.User != nil {
+		return "/"
+	}
+	return path
+}
+
+// MeetingURL is the link people follow to join a meeting
+func MeetingURL(roomID string) string {
+	return FrontendURL() + "/meetings/" + roomID
+}
+
+// InvitationURL is the page an invitee RSVPs on
+func InvitationURL(token string) string {
+	return FrontendURL() + "/invitations/" + url.PathEscape(token)
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestSafeRedirectPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/meetings/abc", "/meetings/abc"},
+		{"/settings?tab=security#2fa", "/settings?tab=security#2fa"},
+		{"", "/"},
+		{"meetings", "/"},
+		{"//evil.com", "/"},
+		{"/\\evil.com", "/"},
+		{"/\\/evil.com", "/"},
+		{"https://evil.com/", "/"},
+		{"/\nLocation: https://evil.com", "/"},
+		{"/\tevil.com", "/"},
+	}
+
+	for _, tt := range tests {
+		if got := SafeRedirectPath(tt.path); got != tt.want {
+			t.Errorf("SafeRedirectPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"os"
+
+	"google.golang.org/api/idtoken"
+)
+
+// GoogleProvider is the provider name Google identities are stored under
+const GoogleProvider = "google"
+
+// VerifyGoogleIDToken checks an ID token from Google Sign-In and returns the
+// profile in it
+func VerifyGoogleIDToken(ctx context.Context, token string) (*ExternalProfile, error) {
+	payload, err := idtoken.Validate(ctx, token, os.Getenv("GOOGLE_CLIENT_ID"))
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &ExternalProfile{
+		Provider: GoogleProvider,
+		Subject:  payload.Subject,
+	}
+	profile.Email, _ = payload.Claims["email"].(string)
+	profile.EmailVerified, _ = payload.Claims["email_verified"].(bool)
+	profile.Name, _ = payload.Claims["name"].(string)
+	profile.Picture, _ = payload.Claims["picture"].(string)
+	profile.HostedDomain, _ = payload.Claims["hd"].(string)
+	return profile, nil
+}
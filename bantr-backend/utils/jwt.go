@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"os"
 	"time"
 
 	"github.com/AnshX01/Bantr/bantr-backend/models"
@@ -10,42 +13,183 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// AccessTokenTTL is kept short since access tokens are checked against the
+// denylist but otherwise can't be taken back. Clients use their refresh
+// token to get a new one.
+const AccessTokenTTL = 15 * time.Minute
+
+// RefreshTokenTTL is how long a session stays alive without being used
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// MagicLinkTTL is how long an emailed login link stays valid
+const MagicLinkTTL = 15 * time.Minute
+
+// GuestTokenTTL is how long a guest can keep rejoining their meeting before
+// they have to ask for a new token
+const GuestTokenTTL = 4 * time.Hour
+
+// ChatLinkTTL is how long the link a slash command sends to connect a chat
+// account stays valid
+const ChatLinkTTL = 15 * time.Minute
+
+// longestTokenTTL is how long the longest-lived token we sign stays valid.
+// Keys that stop signing have to keep verifying for at least this long.
+func longestTokenTTL() time.Duration {
+	longest := AccessTokenTTL
+	for _, ttl := range []time.Duration{MagicLinkTTL, GuestTokenTTL, ChatLinkTTL} {
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest
+}
+
+// Every token we sign says what it's for so one kind can never be used as
+// another
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeMagicLink = "magic_link"
+	TokenTypeGuest     = "guest"
+	TokenTypeChatLink  = "chat_link"
+)
 
 type Claims struct {
-	UserID  string `json:"user_id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Picture   string `json:"picture"`
+	SessionID string `json:"sid,omitempty"`
+	RoomID    string `json:"room_id,omitempty"`
+	TokenType string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(user models.User) (string, error) {
-	expirationTime := time.Now().Add(72 * time.Hour)
-	
+// GenerateToken creates a new access token for a user's session
+func GenerateToken(user models.User, sessionID string) (string, error) {
+	now := time.Now()
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &Claims{
+		UserID:    user.ID.Hex(),
+		Email:     user.Email,
+		Name:      user.Name,
+		Picture:   user.Picture,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateMagicLinkToken creates the token emailed in a login link. The jti
+// is recorded separately so the link can only be used once.
+func GenerateMagicLinkToken(email, jti string) (string, error) {
+	now := time.Now()
+
 	claims := &Claims{
-		UserID:  user.ID.Hex(),
-		Email:   user.Email,
-		Name:    user.Name,
-		Picture: user.Picture,
+		Email:     email,
+		TokenType: TokenTypeMagicLink,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(MagicLinkTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signClaims(claims)
 }
 
-// VerifyToken validates and parses a JWT token
+// GenerateGuestToken creates a token that lets someone without an account
+// into a single meeting
+func GenerateGuestToken(guestID, name, roomID string) (string, error) {
+	now := time.Now()
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &Claims{
+		UserID:    guestID,
+		Name:      name,
+		RoomID:    roomID,
+		TokenType: TokenTypeGuest,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(GuestTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+func signClaims(claims *Claims) (string, error) {
+	key := keyring.signingKey()
+	if key == nil {
+		return "", errNoSigningKeys
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// GenerateRefreshToken returns a new opaque refresh token and the hash that
+// gets stored for it
+func GenerateRefreshToken() (token, hash string, err error) {
+	token, err = randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// HashToken hashes an opaque token for storage. Refresh tokens are random
+// enough that a plain SHA-256 is fine here.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateOpaqueToken returns a random URL-safe string for one-off values
+// like OAuth states and nonces
+func GenerateOpaqueToken() string {
+	token, err := randomToken(32)
+	if err != nil {
+		// crypto/rand doesn't fail on any platform we run on
+		panic(err)
+	}
+	return token
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// VerifyToken validates and parses an access token
 func VerifyToken(tokenString string) (*Claims, error) {
+	return VerifyTokenOfType(tokenString, TokenTypeAccess)
+}
+
+// VerifyTokenOfType validates a token and checks it was issued for the given
+// purpose
+func VerifyTokenOfType(tokenString, tokenType string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyring.verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -55,6 +199,10 @@ func VerifyToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if claims.TokenType != tokenType {
+		return nil, errors.New("wrong token type")
+	}
+
 	return claims, nil
 }
 
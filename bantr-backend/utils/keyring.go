@@ -0,0 +1,458 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signing keys live in JWT_KEYS_DIR as PKCS#8 PEM files. The file name minus
+// its extension is the key's kid, and the file's modification time is when
+// the key was created. New keys are published in the JWKS for a while before
+// they start signing so other services have time to pick them up, and old
+// keys keep verifying until every token they signed has expired.
+const (
+	defaultKeyRotationInterval = 30 * 24 * time.Hour
+	defaultKeyPublishDelay     = time.Hour
+	keyringReloadInterval      = time.Minute
+	// unknownKidReloadInterval limits how often tokens with a kid we don't
+	// know can make us re-read the key directory, since anyone can send one
+	unknownKidReloadInterval = 5 * time.Second
+)
+
+var errNoSigningKeys = errors.New("no signing keys found")
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// Keyring holds every key we accept tokens from and picks the one we sign
+// new tokens with
+type Keyring struct {
+	dir              string
+	rotationInterval time.Duration
+	publishDelay     time.Duration
+	algorithm        string
+
+	mutex   sync.RWMutex
+	keys    map[string]*signingKey
+	current *signingKey
+	// retiredAt is when each key stopped being the signing key
+	retiredAt map[string]time.Time
+	// lastKidReload is when a token with an unknown kid last caused a reload
+	lastKidReload time.Time
+}
+
+var keyring *Keyring
+
+// LoadKeyring reads the signing keys from JWT_KEYS_DIR. It has to be called
+// before any token is issued or verified, and fails if there isn't at least
+// one usable key.
+func LoadKeyring() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return errors.New("JWT_KEYS_DIR is not set")
+	}
+
+	rotationInterval, err := durationFromEnv("JWT_KEY_ROTATION_INTERVAL", defaultKeyRotationInterval)
+	if err != nil {
+		return err
+	}
+	publishDelay, err := durationFromEnv("JWT_KEY_PUBLISH_DELAY", defaultKeyPublishDelay)
+	if err != nil {
+		return err
+	}
+
+	algorithm := os.Getenv("JWT_KEY_ALG")
+	if algorithm == "" {
+		algorithm = jwt.SigningMethodEdDSA.Alg()
+	}
+	if algorithm != jwt.SigningMethodEdDSA.Alg() && algorithm != jwt.SigningMethodRS256.Alg() {
+		return fmt.Errorf("JWT_KEY_ALG must be EdDSA or RS256, got %q", algorithm)
+	}
+
+	kr := &Keyring{
+		dir:              dir,
+		rotationInterval: rotationInterval,
+		publishDelay:     publishDelay,
+		algorithm:        algorithm,
+		retiredAt:        make(map[string]time.Time),
+	}
+	if err := kr.reload(); err == errNoSigningKeys {
+		return fmt.Errorf("no signing keys found in %s, create one with: openssl genpkey -algorithm ed25519 -out %s", dir, filepath.Join(dir, "<kid>.pem"))
+	} else if err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d JWT signing keys, signing with %s", len(kr.keys), kr.current.kid)
+	keyring = kr
+	return nil
+}
+
+// RunKeyRotation periodically picks up keys added by other instances and
+// generates a new key once the current one is due for rotation. A rotation
+// interval of 0 turns generation off for setups where keys are managed
+// outside the server.
+func RunKeyRotation() {
+	ticker := time.NewTicker(keyringReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := keyring.rotate(); err != nil {
+			log.Printf("Error rotating JWT keys: %v", err)
+		}
+	}
+}
+
+func (kr *Keyring) rotate() error {
+	if err := kr.reload(); err != nil {
+		return err
+	}
+
+	kr.mutex.RLock()
+	newest := kr.newestKey()
+	kr.mutex.RUnlock()
+
+	// Generate the next key early enough that it has been published for the
+	// whole delay by the time the current one is due
+	if kr.rotationInterval > 0 && time.Since(newest.createdAt) >= kr.rotationInterval-kr.publishDelay {
+		kid, err := kr.generateKey()
+		if err != nil {
+			return err
+		}
+		log.Printf("Generated JWT signing key %s", kid)
+		if err := kr.reload(); err != nil {
+			return err
+		}
+	}
+
+	return kr.pruneRetired()
+}
+
+// reload re-reads the key directory and works out the signing key. If the
+// directory has no usable keys left the ones already loaded are kept, so a
+// bad deploy or a mistaken delete doesn't stop us issuing tokens.
+func (kr *Keyring) reload() error {
+	entries, err := os.ReadDir(kr.dir)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", kr.dir, err)
+	}
+
+	keys := make(map[string]*signingKey)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+
+		key, err := loadSigningKey(filepath.Join(kr.dir, entry.Name()))
+		if err != nil {
+			log.Printf("Skipping JWT key %s: %v", entry.Name(), err)
+			continue
+		}
+		keys[key.kid] = key
+	}
+
+	if len(keys) == 0 {
+		return errNoSigningKeys
+	}
+
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+
+	kr.keys = keys
+
+	current := kr.pickSigningKey()
+	if kr.current != nil && kr.current.kid != current.kid {
+		log.Printf("JWT signing key rotated from %s to %s", kr.current.kid, current.kid)
+		kr.retiredAt[kr.current.kid] = time.Now()
+	}
+	kr.current = current
+	return nil
+}
+
+// pickSigningKey returns the newest key that has been published long enough,
+// or the oldest key if none has. Callers must hold the mutex.
+func (kr *Keyring) pickSigningKey() *signingKey {
+	sorted := kr.sortedKeys()
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if time.Since(sorted[i].createdAt) >= kr.publishDelay {
+			return sorted[i]
+		}
+	}
+	return sorted[0]
+}
+
+// newestKey returns the most recently created key. Callers must hold the
+// mutex.
+func (kr *Keyring) newestKey() *signingKey {
+	sorted := kr.sortedKeys()
+	return sorted[len(sorted)-1]
+}
+
+func (kr *Keyring) sortedKeys() []*signingKey {
+	sorted := make([]*signingKey, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].createdAt.Equal(sorted[j].createdAt) {
+			return sorted[i].kid < sorted[j].kid
+		}
+		return sorted[i].createdAt.Before(sorted[j].createdAt)
+	})
+	return sorted
+}
+
+// pruneRetired deletes keys that stopped signing long enough ago that every
+// token they signed has expired, going by the longest-lived kind of token.
+// Only keys older than the signing key are considered so keys waiting to be
+// published are never touched.
+func (kr *Keyring) pruneRetired() error {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+
+	if kr.rotationInterval == 0 || kr.current == nil {
+		return nil
+	}
+
+	for kid, key := range kr.keys {
+		if !key.createdAt.Before(kr.current.createdAt) {
+			continue
+		}
+
+		retiredAt, ok := kr.retiredAt[kid]
+		if !ok {
+			// Retired before we started, count from when we first saw it
+			kr.retiredAt[kid] = time.Now()
+			continue
+		}
+		if time.Since(retiredAt) < longestTokenTTL() {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(kr.dir, kid+".pem")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		log.Printf("Removed retired JWT signing key %s", kid)
+		delete(kr.keys, kid)
+		delete(kr.retiredAt, kid)
+	}
+
+	return nil
+}
+
+func (kr *Keyring) generateKey() (string, error) {
+	var private any
+	if kr.algorithm == jwt.SigningMethodRS256.Alg() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return "", err
+		}
+		private = key
+	} else {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		private = key
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	kid := fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405Z"), suffix)
+	path := filepath.Join(kr.dir, kid+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return "", err
+	}
+	return kid, nil
+}
+
+func (kr *Keyring) signingKey() *signingKey {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	return kr.current
+}
+
+// verificationKey finds the key a token was signed with. A kid we don't know
+// triggers a reload since another instance may have just rotated, but no
+// more than once every few seconds.
+func (kr *Keyring) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	kr.mutex.RLock()
+	key, ok := kr.keys[kid]
+	kr.mutex.RUnlock()
+
+	if !ok {
+		if kr.claimKidReload() {
+			if err := kr.reload(); err != nil && err != errNoSigningKeys {
+				return nil, err
+			}
+		}
+		kr.mutex.RLock()
+		key, ok = kr.keys[kid]
+		kr.mutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %s", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.private.Public(), nil
+}
+
+// claimKidReload reports whether an unknown kid may reload the keys now,
+// and if so stops any other from doing it for a while
+func (kr *Keyring) claimKidReload() bool {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+
+	if time.Since(kr.lastKidReload) < unknownKidReloadInterval {
+		return false
+	}
+	kr.lastKidReload = time.Now()
+	return true
+}
+
+func loadSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:       strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		createdAt: info.ModTime(),
+	}
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.private = private
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.method = jwt.SigningMethodRS256
+		key.private = private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// JSONWebKey is a public key in JWK form
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// PublicJWKS returns the public half of every key we accept, including keys
+// that haven't started signing yet
+func PublicJWKS() []JSONWebKey {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	jwks := []JSONWebKey{}
+	for _, key := range keyring.sortedKeys() {
+		jwk := JSONWebKey{
+			KeyID:     key.kid,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	return jwks
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%s must be a duration like 720h", name)
+	}
+	return duration, nil
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testKey is a key file to put in the keyring's directory, created age ago
+type testKey struct {
+	kid string
+	age time.Duration
+}
+
+// newTestKeyring writes keys into a fresh directory and loads it
+func newTestKeyring(t *testing.T, rotationInterval, publishDelay time.Duration, keys []testKey) *Keyring {
+	t.Helper()
+
+	kr := &Keyring{
+		dir:              t.TempDir(),
+		rotationInterval: rotationInterval,
+		publishDelay:     publishDelay,
+		algorithm:        "EdDSA",
+		retiredAt:        make(map[string]time.Time),
+	}
+	for _, key := range keys {
+		writeTestKey(t, kr, key)
+	}
+	if err := kr.reload(); err != nil {
+		t.Fatalf("loading keyring: %v", err)
+	}
+	return kr
+}
+
+func writeTestKey(t *testing.T, kr *Keyring, key testKey) {
+	t.Helper()
+
+	generated, err := kr.generateKey()
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	path := filepath.Join(kr.dir, key.kid+".pem")
+	if err := os.Rename(filepath.Join(kr.dir, generated+".pem"), path); err != nil {
+		t.Fatalf("renaming key: %v", err)
+	}
+	createdAt := time.Now().Add(-key.age)
+	if err := os.Chtimes(path, createdAt, createdAt); err != nil {
+		t.Fatalf("backdating key: %v", err)
+	}
+}
+
+func TestKeyringSigningKey(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name string
+		keys []testKey
+		want string
+	}{
+		{
+			name: "only key signs even before it's published",
+			keys: []testKey{{"a", time.Minute}},
+			want: "a",
+		},
+		{
+			name: "new key waits out the publish delay",
+			keys: []testKey{{"old", 40 * day}, {"new", 10 * time.Minute}},
+			want: "old",
+		},
+		{
+			name: "published key takes over",
+			keys: []testKey{{"old", 40 * day}, {"new", 2 * time.Hour}},
+			want: "new",
+		},
+		{
+			name: "newest published key wins",
+			keys: []testKey{{"a", 60 * day}, {"b", 30 * day}, {"c", 10 * time.Minute}},
+			want: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := newTestKeyring(t, 30*day, time.Hour, tt.keys)
+			if got := kr.signingKey().kid; got != tt.want {
+				t.Errorf("signing key = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name             string
+		rotationInterval time.Duration
+		keys             []testKey
+		wantKeys         int
+		wantSigning      string
+	}{
+		{
+			name:             "current key not due",
+			rotationInterval: 30 * day,
+			keys:             []testKey{{"a", 10 * day}},
+			wantKeys:         1,
+			wantSigning:      "a",
+		},
+		{
+			name:             "next key is generated a publish delay early",
+			rotationInterval: 30 * day,
+			keys:             []testKey{{"a", 30*day - 30*time.Minute}},
+			wantKeys:         2,
+			wantSigning:      "a",
+		},
+		{
+			name:             "next key already waiting",
+			rotationInterval: 30 * day,
+			keys:             []testKey{{"a", 30*day - 30*time.Minute}, {"b", 30 * time.Minute}},
+			wantKeys:         2,
+			wantSigning:      "a",
+		},
+		{
+			name:             "rotation turned off",
+			rotationInterval: 0,
+			keys:             []testKey{{"a", 90 * day}},
+			wantKeys:         1,
+			wantSigning:      "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := newTestKeyring(t, tt.rotationInterval, time.Hour, tt.keys)
+			if err := kr.rotate(); err != nil {
+				t.Fatalf("rotate: %v", err)
+			}
+
+			if got := len(kr.keys); got != tt.wantKeys {
+				t.Errorf("keys = %d, want %d", got, tt.wantKeys)
+			}
+			if got := kr.signingKey().kid; got != tt.wantSigning {
+				t.Errorf("signing key = %s, want %s", got, tt.wantSigning)
+			}
+		})
+	}
+}
+
+func TestKeyringPruneRetired(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name string
+		// retiredFor is how long ago "old" stopped signing, or zero if we
+		// haven't seen it retire
+		retiredFor time.Duration
+		wantKept   bool
+	}{
+		{"retire time unknown", 0, true},
+		{"tokens it signed may still be valid", longestTokenTTL() / 2, true},
+		{"every token it signed has expired", longestTokenTTL() + time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := newTestKeyring(t, 30*day, time.Hour, []testKey{{"old", 40 * day}, {"new", 10 * day}})
+			if tt.retiredFor > 0 {
+				kr.retiredAt["old"] = time.Now().Add(-tt.retiredFor)
+			}
+
+			if err := kr.pruneRetired(); err != nil {
+				t.Fatalf("pruneRetired: %v", err)
+			}
+
+			_, inKeyring := kr.keys["old"]
+			_, statErr := os.Stat(filepath.Join(kr.dir, "old.pem"))
+			if inKeyring != tt.wantKept || (statErr == nil) != tt.wantKept {
+				t.Errorf("old key kept = %v (file error %v), want %v", inKeyring, statErr, tt.wantKept)
+			}
+			if _, ok := kr.keys["new"]; !ok {
+				t.Error("signing key was pruned")
+			}
+		})
+	}
+}
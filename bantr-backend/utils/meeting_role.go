@@ -0,0 +1,28 @@
+package utils
+
+import "github.com/AnshX01/Bantr/bantr-backend/models"
+
+// MeetingRole is the role a user effectively has in a meeting. On top of the
+// roles stored on the meeting, admins of the workspace that owns it count
+// as hosts.
+func MeetingRole(userID string, isGuest bool, meeting *models.Meeting) string {
+	role := meeting.RoleOf(userID, isGuest)
+	if isGuest || role == models.MeetingRoleHost || meeting.WorkspaceID == "" {
+		return role
+	}
+
+	workspaceRole, err := WorkspaceRole(meeting.WorkspaceID, userID)
+	if err == nil && models.IsWorkspaceAdmin(workspaceRole) {
+		return models.MeetingRoleHost
+	}
+	return role
+}
+
+// HasMeetingPermission checks whether a user's role in a meeting grants a
+// permission
+func HasMeetingPermission(userID string, isGuest bool, meeting *models.Meeting, permission string) bool {
+	if userID == "" {
+		return false
+	}
+	return models.RoleHasPermission(MeetingRole(userID, isGuest, meeting), permission)
+}
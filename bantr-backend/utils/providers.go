@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const (
+	ProviderTypeOIDC   = "oidc"
+	ProviderTypeGitHub = "github"
+)
+
+// ProviderConfig describes one external login provider. Providers come from
+// the JSON file named by AUTH_PROVIDERS_FILE, from OIDC_PROVIDERS plus the
+// matching OIDC_<NAME>_* variables, and from GITHUB_CLIENT_ID.
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+// ExternalProfile is what a provider tells us about the user who logged in
+type ExternalProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	// HostedDomain is the Google Workspace domain of the account, if any
+	HostedDomain string
+}
+
+// Identity converts the profile into the identity stored on the user
+func (p *ExternalProfile) Identity() models.Identity {
+	return models.Identity{
+		Provider:      p.Provider,
+		Subject:       p.Subject,
+		Email:         p.Email,
+		EmailVerified: p.EmailVerified,
+	}
+}
+
+// LoginProvider is an external account we can log users in with
+type LoginProvider interface {
+	Name() string
+	DisplayName() string
+	Type() string
+	// AuthCodeURL is where the user is sent to log in
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange trades the code from the callback for the user's profile
+	Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalProfile, error)
+}
+
+var (
+	loginProviders     = map[string]LoginProvider{}
+	providerNameFormat = regexp.MustCompile(`^[a-z0-9-]+$`)
+)
+
+// LoadLoginProviders builds the provider registry. Having no providers
+// configured is fine, only Google login is available then.
+func LoadLoginProviders() error {
+	configs, err := providerConfigsFromFile(os.Getenv("AUTH_PROVIDERS_FILE"))
+	if err != nil {
+		return err
+	}
+	configs = append(configs, providerConfigsFromEnv()...)
+
+	callbackBase := strings.TrimSuffix(os.Getenv("AUTH_CALLBACK_BASE_URL"), "/")
+	if callbackBase == "" {
+		callbackBase = BackendURL()
+	}
+
+	providers := map[string]LoginProvider{}
+	for _, config := range configs {
+		if !providerNameFormat.MatchString(config.Name) {
+			return fmt.Errorf("invalid login provider name %q", config.Name)
+		}
+		if _, exists := providers[config.Name]; exists {
+			return fmt.Errorf("login provider %s is configured twice", config.Name)
+		}
+		if config.ClientID == "" {
+			return fmt.Errorf("login provider %s has no client_id", config.Name)
+		}
+		if config.DisplayName == "" {
+			config.DisplayName = config.Name
+		}
+
+		oauthConfig := oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  callbackBase + "/api/auth/" + config.Name + "/callback",
+			Scopes:       config.Scopes,
+		}
+
+		switch config.Type {
+		case ProviderTypeOIDC:
+			if config.Issuer == "" {
+				return fmt.Errorf("login provider %s has no issuer", config.Name)
+			}
+			if len(oauthConfig.Scopes) == 0 {
+				oauthConfig.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+			}
+			providers[config.Name] = &oidcProvider{config: config, oauth: oauthConfig}
+		case ProviderTypeGitHub:
+			if len(oauthConfig.Scopes) == 0 {
+				oauthConfig.Scopes = []string{"read:user", "user:email"}
+			}
+			oauthConfig.Endpoint = github.Endpoint
+			providers[config.Name] = &githubProvider{config: config, oauth: oauthConfig}
+		default:
+			return fmt.Errorf("login provider %s has unknown type %q", config.Name, config.Type)
+		}
+
+		log.Printf("Registered %s login provider %s", config.Type, config.Name)
+	}
+
+	loginProviders = providers
+	return nil
+}
+
+// GetLoginProvider looks a provider up by name
+func GetLoginProvider(name string) (LoginProvider, bool) {
+	provider, ok := loginProviders[name]
+	return provider, ok
+}
+
+// ListLoginProviders returns every configured provider sorted by name
+func ListLoginProviders() []LoginProvider {
+	providers := make([]LoginProvider, 0, len(loginProviders))
+	for _, provider := range loginProviders {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers
+}
+
+func providerConfigsFromFile(path string) ([]ProviderConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+func providerConfigsFromEnv() []ProviderConfig {
+	var configs []ProviderConfig
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := ProviderConfig{
+			Name:         name,
+			Type:         ProviderTypeOIDC,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			config.Scopes = strings.Fields(scopes)
+		}
+		configs = append(configs, config)
+	}
+
+	if clientID := os.Getenv("GITHUB_CLIENT_ID"); clientID != "" {
+		configs = append(configs, ProviderConfig{
+			Name:         "github",
+			Type:         ProviderTypeGitHub,
+			DisplayName:  "GitHub",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		})
+	}
+
+	return configs
+}
+
+// oidcProvider works with any issuer that supports discovery. Discovery runs
+// the first time the provider is used so an unreachable issuer doesn't stop
+// the server from starting.
+type oidcProvider struct {
+	config ProviderConfig
+	oauth  oauth2.Config
+
+	mutex    sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+func (p *oidcProvider) Name() string        { return p.config.Name }
+func (p *oidcProvider) DisplayName() string { return p.config.DisplayName }
+func (p *oidcProvider) Type() string        { return ProviderTypeOIDC }
+
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.verifier == nil {
+		provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovering %s: %w", p.config.Issuer, err)
+		}
+		p.oauth.Endpoint = provider.Endpoint()
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	}
+
+	config := p.oauth
+	return &config, p.verifier, nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalProfile, error) {
+	config, idVerifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+	idToken, err := idVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+		Picture           string `json:"picture"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	profile := &ExternalProfile{
+		Provider: p.config.Name,
+		Subject:  idToken.Subject,
+		Email:    claims.Email,
+		// Issuers that leave the claim out get the address treated as
+		// unverified, since verified emails link to existing accounts
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}
+	if profile.Name == "" {
+		profile.Name = claims.PreferredUsername
+	}
+	return profile, nil
+}
+
+// githubProvider logs in with GitHub's OAuth apps, which don't speak OIDC, so
+// the profile comes from the REST API instead of an ID token
+type githubProvider struct {
+	config ProviderConfig
+	oauth  oauth2.Config
+}
+
+func (p *githubProvider) Name() string        { return p.config.Name }
+func (p *githubProvider) DisplayName() string { return p.config.DisplayName }
+func (p *githubProvider) Type() string        { return ProviderTypeGitHub }
+
+func (p *githubProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	return p.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *githubProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalProfile, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+	client := p.oauth.Client(ctx, token)
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getGitHubJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return nil, err
+	}
+
+	// The public profile email may not be verified, so use the primary
+	// address from the emails endpoint instead
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getGitHubJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	profile := &ExternalProfile{
+		Provider: p.config.Name,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+	}
+	if profile.Name == "" {
+		profile.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email = email.Email
+			profile.EmailVerified = email.Verified
+		}
+	}
+	return profile, nil
+}
+
+func getGitHubJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// SCIM schema URNs used in requests and responses
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMTokenPrefix starts every SCIM token so secret scanners can spot them
+const SCIMTokenPrefix = "bantr_scim_"
+
+var (
+	ErrInvalidSCIMFilter = errors.New("unsupported SCIM filter")
+	ErrInvalidSCIMToken  = errors.New("invalid SCIM token")
+)
+
+// GenerateSCIMToken returns a new SCIM token and the hash to store for it
+func GenerateSCIMToken() (token, hash string) {
+	token = SCIMTokenPrefix + GenerateOpaqueToken()
+	return token, HashToken(token)
+}
+
+// AuthenticateSCIMToken finds the workspace a SCIM token belongs to. Each
+// token only reaches that workspace and the users on its verified domains.
+func AuthenticateSCIMToken(token string) (*models.Workspace, error) {
+	if !strings.HasPrefix(token, SCIMTokenPrefix) {
+		return nil, ErrInvalidSCIMToken
+	}
+
+	workspace, err := models.FindWorkspaceBySCIMToken(GetWorkspacesCollection(), HashToken(token))
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidSCIMToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// SCIMManagesEmail reports whether a workspace's identity provider may
+// manage the account with this email, which is when the email is on one of
+// the workspace's verified domains
+func SCIMManagesEmail(workspace *models.Workspace, email string) bool {
+	_, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	if !ok {
+		return false
+	}
+	for _, d := range workspace.Domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// SCIMCondition is one "attribute eq value" comparison from a filter.
+// Attribute is lowercased since SCIM attribute names ignore case.
+type SCIMCondition struct {
+	Attribute string
+	Value     string
+}
+
+// ParseSCIMFilter understands the filters identity providers send in
+// practice: equality checks joined with "and", like
+// userName eq "jane@example.com" and active eq true
+func ParseSCIMFilter(filter string) ([]SCIMCondition, error) {
+	var conditions []SCIMCondition
+	rest := strings.TrimSpace(filter)
+
+	for rest != "" {
+		attribute, after := nextFilterWord(rest)
+		op, after := nextFilterWord(after)
+		if attribute == "" || !strings.EqualFold(op, "eq") {
+			return nil, ErrInvalidSCIMFilter
+		}
+
+		value, after, err := nextFilterValue(after)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, SCIMCondition{
+			Attribute: strings.ToLower(attribute),
+			Value:     value,
+		})
+
+		rest = strings.TrimSpace(after)
+		if rest == "" {
+			break
+		}
+		and, after := nextFilterWord(rest)
+		if !strings.EqualFold(and, "and") {
+			return nil, ErrInvalidSCIMFilter
+		}
+		rest = strings.TrimSpace(after)
+		if rest == "" {
+			return nil, ErrInvalidSCIMFilter
+		}
+	}
+
+	if len(conditions) == 0 {
+		return nil, ErrInvalidSCIMFilter
+	}
+	return conditions, nil
+}
+
+func nextFilterWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// nextFilterValue reads a quoted string or a bare true, false or number
+func nextFilterValue(s string) (value, rest string, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) {
+		value, rest = nextFilterWord(s)
+		if value == "" {
+			return "", "", ErrInvalidSCIMFilter
+		}
+		return value, rest, nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", ErrInvalidSCIMFilter
+			}
+			i++
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", ErrInvalidSCIMFilter
+}
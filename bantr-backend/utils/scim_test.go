@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		want    []SCIMCondition
+		wantErr bool
+	}{
+		{
+			filter: `userName eq "jane@example.com"`,
+			want:   []SCIMCondition{{"username", "jane@example.com"}},
+		},
+		{
+			filter: `userName EQ "jane@example.com" AND active eq true`,
+			want:   []SCIMCondition{{"username", "jane@example.com"}, {"active", "true"}},
+		},
+		{
+			filter: `  externalId eq "00u1"  and  displayName eq "Jane Doe"  `,
+			want:   []SCIMCondition{{"externalid", "00u1"}, {"displayname", "Jane Doe"}},
+		},
+		{
+			filter: `displayName eq "say \"hi\" \\ bye"`,
+			want:   []SCIMCondition{{"displayname", `say "hi" \ bye`}},
+		},
+		{
+			filter: `value eq "5f1d7c"`,
+			want:   []SCIMCondition{{"value", "5f1d7c"}},
+		},
+		{filter: ``, wantErr: true},
+		{filter: `userName`, wantErr: true},
+		{filter: `userName eq`, wantErr: true},
+		{filter: `userName co "jane"`, wantErr: true},
+		{filter: `userName eq "jane`, wantErr: true},
+		{filter: `userName eq "jane\`, wantErr: true},
+		{filter: `userName eq "jane" or active eq true`, wantErr: true},
+		{filter: `userName eq "jane" and`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSCIMFilter(tt.filter)
+		if tt.wantErr {
+			if err != ErrInvalidSCIMFilter {
+				t.Errorf("ParseSCIMFilter(%q) err = %v, want ErrInvalidSCIMFilter", tt.filter, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSCIMFilter(%q) err = %v", tt.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSCIMFilter(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestSCIMManagesEmail(t *testing.T) {
+	workspace := &models.Workspace{Domains: []string{"example.com", "example.org"}}
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"jane@example.com", true},
+		{"Jane@Example.ORG", true},
+		{"jane@sub.example.com", false},
+		{"jane@example.com.evil.com", false},
+		{"jane@gmail.com", false},
+		{"example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := SCIMManagesEmail(workspace, tt.email); got != tt.want {
+			t.Errorf("SCIMManagesEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+
+	if SCIMManagesEmail(&models.Workspace{}, "jane@example.com") {
+		t.Error("workspace without domains manages an email")
+	}
+}
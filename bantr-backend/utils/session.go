@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TokenPair is what every login and refresh hands back to the client
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	SessionID    string `json:"session_id"`
+}
+
+// IssueSession starts a new session for a user and returns its first pair of
+// tokens. All login flows should go through here.
+func IssueSession(user models.User, userAgent, ipAddress string) (*TokenPair, error) {
+	if user.Deactivated {
+		return nil, models.ErrUserDeactivated
+	}
+
+	refreshToken, refreshHash, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:           user.ID.Hex(),
+		RefreshTokenHash: refreshHash,
+		UserAgent:        userAgent,
+		IPAddress:        ipAddress,
+		ExpiresAt:        time.Now().Add(RefreshTokenTTL),
+	}
+	if err := models.CreateSession(GetSessionsCollection(), session); err != nil {
+		return nil, err
+	}
+
+	return newTokenPair(user, session.ID.Hex(), refreshToken)
+}
+
+// RefreshSession trades a refresh token for a new token pair. The refresh
+// token is rotated, so the old one stops working.
+func RefreshSession(refreshToken string) (*TokenPair, *models.User, error) {
+	newToken, newHash, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := models.RotateRefreshToken(GetSessionsCollection(), HashToken(refreshToken), newHash, time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		if err == models.ErrRefreshTokenReused {
+			// Kill any access tokens the thief may already hold
+			RevokeSessionTokens(session.ID.Hex())
+		}
+		return nil, nil, err
+	}
+
+	userID, err := bson.ObjectIDFromHex(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := models.FindUserByID(GetUsersCollection(), userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Deactivated {
+		return nil, nil, models.ErrUserDeactivated
+	}
+
+	pair, err := newTokenPair(*user, session.ID.Hex(), newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+func newTokenPair(user models.User, sessionID, refreshToken string) (*TokenPair, error) {
+	accessToken, err := GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// RevokeSession ends a session. The refresh token stops working and every
+// access token issued for the session is denylisted until it would have
+// expired.
+func RevokeSession(sessionID string) error {
+	id, err := bson.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := models.RevokeSession(GetSessionsCollection(), id); err != nil {
+		return err
+	}
+	return RevokeSessionTokens(sessionID)
+}
+
+// RevokeUserSessions ends every session a user still has open
+func RevokeUserSessions(userID string) error {
+	sessions, err := models.GetUserSessions(GetSessionsCollection(), userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.RevokedAt == nil {
+			if err := RevokeSession(session.ID.Hex()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsUserDeactivated checks whether the user behind a token has been
+// deactivated since it was issued
+func IsUserDeactivated(userID string) (bool, error) {
+	id, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return true, nil
+	}
+	return models.IsUserDeactivated(GetUsersCollection(), id)
+}
+
+// RevokeSessionTokens denylists the access tokens of a session without
+// touching the session itself
+func RevokeSessionTokens(sessionID string) error {
+	return models.RevokeSessionTokens(GetRevokedTokensCollection(), sessionID, time.Now().Add(AccessTokenTTL))
+}
+
+// IsTokenRevoked checks whether an access token has been denylisted, either
+// on its own or through its session
+func IsTokenRevoked(claims *Claims) (bool, error) {
+	return models.IsTokenRevoked(GetRevokedTokensCollection(), claims.ID, claims.SessionID)
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 SHA-1 test vectors, cut down to our six digits
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	key, _ := totpEncoding.DecodeString(secret)
+	now := time.Now().Unix() / totpPeriod
+	current := totpCode(key, now)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantOK   bool
+	}{
+		{"current code", secret, current, 0, true},
+		{"code from the last period", secret, totpCode(key, now-1), 0, true},
+		{"code from the next period", secret, totpCode(key, now+1), 0, true},
+		{"code from too long ago", secret, totpCode(key, now-totpSkew-1), 0, false},
+		{"spaces are ignored", secret, current[:3] + " " + current[3:], 0, true},
+		{"lowercase secret", strings.ToLower(secret), current, 0, true},
+		{"code already used", secret, current, now, false},
+		{"too short", secret, current[:5], 0, false},
+		{"secret isn't base32", "not base32!", current, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, tt.lastStep)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step <= tt.lastStep {
+				t.Errorf("step = %d, want after %d", step, tt.lastStep)
+			}
+		})
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}-[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q isn't four groups of five base32 characters", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash for %q doesn't match HashRecoveryCode", code)
+		}
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("abcde-fghij-klmno-pqrst")
+
+	tests := []string{
+		"ABCDE-FGHIJ-KLMNO-PQRST",
+		"abcdefghijklmnopqrst",
+		" abcde fghij klmno pqrst ",
+	}
+
+	for _, code := range tests {
+		if got := HashRecoveryCode(code); got != want {
+			t.Errorf("HashRecoveryCode(%q) doesn't match the canonical form", code)
+		}
+	}
+}
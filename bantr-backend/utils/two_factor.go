@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TwoFactorChallengeTTL is how long a user has to enter their code after
+// the first login step
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// LoginResult is either a new session or, for users with 2FA, a challenge
+// token to trade for one together with a code
+type LoginResult struct {
+	Tokens         *TokenPair
+	ChallengeToken string
+}
+
+// BeginLogin is called once a user has proven who they are with their login
+// provider. Users without 2FA get their session straight away.
+// Deactivated users get ErrUserDeactivated.
+func BeginLogin(user models.User, userAgent, ipAddress string) (*LoginResult, error) {
+	if user.Deactivated {
+		return nil, models.ErrUserDeactivated
+	}
+
+	if !user.HasTwoFactor() {
+		tokens, err := IssueSession(user, userAgent, ipAddress)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Tokens: tokens}, nil
+	}
+
+	token := GenerateOpaqueToken()
+	challenge := &models.TwoFactorChallenge{
+		TokenHash: HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(TwoFactorChallengeTTL),
+	}
+	if err := models.CreateTwoFactorChallenge(GetTwoFactorChallengesCollection(), challenge); err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{ChallengeToken: token}, nil
+}
+
+// VerifyTwoFactorCode checks a code from the user's authenticator app, or
+// failing that one of their recovery codes. Either only works once. Wrong
+// codes count towards locking the user's 2FA, and while it's locked every
+// code fails with models.ErrTwoFactorLocked.
+func VerifyTwoFactorCode(user *models.User, code string) (bool, error) {
+	if !user.HasTwoFactor() {
+		return false, nil
+	}
+	if user.TwoFactorLocked() {
+		return false, models.ErrTwoFactorLocked
+	}
+
+	valid, err := checkTwoFactorCode(user, code)
+	if err != nil {
+		return false, err
+	}
+
+	usersCollection := GetUsersCollection()
+	if !valid {
+		return false, models.RecordTwoFactorFailure(usersCollection, user.ID)
+	}
+	if user.TwoFactor.FailedAttempts > 0 {
+		models.ResetTwoFactorFailures(usersCollection, user.ID)
+	}
+	return true, nil
+}
+
+func checkTwoFactorCode(user *models.User, code string) (bool, error) {
+	usersCollection := GetUsersCollection()
+	if step, ok := ValidateTOTP(user.TwoFactor.Secret, code, user.TwoFactor.LastStep); ok {
+		err := models.RecordTwoFactorStep(usersCollection, user.ID, step)
+		if err == models.ErrTwoFactorCodeUsed {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err := models.ConsumeRecoveryCode(usersCollection, user.ID, HashRecoveryCode(code))
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WebhookDeliveryLogTTL is how long deliveries are kept for the log
+const WebhookDeliveryLogTTL = 30 * 24 * time.Hour
+
+// Headers sent with every delivery. The signature header looks like
+// t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">, so receivers
+// can reject old replays as well as forgeries.
+const (
+	WebhookSignatureHeader = "X-Bantr-Signature"
+	WebhookEventHeader     = "X-Bantr-Event"
+	WebhookDeliveryHeader  = "X-Bantr-Delivery"
+)
+
+// ValidateWebhookURL checks that a URL is something we're willing to send
+// to. Only HTTPS is allowed unless private addresses are.
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("URL is not valid")
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	if u.Scheme == "http" && os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true" {
+		return nil
+	}
+	return errors.New("URL must use https")
+}
+
+// GenerateWebhookSecret returns a new signing secret
+func GenerateWebhookSecret() string {
+	return "whsec_" + GenerateOpaqueToken()
+}
+
+// SignWebhookPayload builds the signature header for a payload
+func SignWebhookPayload(secret string, timestamp time.Time, payload []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeleteUserWebhooks removes a user's personal webhooks and their logs
+func DeleteUserWebhooks(userID string) error {
+	return models.DeleteWebhooks(GetWebhooksCollection(), GetWebhookDeliveriesCollection(), bson.M{"user_id": userID})
+}
+
+// DeleteWorkspaceWebhooks removes a workspace's webhooks and their logs
+func DeleteWorkspaceWebhooks(workspaceID string) error {
+	return models.DeleteWebhooks(GetWebhooksCollection(), GetWebhookDeliveriesCollection(), bson.M{"workspace_id": workspaceID})
+}
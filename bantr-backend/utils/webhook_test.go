@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// The expected signatures were worked out separately, with Python's hmac
+// module, so they pin down the exact format receivers verify against
+func TestSignWebhookPayload(t *testing.T) {
+	payload := []byte(`{"type":"meeting.started"}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		payload   []byte
+		want      string
+	}{
+		{
+			name:      "event",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			payload:   payload,
+			want:      "t=1700000000,v1=0c73d3049b9e3e38875f8e472965145698e8fb38c3358b3f0b2b8aa8551368a6",
+		},
+		{
+			name:      "timestamp is signed",
+			secret:    "whsec_test",
+			timestamp: 1700000001,
+			payload:   payload,
+			want:      "t=1700000001,v1=a4115f6d925a603c852dedb42d911c9c7627c79f0d0ad12d09361d0fd84bfd2f",
+		},
+		{
+			name:      "other secret",
+			secret:    "whsec_other",
+			timestamp: 1700000000,
+			payload:   payload,
+			want:      "t=1700000000,v1=30e744c63a25cb79d1432afe00fccc8f3496c918d404ccab927b3db4a4b55623",
+		},
+		{
+			name:      "empty body",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			payload:   nil,
+			want:      "t=1700000000,v1=5967f3c560522fa40cf2876ebc3c3a08551dd6959aaade3b413460591895bdcc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SignWebhookPayload(tt.secret, time.Unix(tt.timestamp, 0), tt.payload)
+			if got != tt.want {
+				t.Errorf("SignWebhookPayload = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"https://hooks.example.com/bantr", false, false},
+		{"http://hooks.example.com/bantr", false, true},
+		{"http://localhost:8080/hook", true, false},
+		{"ftp://hooks.example.com/", true, true},
+		{"https://", false, true},
+		{"not a url", false, true},
+	}
+
+	for _, tt := range tests {
+		if tt.allowPrivate {
+			t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+		} else {
+			t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+		}
+
+		err := ValidateWebhookURL(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateWebhookURL(%q) with private allowed %v: err = %v, want error %v", tt.url, tt.allowPrivate, err, tt.wantErr)
+		}
+	}
+}
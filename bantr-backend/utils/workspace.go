@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// WorkspaceRole returns the user's role in a workspace, or "" if they
+// aren't a member
+func WorkspaceRole(workspaceID, userID string) (string, error) {
+	id, err := bson.ObjectIDFromHex(workspaceID)
+	if err != nil {
+		return "", nil
+	}
+
+	member, err := models.FindWorkspaceMember(GetWorkspaceMembersCollection(), id, userID)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// JoinWorkspaceByDomain adds a user to the workspace that claimed their
+// Google Workspace domain. Google only sets the hosted domain for accounts
+// the organization manages, so the email can't just be made up.
+func JoinWorkspaceByDomain(user *models.User, hostedDomain string) {
+	domain := strings.ToLower(hostedDomain)
+	if domain == "" {
+		return
+	}
+
+	workspace, err := models.FindWorkspaceByDomain(GetWorkspacesCollection(), domain)
+	if err != nil {
+		return
+	}
+
+	member := &models.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID.Hex(),
+		Role:        models.WorkspaceRoleMember,
+	}
+	err = models.AddWorkspaceMember(GetWorkspaceMembersCollection(), member)
+	if err != nil && err != models.ErrAlreadyMember {
+		log.Printf("Error auto-joining %s to workspace %s: %v", user.Email, workspace.ID.Hex(), err)
+	}
+}
+
+// domainVerificationPrefix is the label under a domain where the workspace's
+// verification TXT record goes
+const domainVerificationPrefix = "_bantr-verification."
+
+// DomainVerificationRecord is the name and value of the TXT record that
+// proves a workspace controls domain
+func DomainVerificationRecord(domain, token string) (string, string) {
+	return domainVerificationPrefix + domain, "bantr-verification=" + token
+}
+
+// HasDomainVerification reports whether domain publishes the workspace's
+// verification record. Lookup failures count as not verified.
+func HasDomainVerification(domain, token string) bool {
+	if token == "" {
+		return false
+	}
+	name, value := DomainVerificationRecord(domain, token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	records, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		log.Printf("Error looking up verification record for %s: %v", domain, err)
+		return false
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -7,11 +7,14 @@ import (
 	"math/big"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/AnshX01/Bantr/bantr-backend/models"
 	"github.com/AnshX01/Bantr/bantr-backend/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 var upgrader = websocket.Upgrader{
@@ -22,21 +25,29 @@ var upgrader = websocket.Upgrader{
 }
 
 type Hub struct {
-	rooms      map[string]*models.Room
-	clients    map[string]*models.Client
-	register   chan *models.Client
-	unregister chan *models.Client
-	broadcast  chan []byte
-	mutex      sync.RWMutex
+	rooms    map[string]*models.Room
+	sfuRooms map[string]*sfuRoom
+	speakers map[string]*speakerDetector
+	clients  map[string]*models.Client
+	// userChannels holds the connections subscribed to each user's
+	// notifications, whether or not they are in a room
+	userChannels map[string]map[string]*models.Client
+	register     chan *models.Client
+	unregister   chan *models.Client
+	broadcast    chan []byte
+	mutex        sync.RWMutex
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		rooms:      make(map[string]*models.Room),
-		clients:    make(map[string]*models.Client),
-		register:   make(chan *models.Client),
-		unregister: make(chan *models.Client),
-		broadcast:  make(chan []byte),
+		rooms:        make(map[string]*models.Room),
+		sfuRooms:     make(map[string]*sfuRoom),
+		speakers:     make(map[string]*speakerDetector),
+		clients:      make(map[string]*models.Client),
+		userChannels: make(map[string]map[string]*models.Client),
+		register:     make(chan *models.Client),
+		unregister:   make(chan *models.Client),
+		broadcast:    make(chan []byte),
 	}
 }
 
@@ -70,20 +81,34 @@ func (h *Hub) unregisterClient(client *models.Client) {
 	if _, ok := h.clients[client.ID]; ok {
 		if client.RoomID != "" {
 			if room, exists := h.rooms[client.RoomID]; exists {
+				sfu := h.sfuRooms[client.RoomID]
+				speakers := h.speakers[client.RoomID]
+
 				room.RemoveClient(client.ID)
+				models.PublishEvent(models.Event{
+					Type:        models.EventParticipantLeft,
+					RoomID:      client.RoomID,
+					Participant: models.NewEventParticipant(client),
+				})
 				
-				if client.UserID != "" {
-					meetingsCollection := utils.GetMeetingsCollection()
-					err := models.RemoveParticipant(meetingsCollection, client.RoomID, client.UserID)
-					if err != nil {
-						log.Printf("Error removing participant %s from room %s: %v", client.UserID, client.RoomID, err)
-					}
-				}
-				
-				if room.GetClientCount() == 0 {
+				empty := room.GetClientCount() == 0
+				if empty {
+					delete(h.sfuRooms, client.RoomID)
+					delete(h.speakers, client.RoomID)
 					delete(h.rooms, client.RoomID)
 					log.Printf("Room %s deleted (empty)", client.RoomID)
 				}
+				
+				// Everything else touches the database or disk, so it runs
+				// off the hub lock
+				go leaveRoom(client, sfu, speakers, empty)
+			}
+		}
+		
+		if channel, ok := h.userChannels[client.NotificationUserID]; ok {
+			delete(channel, client.ID)
+			if len(channel) == 0 {
+				delete(h.userChannels, client.NotificationUserID)
 			}
 		}
 		
@@ -93,18 +118,74 @@ func (h *Hub) unregisterClient(client *models.Client) {
 	}
 }
 
+// leaveRoom finishes a client leaving a room once unregisterClient has taken
+// it out of the hub: it drops the client's SFU connection and saves their
+// attendance and speaking time, then shuts the SFU down, along with any
+// recording, if the room is now empty
+func leaveRoom(client *models.Client, sfu *sfuRoom, speakers *speakerDetector, empty bool) {
+	if sfu != nil {
+		sfu.removePeer(client.ID)
+	}
+	if speakers != nil {
+		speakers.removeClient(client)
+	}
+	
+	if !client.AttendanceID.IsZero() {
+		models.RecordLeave(utils.GetAttendanceCollection(), client.AttendanceID)
+	}
+	
+	if client.UserID != "" && !client.IsGuest {
+		meetingsCollection := utils.GetMeetingsCollection()
+		err := models.RemoveParticipant(meetingsCollection, client.RoomID, client.UserID)
+		if err != nil {
+			log.Printf("Error removing participant %s from room %s: %v", client.UserID, client.RoomID, err)
+		}
+	}
+	
+	if !empty {
+		return
+	}
+	if sfu != nil {
+		sfu.close()
+	}
+	if speakers != nil {
+		speakers.close()
+	}
+}
+
 func (h *Hub) JoinRoom(client *models.Client, roomID string) error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	
 	if _, exists := h.rooms[roomID]; !exists {
-		h.rooms[roomID] = models.NewRoom(roomID)
-		log.Printf("Room %s created", roomID)
+		room := models.NewRoom(roomID)
+		room.MediaMode = lookupMediaMode(roomID)
+		h.rooms[roomID] = room
+		speakers := newSpeakerDetector(roomID, func(speaker *models.Client) {
+			h.announceActiveSpeaker(roomID, speaker)
+		})
+		h.speakers[roomID] = speakers
+		if room.MediaMode == models.MediaModeSFU {
+			h.sfuRooms[roomID] = newSFURoom(roomID, speakers)
+		}
+		log.Printf("Room %s created (%s mode)", roomID, room.MediaMode)
+		// The meeting starts when the first person joins an empty room
+		models.PublishEvent(models.Event{
+			Type:        models.EventMeetingStarted,
+			RoomID:      roomID,
+			Participant: models.NewEventParticipant(client),
+		})
 	}
 	
 	room := h.rooms[roomID]
 	room.AddClient(client)
 	
+	models.PublishEvent(models.Event{
+		Type:        models.EventParticipantJoined,
+		RoomID:      roomID,
+		Participant: models.NewEventParticipant(client),
+	})
+	
 	return nil
 }
 
@@ -176,6 +257,24 @@ func (h *Hub) handleMessage(client *models.Client, message models.WebSocketMessa
 	case models.MessageTypeIceCandidate:
 		h.handleIceCandidate(client, message)
 		
+	case models.MessageTypeStartRecording:
+		h.handleStartRecording(client)
+		
+	case models.MessageTypeStopRecording:
+		h.handleStopRecording(client)
+		
+	case models.MessageTypeSetPreferredLayer:
+		h.handleSetPreferredLayer(client, message)
+		
+	case models.MessageTypeAudioLevel:
+		h.handleAudioLevel(client, message)
+		
+	case models.MessageTypeE2EEKey:
+		h.handleE2EEKey(client, message)
+		
+	case models.MessageTypeSubscribeNotifications:
+		h.handleSubscribeNotifications(client, message)
+		
 	default:
 		log.Printf("Unknown message type: %s", message.Type)
 	}
@@ -189,8 +288,27 @@ func (h *Hub) handleJoinRoom(client *models.Client, message models.WebSocketMess
 		return
 	}
 	
-	client.UserID = joinData.UserID
-	client.Name = joinData.Name
+	meetingsCollection := utils.GetMeetingsCollection()
+	meeting, err := models.FindMeetingByRoomID(meetingsCollection, joinData.RoomID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		h.sendError(client, "Failed to join room")
+		return
+	}
+	
+	if errorMsg := authenticateJoin(client, joinData, meeting); errorMsg != "" {
+		h.sendError(client, errorMsg)
+		return
+	}
+	
+	if meeting != nil && meeting.Settings.E2EERequired && !joinData.E2EESupported {
+		h.sendError(client, "This meeting requires end-to-end encryption support")
+		return
+	}
+	
+	if meeting != nil && meeting.Settings.RequireHost2FA && client.UserID == meeting.CreatedBy && !hasTwoFactor(client.UserID) {
+		h.sendError(client, "This meeting requires the host to have two-factor authentication enabled")
+		return
+	}
 	
 	if err := h.JoinRoom(client, joinData.RoomID); err != nil {
 		log.Printf("Error joining room: %v", err)
@@ -199,6 +317,227 @@ func (h *Hub) handleJoinRoom(client *models.Client, message models.WebSocketMess
 	}
 	
 	log.Printf("Client %s joined room %s", client.UserID, joinData.RoomID)
+	
+	attendance := &models.Attendance{
+		RoomID:  joinData.RoomID,
+		UserID:  client.UserID,
+		Name:    client.Name,
+		IsGuest: client.IsGuest,
+	}
+	if err := models.RecordJoin(utils.GetAttendanceCollection(), attendance); err == nil {
+		client.AttendanceID = attendance.ID
+	}
+	
+	h.mutex.RLock()
+	room := h.rooms[joinData.RoomID]
+	h.mutex.RUnlock()
+	if room != nil {
+		h.sendMessage(client, models.MessageTypeRoomState, room.State())
+	}
+	
+	// Late joiners need to see the recording indicator too
+	if sfu := h.getSFURoom(client); sfu != nil {
+		if recorder := sfu.activeRecorder(); recorder != nil {
+			h.sendMessage(client, models.MessageTypeRecordingState, recorder.state())
+		}
+	}
+}
+
+// authenticateJoin works out who is joining from the token in the join
+// message. Account holders can join any room, guests only the room their
+// token was issued for and only while the meeting allows guests. Bots and
+// other integrations join with an API key that has the rooms:join scope.
+// It returns an error message for the client, or "" if the join can go
+// ahead.
+func authenticateJoin(client *models.Client, joinData models.JoinRoomData, meeting *models.Meeting) string {
+	if joinData.Token == "" {
+		return "Authentication required"
+	}
+	
+	if utils.IsAPIKey(joinData.Token) {
+		key, user, err := utils.AuthenticateAPIKey(joinData.Token)
+		if err != nil {
+			return "Invalid or expired API key"
+		}
+		if !key.HasScope(models.ScopeRoomsJoin) {
+			return "API key is missing the " + models.ScopeRoomsJoin + " scope"
+		}
+		if !canIdentifyAs(client, user.ID.Hex(), false) {
+			return errOtherIdentity
+		}
+		
+		client.UserID = user.ID.Hex()
+		client.APIKeyID = key.ID.Hex()
+		client.IsBot = user.IsBot
+		client.Name = joinData.Name
+		if client.Name == "" {
+			client.Name = user.Name
+		}
+		return ""
+	}
+	
+	if claims, err := utils.VerifyToken(joinData.Token); err == nil {
+		if errorMsg := checkAccessToken(claims); errorMsg != "" {
+			return errorMsg
+		}
+		if !canIdentifyAs(client, claims.UserID, false) {
+			return errOtherIdentity
+		}
+		
+		client.UserID = claims.UserID
+		client.SessionID = claims.SessionID
+		client.Name = joinData.Name
+		if client.Name == "" {
+			client.Name = meetingDisplayName(claims)
+		}
+		return ""
+	}
+	
+	claims, err := utils.VerifyTokenOfType(joinData.Token, utils.TokenTypeGuest)
+	if err != nil {
+		return "Invalid or expired token"
+	}
+	if claims.RoomID != joinData.RoomID || meeting == nil || !meeting.Settings.AllowGuests {
+		return "Guest access is not allowed for this meeting"
+	}
+	if !canIdentifyAs(client, claims.UserID, true) {
+		return errOtherIdentity
+	}
+	
+	client.UserID = claims.UserID
+	client.Name = claims.Name
+	client.IsGuest = true
+	return ""
+}
+
+// checkAccessToken makes sure a verified access token is still good to
+// use. It returns an error message for the client, or "".
+func checkAccessToken(claims *utils.Claims) string {
+	if revoked, err := utils.IsTokenRevoked(claims); err != nil || revoked {
+		return "Invalid or expired token"
+	}
+	if deactivated, err := utils.IsUserDeactivated(claims.UserID); err != nil || deactivated {
+		return "Account deactivated"
+	}
+	return ""
+}
+
+const errOtherIdentity = "This connection is signed in as someone else"
+
+// canIdentifyAs reports whether a connection can act as the given user. A
+// connection subscribed to notifications stays that user, so it can't later
+// join a room as someone else and keep getting their notifications.
+func canIdentifyAs(client *models.Client, userID string, isGuest bool) bool {
+	if client.NotificationUserID == "" {
+		return true
+	}
+	return !isGuest && userID == client.NotificationUserID
+}
+
+// handleSubscribeNotifications starts sending a user's notifications down
+// the connection. Only account holders have notifications, so it takes an
+// access token rather than a guest token or API key.
+func (h *Hub) handleSubscribeNotifications(client *models.Client, message models.WebSocketMessage) {
+	var subscribeData models.SubscribeNotificationsData
+	if err := json.Unmarshal(message.Data, &subscribeData); err != nil || subscribeData.Token == "" {
+		h.sendError(client, "Authentication required")
+		return
+	}
+	
+	claims, err := utils.VerifyToken(subscribeData.Token)
+	if err != nil {
+		h.sendError(client, "Invalid or expired token")
+		return
+	}
+	if errorMsg := checkAccessToken(claims); errorMsg != "" {
+		h.sendError(client, errorMsg)
+		return
+	}
+	
+	h.mutex.Lock()
+	if client.UserID != "" && (client.IsGuest || client.UserID != claims.UserID) {
+		h.mutex.Unlock()
+		h.sendError(client, errOtherIdentity)
+		return
+	}
+	if client.UserID == "" {
+		client.UserID = claims.UserID
+		client.SessionID = claims.SessionID
+	}
+	client.NotificationUserID = claims.UserID
+	channel, ok := h.userChannels[claims.UserID]
+	if !ok {
+		channel = make(map[string]*models.Client)
+		h.userChannels[claims.UserID] = channel
+	}
+	channel[client.ID] = client
+	h.mutex.Unlock()
+	
+	unread, _ := models.CountUnreadNotifications(utils.GetNotificationsCollection(), claims.UserID)
+	h.sendMessage(client, models.MessageTypeNotificationsSubscribed, models.NotificationsSubscribedData{
+		UnreadCount: unread,
+	})
+}
+
+// SendToUser sends a server event to every connection subscribed to a
+// user's notifications
+func (h *Hub) SendToUser(userID string, messageType models.MessageType, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling %s data: %v", messageType, err)
+		return
+	}
+	
+	messageBytes, err := json.Marshal(models.WebSocketMessage{
+		Type: messageType,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	
+	// The read lock keeps unregisterClient from closing Send under us
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	
+	for _, client := range h.userChannels[userID] {
+		select {
+		case client.Send <- messageBytes:
+		default:
+			log.Printf("Dropping %s for client %s: send buffer full", messageType, client.ID)
+		}
+	}
+}
+
+// hasTwoFactor checks the user's account for 2FA. Lookup failures count as
+// not having it.
+func hasTwoFactor(userID string) bool {
+	id, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return false
+	}
+
+	user, err := models.FindUserByID(utils.GetUsersCollection(), id)
+	if err != nil {
+		return false
+	}
+	return user.HasTwoFactor()
+}
+
+// meetingDisplayName is the user's preferred meeting name, falling back to
+// the name on their account
+func meetingDisplayName(claims *utils.Claims) string {
+	userID, err := bson.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return claims.Name
+	}
+
+	prefs, err := models.GetPreferences(utils.GetPreferencesCollection(), userID)
+	if err != nil || prefs.DisplayName == "" {
+		return claims.Name
+	}
+	return prefs.DisplayName
 }
 
 func (h *Hub) handleOffer(client *models.Client, message models.WebSocketMessage) {
@@ -208,6 +547,26 @@ func (h *Hub) handleOffer(client *models.Client, message models.WebSocketMessage
 		return
 	}
 	
+	// Offers announce the streams that carry a screen share, so presenting
+	// is checked before they're negotiated or passed on
+	if len(offerData.ScreenStreamIDs) > 0 && !hasMeetingPermission(client, models.PermissionPresent) {
+		h.sendError(client, "You don't have permission to share your screen")
+		return
+	}
+	
+	if offerData.Target == models.ServerTarget {
+		sfu := h.getSFURoom(client)
+		if sfu == nil {
+			h.sendError(client, "Room is not running in SFU mode")
+			return
+		}
+		if err := sfu.handleOffer(client, offerData); err != nil {
+			log.Printf("Error handling SFU offer from %s: %v", client.UserID, err)
+			h.sendError(client, "Failed to negotiate with server")
+		}
+		return
+	}
+	
 	h.forwardToTarget(client, offerData.Target, models.MessageTypeOffer, message.Data)
 }
 
@@ -218,6 +577,19 @@ func (h *Hub) handleAnswer(client *models.Client, message models.WebSocketMessag
 		return
 	}
 	
+	if answerData.Target == models.ServerTarget {
+		sfu := h.getSFURoom(client)
+		if sfu == nil {
+			h.sendError(client, "Room is not running in SFU mode")
+			return
+		}
+		if err := sfu.handleAnswer(client, answerData); err != nil {
+			log.Printf("Error handling SFU answer from %s: %v", client.UserID, err)
+			h.sendError(client, "Failed to negotiate with server")
+		}
+		return
+	}
+	
 	h.forwardToTarget(client, answerData.Target, models.MessageTypeAnswer, message.Data)
 }
 
@@ -228,9 +600,298 @@ func (h *Hub) handleIceCandidate(client *models.Client, message models.WebSocket
 		return
 	}
 	
+	if iceData.Target == models.ServerTarget {
+		sfu := h.getSFURoom(client)
+		if sfu == nil {
+			h.sendError(client, "Room is not running in SFU mode")
+			return
+		}
+		if err := sfu.handleIceCandidate(client, iceData); err != nil {
+			log.Printf("Error adding SFU ICE candidate from %s: %v", client.UserID, err)
+		}
+		return
+	}
+	
 	h.forwardToTarget(client, iceData.Target, models.MessageTypeIceCandidate, message.Data)
 }
 
+// getSFURoom returns the SFU for the client's room, or nil if the client is
+// not in a room or the room is running in mesh mode
+func (h *Hub) getSFURoom(client *models.Client) *sfuRoom {
+	if client.RoomID == "" {
+		return nil
+	}
+	
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.sfuRooms[client.RoomID]
+}
+
+// lookupMediaMode reads the media mode a room was created with, falling back
+// to mesh for unknown rooms and meetings created before SFU support
+func lookupMediaMode(roomID string) string {
+	meetingsCollection := utils.GetMeetingsCollection()
+	meeting, err := models.FindMeetingByRoomID(meetingsCollection, roomID)
+	if err != nil || !models.IsValidMediaMode(meeting.MediaMode) {
+		return models.MediaModeMesh
+	}
+	return meeting.MediaMode
+}
+
+func (h *Hub) handleStartRecording(client *models.Client) {
+	sfu := h.getSFURoom(client)
+	if sfu == nil {
+		h.sendError(client, "Recording is only available in SFU rooms")
+		return
+	}
+	
+	if !hasMeetingPermission(client, models.PermissionRecord) {
+		h.sendError(client, "You don't have permission to start a recording")
+		return
+	}
+	
+	recorder, err := sfu.startRecording(client.UserID)
+	if err != nil {
+		log.Printf("Error starting recording in room %s: %v", client.RoomID, err)
+		h.sendError(client, "Failed to start recording")
+		return
+	}
+	
+	h.broadcastToRoom(client.RoomID, models.MessageTypeRecordingState, recorder.state())
+}
+
+func (h *Hub) handleStopRecording(client *models.Client) {
+	sfu := h.getSFURoom(client)
+	if sfu == nil {
+		h.sendError(client, "Recording is only available in SFU rooms")
+		return
+	}
+	
+	if !hasMeetingPermission(client, models.PermissionRecord) {
+		h.sendError(client, "You don't have permission to stop a recording")
+		return
+	}
+	
+	if err := sfu.stopRecording(); err != nil {
+		h.sendError(client, "Room is not being recorded")
+		return
+	}
+	
+	h.broadcastToRoom(client.RoomID, models.MessageTypeRecordingState, models.RecordingStateData{Recording: false})
+}
+
+func (h *Hub) handleSetPreferredLayer(client *models.Client, message models.WebSocketMessage) {
+	var layerData models.SetPreferredLayerData
+	if err := json.Unmarshal(message.Data, &layerData); err != nil {
+		log.Printf("Error unmarshaling preferred layer data: %v", err)
+		h.sendError(client, "Invalid preferred layer data")
+		return
+	}
+	
+	sfu := h.getSFURoom(client)
+	if sfu == nil {
+		h.sendError(client, "Layer selection is only available in SFU rooms")
+		return
+	}
+	
+	if err := sfu.setPreferredLayer(client, layerData); err != nil {
+		log.Printf("Error setting preferred layer for %s: %v", client.UserID, err)
+		h.sendError(client, "No matching track to set a layer for")
+	}
+}
+
+// handleAudioLevel takes a mesh client's own microphone level. SFU rooms
+// ignore these since the server reads levels straight from the RTP.
+func (h *Hub) handleAudioLevel(client *models.Client, message models.WebSocketMessage) {
+	var levelData models.AudioLevelData
+	if err := json.Unmarshal(message.Data, &levelData); err != nil {
+		return
+	}
+	
+	if client.RoomID == "" || h.getSFURoom(client) != nil {
+		return
+	}
+	
+	h.mutex.RLock()
+	speakers, exists := h.speakers[client.RoomID]
+	h.mutex.RUnlock()
+	
+	if exists {
+		speakers.reportLevel(client, levelData.Level)
+	}
+}
+
+func (h *Hub) announceActiveSpeaker(roomID string, speaker *models.Client) {
+	h.mutex.RLock()
+	sfu := h.sfuRooms[roomID]
+	h.mutex.RUnlock()
+	
+	if sfu != nil {
+		sfu.setActiveSpeaker(speaker.ID)
+	}
+	
+	h.broadcastToRoom(roomID, models.MessageTypeActiveSpeaker, models.ActiveSpeakerData{
+		UserID: speaker.UserID,
+		Name:   speaker.Name,
+	})
+}
+
+// UpdateUserProfile renames every connection a user has open and tells the
+// rooms they are in, so a profile edit shows up without rejoining
+func (h *Hub) UpdateUserProfile(userID, name, picture string) {
+	h.mutex.RLock()
+	roomIDs := make(map[string]bool)
+	for _, client := range h.clients {
+		if client.UserID == userID && !client.IsGuest {
+			client.Name = name
+			if client.RoomID != "" {
+				roomIDs[client.RoomID] = true
+			}
+		}
+	}
+	h.mutex.RUnlock()
+	
+	for roomID := range roomIDs {
+		h.broadcastToRoom(roomID, models.MessageTypeProfileUpdated, models.ProfileUpdatedData{
+			UserID:  userID,
+			Name:    name,
+			Picture: picture,
+		})
+	}
+}
+
+// BroadcastRoleChange tells a room that a participant's role changed
+func (h *Hub) BroadcastRoleChange(roomID, userID, role, changedBy string) {
+	h.broadcastToRoom(roomID, models.MessageTypeRoleChanged, models.RoleChangedData{
+		UserID:      userID,
+		Role:        role,
+		Permissions: models.RolePermissions(role),
+		ChangedBy:   changedBy,
+	})
+}
+
+// CloseSessionRevoked is the close code sent to connections whose login
+// session was ended, so the client knows not to reconnect with the same token
+const CloseSessionRevoked = 4001
+
+// DisconnectSession closes every connection that joined with a token from
+// the given session
+func (h *Hub) DisconnectSession(sessionID string) {
+	h.disconnectClients(func(client *models.Client) bool {
+		return client.SessionID == sessionID
+	}, "Session revoked")
+}
+
+// DisconnectAPIKey closes every connection that joined with the given key
+func (h *Hub) DisconnectAPIKey(keyID string) {
+	h.disconnectClients(func(client *models.Client) bool {
+		return client.APIKeyID == keyID
+	}, "API key revoked")
+}
+
+// DisconnectUser closes every connection a user has open
+func (h *Hub) DisconnectUser(userID string) {
+	h.disconnectClients(func(client *models.Client) bool {
+		return (client.UserID == userID && !client.IsGuest) || client.NotificationUserID == userID
+	}, "Signed out")
+}
+
+func (h *Hub) disconnectClients(match func(client *models.Client) bool, reason string) {
+	h.mutex.RLock()
+	var clients []*models.Client
+	for _, client := range h.clients {
+		if client.UserID != "" && match(client) {
+			clients = append(clients, client)
+		}
+	}
+	h.mutex.RUnlock()
+	
+	// Closing the connection makes readPump exit, which unregisters the
+	// client and lets the room know they left
+	message := websocket.FormatCloseMessage(CloseSessionRevoked, reason)
+	for _, client := range clients {
+		log.Printf("Disconnecting client %s (%s): %s", client.ID, client.UserID, reason)
+		client.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		client.Conn.Close()
+	}
+}
+
+// broadcastToRoom sends a server event to everyone in a room
+func (h *Hub) broadcastToRoom(roomID string, messageType models.MessageType, payload interface{}) {
+	h.mutex.RLock()
+	room, exists := h.rooms[roomID]
+	h.mutex.RUnlock()
+	
+	if !exists {
+		return
+	}
+	
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling %s data: %v", messageType, err)
+		return
+	}
+	
+	room.BroadcastMessage(models.WebSocketMessage{
+		Type:   messageType,
+		RoomID: roomID,
+		Data:   data,
+	})
+}
+
+// sendMessage sends a server event to a single client
+func (h *Hub) sendMessage(client *models.Client, messageType models.MessageType, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling %s data: %v", messageType, err)
+		return
+	}
+	
+	messageBytes, err := json.Marshal(models.WebSocketMessage{
+		Type:   messageType,
+		RoomID: client.RoomID,
+		Data:   data,
+	})
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	
+	select {
+	case client.Send <- messageBytes:
+	default:
+		log.Printf("Dropping %s for client %s: send buffer full", messageType, client.ID)
+	}
+}
+
+// hasMeetingPermission checks the client's current role in the meeting they
+// are in. Roles can change mid-meeting, so it's looked up every time.
+func hasMeetingPermission(client *models.Client, permission string) bool {
+	meetingsCollection := utils.GetMeetingsCollection()
+	meeting, err := models.FindMeetingByRoomID(meetingsCollection, client.RoomID)
+	if err != nil {
+		return false
+	}
+	return utils.HasMeetingPermission(client.UserID, client.IsGuest, meeting, permission)
+}
+
+// handleE2EEKey relays an encrypted key-distribution message to a single
+// participant. The server never sees the keys themselves.
+func (h *Hub) handleE2EEKey(client *models.Client, message models.WebSocketMessage) {
+	var keyData models.E2EEKeyData
+	if err := json.Unmarshal(message.Data, &keyData); err != nil {
+		log.Printf("Error unmarshaling e2ee key data: %v", err)
+		return
+	}
+	
+	if keyData.Target == "" {
+		h.sendError(client, "E2EE key messages need a target")
+		return
+	}
+	
+	h.forwardToTarget(client, keyData.Target, models.MessageTypeE2EEKey, message.Data)
+}
+
 func (h *Hub) forwardToTarget(sender *models.Client, targetUserID string, messageType models.MessageType, data json.RawMessage) {
 	if sender.RoomID == "" {
 		log.Printf("Client %s not in a room", sender.UserID)
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+)
+
+// subscribe adds a connection to a user's notifications the way
+// handleSubscribeNotifications does once the token checks out
+func subscribe(h *Hub, clientID, userID string, buffer int) *models.Client {
+	client := &models.Client{
+		ID:                 clientID,
+		UserID:             userID,
+		NotificationUserID: userID,
+		Send:               make(chan []byte, buffer),
+	}
+	h.registerClient(client)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.userChannels[userID] == nil {
+		h.userChannels[userID] = make(map[string]*models.Client)
+	}
+	h.userChannels[userID][clientID] = client
+	return client
+}
+
+func TestSendToUser(t *testing.T) {
+	type subscriber struct {
+		clientID string
+		userID   string
+		buffer   int
+	}
+
+	tests := []struct {
+		name        string
+		subscribers []subscriber
+		// unregistered connections close before the send
+		unregistered []string
+		sendTo       string
+		want         []string
+	}{
+		{
+			name: "every connection of the user",
+			subscribers: []subscriber{
+				{"laptop", "alice", 1},
+				{"phone", "alice", 1},
+				{"bob-laptop", "bob", 1},
+			},
+			sendTo: "alice",
+			want:   []string{"laptop", "phone"},
+		},
+		{
+			name:        "user with no connections",
+			subscribers: []subscriber{{"bob-laptop", "bob", 1}},
+			sendTo:      "alice",
+		},
+		{
+			name: "full connection is skipped without blocking the rest",
+			subscribers: []subscriber{
+				{"stuck", "alice", 0},
+				{"phone", "alice", 1},
+			},
+			sendTo: "alice",
+			want:   []string{"phone"},
+		},
+		{
+			name: "closed connection is left out",
+			subscribers: []subscriber{
+				{"laptop", "alice", 1},
+				{"phone", "alice", 1},
+			},
+			unregistered: []string{"laptop"},
+			sendTo:       "alice",
+			want:         []string{"phone"},
+		},
+		{
+			name:         "last connection closing drops the channel",
+			subscribers:  []subscriber{{"laptop", "alice", 1}},
+			unregistered: []string{"laptop"},
+			sendTo:       "alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub()
+			clients := map[string]*models.Client{}
+			for _, s := range tt.subscribers {
+				clients[s.clientID] = subscribe(h, s.clientID, s.userID, s.buffer)
+			}
+			for _, clientID := range tt.unregistered {
+				h.unregisterClient(clients[clientID])
+				delete(clients, clientID)
+			}
+
+			h.SendToUser(tt.sendTo, models.MessageTypeNotification, map[string]string{"title": "Hi"})
+
+			want := map[string]bool{}
+			for _, clientID := range tt.want {
+				want[clientID] = true
+			}
+			for clientID, client := range clients {
+				select {
+				case messageBytes := <-client.Send:
+					if !want[clientID] {
+						t.Errorf("%s got a message meant for %s", clientID, tt.sendTo)
+						continue
+					}
+					var message models.WebSocketMessage
+					if err := json.Unmarshal(messageBytes, &message); err != nil || message.Type != models.MessageTypeNotification {
+						t.Errorf("%s got %s, want a notification", clientID, messageBytes)
+					}
+				default:
+					if want[clientID] {
+						t.Errorf("%s got nothing", clientID)
+					}
+				}
+			}
+
+			if _, ok := h.userChannels[tt.sendTo]; ok && len(tt.want) == 0 && len(tt.unregistered) > 0 {
+				t.Errorf("channel for %s outlived its last connection", tt.sendTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// roomRecorder writes every track forwarded through an SFU room to its own
+// file for as long as the recording runs
+type roomRecorder struct {
+	roomID    string
+	dir       string
+	startedBy string
+	startedAt time.Time
+	tracks    map[string]*trackRecorder
+	stopped   bool
+	mutex     sync.Mutex
+}
+
+type trackRecorder struct {
+	recording *models.Recording
+	layer     *sfuLayer
+	writer    media.Writer
+	// saved is closed once the recording's document has been inserted, or
+	// failed to be
+	saved chan struct{}
+}
+
+// RecordingsDir is where recordings are written, configurable through
+// RECORDINGS_DIR
+func RecordingsDir() string {
+	dir := os.Getenv("RECORDINGS_DIR")
+	if dir == "" {
+		dir = "recordings"
+	}
+	return dir
+}
+
+func newRoomRecorder(roomID, startedBy string) (*roomRecorder, error) {
+	dir := filepath.Join(RecordingsDir(), sanitizeFileName(roomID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &roomRecorder{
+		roomID:    roomID,
+		dir:       dir,
+		startedBy: startedBy,
+		startedAt: time.Now(),
+		tracks:    make(map[string]*trackRecorder),
+	}, nil
+}
+
+// writeRTP appends a forwarded packet to the track's file, opening the file
+// on the first packet seen after the recording started. Only one layer of a
+// simulcast track is recorded: the best one when recording of it began.
+func (rec *roomRecorder) writeRTP(track *sfuTrack, layer *sfuLayer, packet *rtp.Packet) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if rec.stopped {
+		return
+	}
+
+	recorder, exists := rec.tracks[track.key]
+	if !exists {
+		if best := track.bestLayer(); best != nil && best != layer {
+			return
+		}
+
+		var err error
+		recorder, err = rec.openTrack(track, layer)
+		if err != nil {
+			log.Printf("Not recording track %s in room %s: %v", track.id, rec.roomID, err)
+		}
+		// A nil entry marks tracks we can't record so we don't retry per packet
+		rec.tracks[track.key] = recorder
+	}
+	if recorder == nil || recorder.layer != layer {
+		return
+	}
+
+	if err := recorder.writer.WriteRTP(packet); err != nil {
+		log.Printf("Error writing recording for track %s: %v", track.id, err)
+	}
+}
+
+func (rec *roomRecorder) openTrack(track *sfuTrack, layer *sfuLayer) (*trackRecorder, error) {
+	codec := track.codec
+	mimeType := strings.ToLower(codec.MimeType)
+
+	var extension string
+	switch mimeType {
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		extension = "ogg"
+	case strings.ToLower(webrtc.MimeTypeVP8), strings.ToLower(webrtc.MimeTypeVP9), strings.ToLower(webrtc.MimeTypeAV1):
+		extension = "ivf"
+	case strings.ToLower(webrtc.MimeTypeH264):
+		extension = "h264"
+	default:
+		return nil, fmt.Errorf("unsupported codec %s", codec.MimeType)
+	}
+
+	client := track.owner.client
+	fileName := fmt.Sprintf("%d_%s_%s.%s", rec.startedAt.Unix(), sanitizeFileName(client.UserID), sanitizeFileName(track.id), extension)
+	filePath := filepath.Join(rec.dir, fileName)
+
+	var writer media.Writer
+	var err error
+	switch extension {
+	case "ogg":
+		writer, err = oggwriter.New(filePath, codec.ClockRate, codec.Channels)
+	case "ivf":
+		writer, err = ivfwriter.New(filePath, ivfwriter.WithCodec(codec.MimeType))
+	case "h264":
+		writer, err = h264writer.New(filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recording := &models.Recording{
+		RoomID:    rec.roomID,
+		UserID:    client.UserID,
+		Name:      client.Name,
+		TrackID:   track.id,
+		Kind:      track.kind.String(),
+		MimeType:  codec.MimeType,
+		FilePath:  filePath,
+		FileName:  fileName,
+		StartedBy: rec.startedBy,
+		StartedAt: time.Now(),
+	}
+	recorder := &trackRecorder{recording: recording, layer: layer, writer: writer, saved: make(chan struct{})}
+	// This runs on the forwarding path with the recorder locked, so the
+	// database gets written to in the background
+	go recorder.save()
+
+	// Video files are unplayable until the first keyframe
+	track.owner.requestKeyframe(layer.remote)
+
+	log.Printf("Recording %s from %s in room %s to %s", recording.Kind, client.UserID, rec.roomID, filePath)
+	return recorder, nil
+}
+
+// finishLayer closes the track's file if the layer being recorded stopped
+// being published
+func (rec *roomRecorder) finishLayer(track *sfuTrack, layer *sfuLayer) {
+	rec.mutex.Lock()
+	recorder := rec.tracks[track.key]
+	if recorder == nil || recorder.layer != layer {
+		rec.mutex.Unlock()
+		return
+	}
+	delete(rec.tracks, track.key)
+	rec.mutex.Unlock()
+
+	recorder.close()
+}
+
+func (rec *roomRecorder) stop() {
+	rec.mutex.Lock()
+	rec.stopped = true
+	tracks := rec.tracks
+	rec.tracks = make(map[string]*trackRecorder)
+	rec.mutex.Unlock()
+
+	for _, recorder := range tracks {
+		if recorder != nil {
+			recorder.close()
+		}
+	}
+
+	log.Printf("Recording of room %s stopped", rec.roomID)
+}
+
+func (rec *roomRecorder) state() models.RecordingStateData {
+	startedAt := rec.startedAt
+	return models.RecordingStateData{
+		Recording: true,
+		StartedBy: rec.startedBy,
+		StartedAt: &startedAt,
+	}
+}
+
+func (t *trackRecorder) save() {
+	defer close(t.saved)
+
+	if err := models.CreateRecording(utils.GetRecordingsCollection(), t.recording); err != nil {
+		log.Printf("Error saving recording %s: %v", t.recording.FilePath, err)
+	}
+}
+
+func (t *trackRecorder) close() {
+	if err := t.writer.Close(); err != nil {
+		log.Printf("Error closing recording %s: %v", t.recording.FilePath, err)
+	}
+
+	// Without a document nobody could find the file, so don't keep it
+	<-t.saved
+	if t.recording.ID.IsZero() {
+		if err := os.Remove(t.recording.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error deleting unsaved recording %s: %v", t.recording.FilePath, err)
+		}
+		return
+	}
+
+	var size int64
+	if info, err := os.Stat(t.recording.FilePath); err == nil {
+		size = info.Size()
+	}
+
+	if err := models.FinishRecording(utils.GetRecordingsCollection(), t.recording.ID, size); err != nil {
+		log.Printf("Error saving recording %s: %v", t.recording.ID.Hex(), err)
+	}
+}
+
+func (r *sfuRoom) startRecording(startedBy string) (*roomRecorder, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.recorder != nil {
+		return nil, errors.New("room is already being recorded")
+	}
+
+	recorder, err := newRoomRecorder(r.id, startedBy)
+	if err != nil {
+		return nil, err
+	}
+	r.recorder = recorder
+
+	log.Printf("Recording of room %s started by %s", r.id, startedBy)
+	return recorder, nil
+}
+
+func (r *sfuRoom) stopRecording() error {
+	r.mutex.Lock()
+	recorder := r.recorder
+	r.recorder = nil
+	r.mutex.Unlock()
+
+	if recorder == nil {
+		return errors.New("room is not being recorded")
+	}
+
+	recorder.stop()
+	return nil
+}
+
+func (r *sfuRoom) activeRecorder() *roomRecorder {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.recorder
+}
+
+func sanitizeFileName(name string) string {
+	name = unsafeFileChars.ReplaceAllString(name, "")
+	if name == "" {
+		name = "unknown"
+	}
+	return name
+}
@@ -0,0 +1,650 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	settingEngineOnce sync.Once
+	settingEngine     webrtc.SettingEngine
+)
+
+// getSettingEngine builds the network settings shared by every SFU peer
+func getSettingEngine() webrtc.SettingEngine {
+	settingEngineOnce.Do(func() {
+		if publicIP := os.Getenv("SFU_PUBLIC_IP"); publicIP != "" {
+			settingEngine.SetNAT1To1IPs([]string{publicIP}, webrtc.ICECandidateTypeHost)
+		}
+		minPort, _ := strconv.Atoi(os.Getenv("SFU_UDP_PORT_MIN"))
+		maxPort, _ := strconv.Atoi(os.Getenv("SFU_UDP_PORT_MAX"))
+		if minPort > 0 && maxPort >= minPort {
+			if err := settingEngine.SetEphemeralUDPPortRange(uint16(minPort), uint16(maxPort)); err != nil {
+				log.Printf("Ignoring SFU UDP port range: %v", err)
+			}
+		}
+	})
+	return settingEngine
+}
+
+// newSFUAPI builds the pion API for a single peer. Each peer gets its own so
+// the send-side bandwidth estimator can be tied to its PeerConnection.
+func newSFUAPI(onEstimator func(cc.BandwidthEstimator)) (*webrtc.API, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	if err := webrtc.ConfigureSimulcastExtensionHeaders(mediaEngine); err != nil {
+		return nil, err
+	}
+	if err := mediaEngine.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+
+	interceptorRegistry := &interceptor.Registry{}
+
+	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		// Only estimate; subscribers are kept within budget by layer selection
+		// rather than by pacing
+		return gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(initialBitrateEstimate),
+			gcc.SendSideBWEPacer(gcc.NewNoOpPacer()),
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	congestionController.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		onEstimator(estimator)
+	})
+	interceptorRegistry.Add(congestionController)
+
+	if err := webrtc.ConfigureTWCCHeaderExtensionSender(mediaEngine, interceptorRegistry); err != nil {
+		return nil, err
+	}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
+		return nil, err
+	}
+
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(mediaEngine),
+		webrtc.WithInterceptorRegistry(interceptorRegistry),
+		webrtc.WithSettingEngine(getSettingEngine()),
+	), nil
+}
+
+// sfuRoom terminates every participant's PeerConnection on the server and
+// forwards the RTP received from each publisher to all other participants
+type sfuRoom struct {
+	id     string
+	peers  map[string]*sfuPeer  // keyed by client ID
+	tracks map[string]*sfuTrack // keyed by publisher client ID + track ID
+	// recorder is set while the room is being recorded
+	recorder *roomRecorder
+	// activeSpeaker is the client ID whose video is prioritized
+	activeSpeaker string
+	speakers      *speakerDetector
+	mutex         sync.RWMutex
+	done          chan struct{}
+}
+
+type sfuPeer struct {
+	client *models.Client
+	pc     *webrtc.PeerConnection
+
+	// negotiationMutex serializes SDP handling for this PeerConnection
+	negotiationMutex   sync.Mutex
+	negotiationPending bool
+	pendingCandidates  []webrtc.ICECandidateInit
+	subscriptions      map[string]*sfuSubscription // keyed by track key
+
+	bandwidth peerBandwidth
+
+	screenStreamsMutex sync.RWMutex
+	screenStreams      map[string]bool
+
+	sendMutex sync.Mutex
+	closed    bool
+}
+
+func newSFURoom(id string, speakers *speakerDetector) *sfuRoom {
+	r := &sfuRoom{
+		id:       id,
+		peers:    make(map[string]*sfuPeer),
+		tracks:   make(map[string]*sfuTrack),
+		speakers: speakers,
+		done:     make(chan struct{}),
+	}
+	go r.runLayerAllocation()
+	return r
+}
+
+// getOrCreatePeer returns the client's PeerConnection, creating a new one if
+// the client has none yet or its previous one was torn down
+func (r *sfuRoom) getOrCreatePeer(client *models.Client) (*sfuPeer, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if peer, exists := r.peers[client.ID]; exists && peer.pc.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		return peer, nil
+	}
+
+	peer := &sfuPeer{
+		client:        client,
+		subscriptions: make(map[string]*sfuSubscription),
+		screenStreams: make(map[string]bool),
+	}
+
+	api, err := newSFUAPI(func(estimator cc.BandwidthEstimator) {
+		peer.bandwidth.setEstimator(estimator)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, err
+	}
+	peer.pc = pc
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		iceData := models.RTCIceCandidateData{
+			Candidate: init.Candidate,
+			Target:    client.UserID,
+		}
+		if init.SDPMid != nil {
+			iceData.SdpMid = *init.SDPMid
+		}
+		if init.SDPMLineIndex != nil {
+			iceData.SdpMLineIndex = int(*init.SDPMLineIndex)
+		}
+		peer.send(models.MessageTypeIceCandidate, r.id, iceData)
+	})
+
+	pc.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		r.publishLayer(peer, remote, receiver)
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("SFU peer %s in room %s is %s", client.UserID, r.id, state.String())
+		if state == webrtc.PeerConnectionStateFailed {
+			go r.removePeer(client.ID)
+		}
+	})
+
+	r.peers[client.ID] = peer
+	log.Printf("SFU peer created for %s in room %s", client.UserID, r.id)
+	return peer, nil
+}
+
+// removePeer closes the client's PeerConnection and withdraws its tracks from
+// every subscriber
+func (r *sfuRoom) removePeer(clientID string) {
+	r.mutex.Lock()
+	peer, exists := r.peers[clientID]
+	if !exists {
+		r.mutex.Unlock()
+		return
+	}
+	delete(r.peers, clientID)
+	for key, track := range r.tracks {
+		if track.owner == peer {
+			delete(r.tracks, key)
+		}
+	}
+	r.mutex.Unlock()
+
+	peer.close()
+	log.Printf("SFU peer removed for %s in room %s", peer.client.UserID, r.id)
+
+	r.syncAll()
+}
+
+func (r *sfuRoom) close() {
+	r.mutex.Lock()
+	peers := r.peers
+	recorder := r.recorder
+	r.peers = make(map[string]*sfuPeer)
+	r.tracks = make(map[string]*sfuTrack)
+	r.recorder = nil
+	r.mutex.Unlock()
+
+	close(r.done)
+
+	if recorder != nil {
+		recorder.stop()
+	}
+
+	for _, peer := range peers {
+		peer.close()
+	}
+}
+
+func (r *sfuRoom) handleOffer(client *models.Client, offerData models.RTCOfferData) error {
+	peer, err := r.getOrCreatePeer(client)
+	if err != nil {
+		return err
+	}
+
+	peer.setScreenStreams(offerData.ScreenStreamIDs)
+	r.refreshScreenShares(peer)
+
+	peer.negotiationMutex.Lock()
+	// The client's offer wins over an offer we have outstanding; ours is
+	// retried once this exchange completes
+	if peer.pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		if err := peer.pc.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback}); err != nil {
+			peer.negotiationMutex.Unlock()
+			return err
+		}
+		peer.negotiationPending = true
+	}
+
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerData.SDP}
+	if err := peer.pc.SetRemoteDescription(offer); err != nil {
+		peer.negotiationMutex.Unlock()
+		return err
+	}
+	peer.flushCandidates()
+
+	answer, err := peer.pc.CreateAnswer(nil)
+	if err != nil {
+		peer.negotiationMutex.Unlock()
+		return err
+	}
+	if err := peer.pc.SetLocalDescription(answer); err != nil {
+		peer.negotiationMutex.Unlock()
+		return err
+	}
+	peer.negotiationMutex.Unlock()
+
+	peer.send(models.MessageTypeAnswer, r.id, models.RTCAnswerData{
+		SDP:    answer.SDP,
+		Type:   answer.Type.String(),
+		Target: client.UserID,
+	})
+
+	// Offer the client any tracks already being published in the room
+	r.syncPeer(peer)
+	return nil
+}
+
+func (r *sfuRoom) handleAnswer(client *models.Client, answerData models.RTCAnswerData) error {
+	r.mutex.RLock()
+	peer, exists := r.peers[client.ID]
+	r.mutex.RUnlock()
+	if !exists {
+		return errors.New("no server connection to answer")
+	}
+
+	peer.negotiationMutex.Lock()
+	answer := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answerData.SDP}
+	if err := peer.pc.SetRemoteDescription(answer); err != nil {
+		peer.negotiationMutex.Unlock()
+		return err
+	}
+	peer.flushCandidates()
+	pending := peer.negotiationPending
+	peer.negotiationMutex.Unlock()
+
+	if pending {
+		r.syncPeer(peer)
+	}
+	return nil
+}
+
+func (r *sfuRoom) handleIceCandidate(client *models.Client, iceData models.RTCIceCandidateData) error {
+	peer, err := r.getOrCreatePeer(client)
+	if err != nil {
+		return err
+	}
+
+	sdpMid := iceData.SdpMid
+	sdpMLineIndex := uint16(iceData.SdpMLineIndex)
+	candidate := webrtc.ICECandidateInit{
+		Candidate:     iceData.Candidate,
+		SDPMid:        &sdpMid,
+		SDPMLineIndex: &sdpMLineIndex,
+	}
+
+	peer.negotiationMutex.Lock()
+	defer peer.negotiationMutex.Unlock()
+
+	// Candidates can arrive before the description they belong to
+	if peer.pc.RemoteDescription() == nil {
+		peer.pendingCandidates = append(peer.pendingCandidates, candidate)
+		return nil
+	}
+	return peer.pc.AddICECandidate(candidate)
+}
+
+// publishLayer registers a received track, or one simulcast encoding of it,
+// and forwards its RTP to subscribers until the publisher goes away
+func (r *sfuRoom) publishLayer(publisher *sfuPeer, remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	key := publisher.client.ID + "/" + remote.ID()
+
+	r.mutex.Lock()
+	track, exists := r.tracks[key]
+	if !exists {
+		track = newSFUTrack(key, publisher, remote)
+		r.tracks[key] = track
+	}
+	r.mutex.Unlock()
+
+	layer := track.addLayer(remote)
+	log.Printf("SFU track %s (%s, layer %q) published by %s in room %s", remote.ID(), remote.Kind().String(), remote.RID(), publisher.client.UserID, r.id)
+
+	if !exists {
+		r.syncAll()
+	}
+
+	var audioLevelID uint8
+	if remote.Kind() == webrtc.RTPCodecTypeAudio {
+		for _, extension := range receiver.GetParameters().HeaderExtensions {
+			if extension.URI == sdp.AudioLevelURI {
+				audioLevelID = uint8(extension.ID)
+			}
+		}
+	}
+
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			break
+		}
+
+		layer.countBytes(packet.MarshalSize())
+
+		if audioLevelID != 0 {
+			r.reportAudioLevel(publisher, packet, audioLevelID)
+		}
+
+		if recorder := r.activeRecorder(); recorder != nil {
+			recorder.writeRTP(track, layer, packet)
+		}
+		track.forward(layer, packet)
+	}
+
+	if recorder := r.activeRecorder(); recorder != nil {
+		recorder.finishLayer(track, layer)
+	}
+
+	if track.removeLayer(layer) > 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	if current, exists := r.tracks[key]; exists && current == track {
+		delete(r.tracks, key)
+	}
+	r.mutex.Unlock()
+
+	log.Printf("SFU track %s unpublished in room %s", remote.ID(), r.id)
+	r.syncAll()
+}
+
+// reportAudioLevel feeds the level a publisher's browser put in an audio
+// packet's header extension to the room's speaker detection
+func (r *sfuRoom) reportAudioLevel(publisher *sfuPeer, packet *rtp.Packet, extensionID uint8) {
+	payload := packet.GetExtension(extensionID)
+	if payload == nil {
+		return
+	}
+
+	var audioLevel rtp.AudioLevelExtension
+	if err := audioLevel.Unmarshal(payload); err != nil {
+		return
+	}
+	r.speakers.reportLevel(publisher.client, audioLevelFromDBov(audioLevel.Level))
+}
+
+func (r *sfuRoom) setActiveSpeaker(clientID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.activeSpeaker = clientID
+}
+
+// readSubscriberRTCP reads RTCP from a subscriber's sender, which keeps the
+// interceptors running, relays keyframe requests to the publisher and feeds
+// the subscriber's bandwidth estimate
+func (r *sfuRoom) readSubscriberRTCP(subscription *sfuSubscription) {
+	for {
+		packets, _, err := subscription.sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+
+		for _, packet := range packets {
+			switch p := packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				subscription.requestKeyframe()
+			case *rtcp.TransportLayerCC:
+				subscription.subscriber.bandwidth.markFeedback()
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				subscription.subscriber.bandwidth.setREMB(uint64(p.Bitrate))
+			case *rtcp.ReceiverReport:
+				for _, report := range p.Reports {
+					subscription.subscriber.bandwidth.setFractionLost(report.FractionLost)
+				}
+			}
+		}
+	}
+}
+
+func (r *sfuRoom) syncAll() {
+	r.mutex.RLock()
+	peers := make([]*sfuPeer, 0, len(r.peers))
+	for _, peer := range r.peers {
+		peers = append(peers, peer)
+	}
+	r.mutex.RUnlock()
+
+	for _, peer := range peers {
+		r.syncPeer(peer)
+	}
+}
+
+// syncPeer brings the tracks a peer is subscribed to in line with what is
+// being published and sends the client a new offer if anything changed
+func (r *sfuRoom) syncPeer(peer *sfuPeer) {
+	peer.negotiationMutex.Lock()
+	defer peer.negotiationMutex.Unlock()
+
+	if peer.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return
+	}
+
+	if peer.pc.SignalingState() != webrtc.SignalingStateStable {
+		peer.negotiationPending = true
+		return
+	}
+
+	r.mutex.RLock()
+	tracks := make(map[string]*sfuTrack, len(r.tracks))
+	for key, track := range r.tracks {
+		tracks[key] = track
+	}
+	r.mutex.RUnlock()
+
+	changed := peer.negotiationPending
+	peer.negotiationPending = false
+
+	for key, subscription := range peer.subscriptions {
+		if current, exists := tracks[key]; !exists || current != subscription.track {
+			subscription.track.removeSubscription(peer)
+			if err := peer.pc.RemoveTrack(subscription.sender); err != nil {
+				log.Printf("Error removing SFU track from %s: %v", peer.client.UserID, err)
+			}
+			delete(peer.subscriptions, key)
+			changed = true
+		}
+	}
+
+	for key, track := range tracks {
+		if track.owner == peer {
+			continue
+		}
+		if _, exists := peer.subscriptions[key]; exists {
+			continue
+		}
+
+		// Subscribers see the publisher's user ID as the stream ID so they
+		// can tell whose media a track carries
+		local, err := webrtc.NewTrackLocalStaticRTP(track.codec.RTPCodecCapability, track.id, track.owner.client.UserID)
+		if err != nil {
+			log.Printf("Error creating local track for %s: %v", peer.client.UserID, err)
+			continue
+		}
+
+		sender, err := peer.pc.AddTrack(local)
+		if err != nil {
+			log.Printf("Error adding SFU track to %s: %v", peer.client.UserID, err)
+			continue
+		}
+
+		subscription := newSFUSubscription(peer, track, local, sender)
+		peer.subscriptions[key] = subscription
+		track.addSubscription(subscription)
+		go r.readSubscriberRTCP(subscription)
+		subscription.requestKeyframe()
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+
+	offer, err := peer.pc.CreateOffer(nil)
+	if err != nil {
+		log.Printf("Error creating SFU offer for %s: %v", peer.client.UserID, err)
+		return
+	}
+	if err := peer.pc.SetLocalDescription(offer); err != nil {
+		log.Printf("Error setting SFU offer for %s: %v", peer.client.UserID, err)
+		return
+	}
+
+	peer.send(models.MessageTypeOffer, r.id, models.RTCOfferData{
+		SDP:    offer.SDP,
+		Type:   offer.Type.String(),
+		Target: peer.client.UserID,
+	})
+}
+
+// runLayerAllocation periodically re-measures layer bitrates and picks the
+// layer each subscriber receives until the room is closed
+func (r *sfuRoom) runLayerAllocation() {
+	ticker := time.NewTicker(layerAllocationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.allocateLayers()
+		}
+	}
+}
+
+// flushCandidates applies ICE candidates that arrived before the remote
+// description. Callers must hold negotiationMutex.
+func (p *sfuPeer) flushCandidates() {
+	for _, candidate := range p.pendingCandidates {
+		if err := p.pc.AddICECandidate(candidate); err != nil {
+			log.Printf("Error adding ICE candidate for %s: %v", p.client.UserID, err)
+		}
+	}
+	p.pendingCandidates = nil
+}
+
+func (p *sfuPeer) requestKeyframe(remote *webrtc.TrackRemote) {
+	if remote.Kind() != webrtc.RTPCodecTypeVideo {
+		return
+	}
+	err := p.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(remote.SSRC())}})
+	if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		log.Printf("Error requesting keyframe from %s: %v", p.client.UserID, err)
+	}
+}
+
+// setScreenStreams records which of the client's media streams carry a screen
+// share, as announced alongside its offer
+func (p *sfuPeer) setScreenStreams(streamIDs []string) {
+	p.screenStreamsMutex.Lock()
+	defer p.screenStreamsMutex.Unlock()
+
+	p.screenStreams = make(map[string]bool, len(streamIDs))
+	for _, streamID := range streamIDs {
+		p.screenStreams[streamID] = true
+	}
+}
+
+func (p *sfuPeer) isScreenStream(streamID string) bool {
+	p.screenStreamsMutex.RLock()
+	defer p.screenStreamsMutex.RUnlock()
+	return p.screenStreams[streamID]
+}
+
+// send delivers a signaling message from the server to the peer's client
+func (p *sfuPeer) send(messageType models.MessageType, roomID string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling SFU message: %v", err)
+		return
+	}
+
+	messageBytes, err := json.Marshal(models.WebSocketMessage{
+		Type:   messageType,
+		RoomID: roomID,
+		UserID: models.ServerTarget,
+		Data:   data,
+	})
+	if err != nil {
+		log.Printf("Error marshaling SFU message: %v", err)
+		return
+	}
+
+	p.sendMutex.Lock()
+	defer p.sendMutex.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	select {
+	case p.client.Send <- messageBytes:
+	default:
+		log.Printf("Dropping SFU %s for %s: send buffer full", messageType, p.client.UserID)
+	}
+}
+
+func (p *sfuPeer) close() {
+	p.sendMutex.Lock()
+	p.closed = true
+	p.sendMutex.Unlock()
+
+	if err := p.pc.Close(); err != nil {
+		log.Printf("Error closing SFU peer for %s: %v", p.client.UserID, err)
+	}
+}
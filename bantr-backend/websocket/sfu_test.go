@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// sfuTestClient stands in for a browser: a pion PeerConnection signaling
+// with the room through its client's Send channel
+type sfuTestClient struct {
+	t      *testing.T
+	room   *sfuRoom
+	client *models.Client
+	pc     *webrtc.PeerConnection
+
+	mutex             sync.Mutex
+	pendingCandidates []webrtc.ICECandidateInit
+	done              chan struct{}
+}
+
+func newSFUTestClient(t *testing.T, room *sfuRoom, userID string) *sfuTestClient {
+	t.Helper()
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("creating PeerConnection: %v", err)
+	}
+
+	c := &sfuTestClient{
+		t:    t,
+		room: room,
+		client: &models.Client{
+			ID:     userID + "-conn",
+			UserID: userID,
+			Name:   userID,
+			RoomID: room.id,
+			Send:   make(chan []byte, 64),
+		},
+		pc:   pc,
+		done: make(chan struct{}),
+	}
+	go c.pump()
+
+	t.Cleanup(func() {
+		close(c.done)
+		pc.Close()
+	})
+	return c
+}
+
+// offer sends the client's offer to the room with every candidate included,
+// so only the server has to trickle
+func (c *sfuTestClient) offer() {
+	c.t.Helper()
+
+	offer, err := c.pc.CreateOffer(nil)
+	if err != nil {
+		c.t.Fatalf("creating offer: %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(c.pc)
+	if err := c.pc.SetLocalDescription(offer); err != nil {
+		c.t.Fatalf("setting offer: %v", err)
+	}
+	<-gathered
+
+	err = c.room.handleOffer(c.client, models.RTCOfferData{
+		SDP:  c.pc.LocalDescription().SDP,
+		Type: "offer",
+	})
+	if err != nil {
+		c.t.Fatalf("handling offer: %v", err)
+	}
+}
+
+// pump plays the signaling messages the room sends the client
+func (c *sfuTestClient) pump() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case messageBytes := <-c.client.Send:
+			var message models.WebSocketMessage
+			if err := json.Unmarshal(messageBytes, &message); err != nil {
+				c.t.Errorf("decoding message: %v", err)
+				continue
+			}
+			if err := c.handle(message); err != nil {
+				c.t.Errorf("handling %s: %v", message.Type, err)
+			}
+		}
+	}
+}
+
+func (c *sfuTestClient) handle(message models.WebSocketMessage) error {
+	switch message.Type {
+	case models.MessageTypeAnswer:
+		var answer models.RTCAnswerData
+		if err := json.Unmarshal(message.Data, &answer); err != nil {
+			return err
+		}
+		if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.SDP}); err != nil {
+			return err
+		}
+		return c.flushCandidates()
+
+	case models.MessageTypeOffer:
+		var offer models.RTCOfferData
+		if err := json.Unmarshal(message.Data, &offer); err != nil {
+			return err
+		}
+		if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.SDP}); err != nil {
+			return err
+		}
+		if err := c.flushCandidates(); err != nil {
+			return err
+		}
+		answer, err := c.pc.CreateAnswer(nil)
+		if err != nil {
+			return err
+		}
+		gathered := webrtc.GatheringCompletePromise(c.pc)
+		if err := c.pc.SetLocalDescription(answer); err != nil {
+			return err
+		}
+		<-gathered
+		return c.room.handleAnswer(c.client, models.RTCAnswerData{
+			SDP:  c.pc.LocalDescription().SDP,
+			Type: "answer",
+		})
+
+	case models.MessageTypeIceCandidate:
+		var iceData models.RTCIceCandidateData
+		if err := json.Unmarshal(message.Data, &iceData); err != nil {
+			return err
+		}
+		sdpMLineIndex := uint16(iceData.SdpMLineIndex)
+		candidate := webrtc.ICECandidateInit{
+			Candidate:     iceData.Candidate,
+			SDPMid:        &iceData.SdpMid,
+			SDPMLineIndex: &sdpMLineIndex,
+		}
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		// The server can trickle candidates before its answer arrives
+		if c.pc.RemoteDescription() == nil {
+			c.pendingCandidates = append(c.pendingCandidates, candidate)
+			return nil
+		}
+		return c.pc.AddICECandidate(candidate)
+	}
+	return nil
+}
+
+func (c *sfuTestClient) flushCandidates() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, candidate := range c.pendingCandidates {
+		if err := c.pc.AddICECandidate(candidate); err != nil {
+			return err
+		}
+	}
+	c.pendingCandidates = nil
+	return nil
+}
+
+func TestSFUForwardsRTPBetweenClients(t *testing.T) {
+	speakers := newSpeakerDetector("sfu-test", func(*models.Client) {})
+	defer speakers.close()
+	room := newSFURoom("sfu-test", speakers)
+	defer room.close()
+
+	// The subscriber joins first with only a data channel, so it has a
+	// server connection to receive the publisher's track on
+	subscriber := newSFUTestClient(t, room, "subscriber")
+	if _, err := subscriber.pc.CreateDataChannel("signal", nil); err != nil {
+		t.Fatalf("creating data channel: %v", err)
+	}
+
+	received := make(chan string, 1)
+	subscriber.pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := remote.ReadRTP(); err != nil {
+			return
+		}
+		select {
+		case received <- remote.StreamID():
+		default:
+		}
+	})
+	subscriber.offer()
+
+	publisher := newSFUTestClient(t, room, "publisher")
+	local, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "publisher-stream")
+	if err != nil {
+		t.Fatalf("creating track: %v", err)
+	}
+	if _, err := publisher.pc.AddTrack(local); err != nil {
+		t.Fatalf("adding track: %v", err)
+	}
+	publisher.offer()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(15 * time.Second)
+
+	for {
+		select {
+		case streamID := <-received:
+			// Subscribers tell publishers apart by the stream ID
+			if streamID != "publisher" {
+				t.Errorf("stream ID = %q, want the publisher's user ID", streamID)
+			}
+			return
+		case <-ticker.C:
+			sample := media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond}
+			if err := local.WriteSample(sample); err != nil {
+				t.Fatalf("writing sample: %v", err)
+			}
+		case <-timeout:
+			t.Fatal("subscriber received no RTP from the publisher")
+		}
+	}
+}
@@ -0,0 +1,660 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	layerAllocationInterval = time.Second
+	// initialBitrateEstimate is where congestion control starts from. It
+	// isn't used for layer selection until the subscriber has sent feedback.
+	initialBitrateEstimate = 2_500_000
+	// lossBackoffThreshold is the receiver-reported fraction lost (out of
+	// 256) above which a subscriber's budget is cut
+	lossBackoffThreshold = 25
+	// switchTimestampGap is added between the last forwarded packet and the
+	// first packet of a new layer so the RTP clock keeps moving forward
+	switchTimestampGap = 3000
+)
+
+const (
+	trackPriorityNormal = iota
+	trackPriorityActiveSpeaker
+	trackPriorityScreenShare
+)
+
+// sfuTrack is a track published in an SFU room. Simulcast publishers send
+// several encodings of it, each arriving as its own layer.
+type sfuTrack struct {
+	key       string
+	id        string
+	streamID  string
+	kind      webrtc.RTPCodecType
+	codec     webrtc.RTPCodecParameters
+	owner     *sfuPeer
+	simulcast bool
+
+	mutex         sync.RWMutex
+	screenShare   bool
+	layers        []*sfuLayer
+	subscriptions map[string]*sfuSubscription // keyed by subscriber client ID
+}
+
+type sfuLayer struct {
+	rid    string
+	remote *webrtc.TrackRemote
+	bytes  atomic.Uint64
+	// bitrate is the measured incoming bitrate in bits per second
+	bitrate atomic.Uint64
+}
+
+// sfuSubscription is one subscriber's copy of a published track. It decides
+// which layer reaches the subscriber and keeps sequence numbers and
+// timestamps continuous across layer switches.
+type sfuSubscription struct {
+	subscriber *sfuPeer
+	track      *sfuTrack
+	local      *webrtc.TrackLocalStaticRTP
+	sender     *webrtc.RTPSender
+
+	mutex          sync.Mutex
+	preferredLayer string
+	targetRID      string
+	currentRID     string
+	forwarding     bool
+	rebase         bool
+	started        bool
+	seqOffset      uint16
+	tsOffset       uint32
+	lastSeq        uint16
+	lastTimestamp  uint32
+}
+
+// peerBandwidth tracks what a subscriber can receive, combining send-side
+// estimation from TWCC feedback with REMB and receiver report loss
+type peerBandwidth struct {
+	mutex        sync.RWMutex
+	estimator    cc.BandwidthEstimator
+	remb         uint64
+	fractionLost uint8
+	// feedback is set once the subscriber has sent anything to estimate
+	// from. Until then the estimator is only guessing.
+	feedback bool
+}
+
+func newSFUTrack(key string, owner *sfuPeer, remote *webrtc.TrackRemote) *sfuTrack {
+	return &sfuTrack{
+		key:           key,
+		id:            remote.ID(),
+		streamID:      remote.StreamID(),
+		kind:          remote.Kind(),
+		codec:         remote.Codec(),
+		owner:         owner,
+		simulcast:     remote.RID() != "",
+		screenShare:   owner.isScreenStream(remote.StreamID()),
+		subscriptions: make(map[string]*sfuSubscription),
+	}
+}
+
+func (t *sfuTrack) addLayer(remote *webrtc.TrackRemote) *sfuLayer {
+	layer := &sfuLayer{rid: remote.RID(), remote: remote}
+
+	t.mutex.Lock()
+	t.layers = append(t.layers, layer)
+	t.mutex.Unlock()
+
+	return layer
+}
+
+// removeLayer drops a layer whose publisher stopped sending and returns how
+// many layers remain
+func (t *sfuTrack) removeLayer(layer *sfuLayer) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i, existing := range t.layers {
+		if existing == layer {
+			t.layers = append(t.layers[:i], t.layers[i+1:]...)
+			break
+		}
+	}
+	return len(t.layers)
+}
+
+// sortedLayers returns the track's layers from lowest to highest bitrate.
+// Layers that haven't been measured yet keep the order they arrived in.
+func (t *sfuTrack) sortedLayers() []*sfuLayer {
+	t.mutex.RLock()
+	layers := make([]*sfuLayer, len(t.layers))
+	copy(layers, t.layers)
+	t.mutex.RUnlock()
+
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].bitrate.Load() < layers[j].bitrate.Load()
+	})
+	return layers
+}
+
+func (t *sfuTrack) bestLayer() *sfuLayer {
+	layers := t.sortedLayers()
+	if len(layers) == 0 {
+		return nil
+	}
+	return layers[len(layers)-1]
+}
+
+func (t *sfuTrack) findLayer(rid string) *sfuLayer {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for _, layer := range t.layers {
+		if layer.rid == rid {
+			return layer
+		}
+	}
+	return nil
+}
+
+func (t *sfuTrack) measureLayers(interval time.Duration) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for _, layer := range t.layers {
+		bytes := layer.bytes.Swap(0)
+		layer.bitrate.Store(bytes * 8 * uint64(time.Second) / uint64(interval))
+	}
+}
+
+// bitrate is the total incoming bitrate across all of the track's layers
+func (t *sfuTrack) bitrate() uint64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var total uint64
+	for _, layer := range t.layers {
+		total += layer.bitrate.Load()
+	}
+	return total
+}
+
+func (t *sfuTrack) priority(activeSpeaker string) int {
+	t.mutex.RLock()
+	screenShare := t.screenShare
+	t.mutex.RUnlock()
+
+	if screenShare {
+		return trackPriorityScreenShare
+	}
+	if activeSpeaker != "" && t.owner.client.ID == activeSpeaker {
+		return trackPriorityActiveSpeaker
+	}
+	return trackPriorityNormal
+}
+
+func (t *sfuTrack) addSubscription(subscription *sfuSubscription) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.subscriptions[subscription.subscriber.client.ID] = subscription
+}
+
+func (t *sfuTrack) removeSubscription(subscriber *sfuPeer) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.subscriptions, subscriber.client.ID)
+}
+
+// forward hands a packet received on one of the track's layers to every
+// subscriber; each decides whether that layer is the one it is receiving
+func (t *sfuTrack) forward(layer *sfuLayer, packet *rtp.Packet) {
+	keyframe := t.kind == webrtc.RTPCodecTypeVideo && isKeyframe(t.codec.MimeType, packet.Payload)
+
+	t.mutex.RLock()
+	subscriptions := make([]*sfuSubscription, 0, len(t.subscriptions))
+	for _, subscription := range t.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	t.mutex.RUnlock()
+
+	for _, subscription := range subscriptions {
+		subscription.writeRTP(layer, packet, keyframe)
+	}
+}
+
+func (l *sfuLayer) countBytes(n int) {
+	l.bytes.Add(uint64(n))
+}
+
+func newSFUSubscription(subscriber *sfuPeer, track *sfuTrack, local *webrtc.TrackLocalStaticRTP, sender *webrtc.RTPSender) *sfuSubscription {
+	subscription := &sfuSubscription{
+		subscriber: subscriber,
+		track:      track,
+		local:      local,
+		sender:     sender,
+	}
+
+	if track.simulcast {
+		// Start on the cheapest layer; allocation moves it up once the
+		// subscriber's bandwidth is known
+		if layers := track.sortedLayers(); len(layers) > 0 {
+			subscription.targetRID = layers[0].rid
+		}
+	} else {
+		subscription.forwarding = true
+	}
+
+	return subscription
+}
+
+func (s *sfuSubscription) writeRTP(layer *sfuLayer, packet *rtp.Packet, keyframe bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Layers can only be switched on a keyframe or the decoder breaks
+	if layer.rid == s.targetRID && (!s.forwarding || s.currentRID != layer.rid) {
+		if !keyframe {
+			return
+		}
+		s.currentRID = layer.rid
+		s.forwarding = true
+		s.rebase = true
+	}
+
+	if !s.forwarding || layer.rid != s.currentRID {
+		return
+	}
+
+	if s.rebase {
+		if s.started {
+			s.seqOffset = s.lastSeq + 1 - packet.SequenceNumber
+			s.tsOffset = s.lastTimestamp + switchTimestampGap - packet.Timestamp
+		}
+		s.rebase = false
+	}
+
+	outgoing := *packet
+	outgoing.SequenceNumber = packet.SequenceNumber + s.seqOffset
+	outgoing.Timestamp = packet.Timestamp + s.tsOffset
+	// Header extension IDs were negotiated with the publisher, not with us
+	outgoing.Extension = false
+	outgoing.Extensions = nil
+
+	s.lastSeq = outgoing.SequenceNumber
+	s.lastTimestamp = outgoing.Timestamp
+	s.started = true
+
+	if err := s.local.WriteRTP(&outgoing); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		log.Printf("Error forwarding RTP to %s: %v", s.subscriber.client.UserID, err)
+	}
+}
+
+// setTarget asks for a switch to layer, which happens on its next keyframe
+func (s *sfuSubscription) setTarget(layer *sfuLayer) {
+	s.mutex.Lock()
+	if s.targetRID == layer.rid {
+		s.mutex.Unlock()
+		return
+	}
+	s.targetRID = layer.rid
+	s.mutex.Unlock()
+
+	s.track.owner.requestKeyframe(layer.remote)
+}
+
+func (s *sfuSubscription) setPreferredLayer(layer string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if layer == models.LayerAuto {
+		layer = ""
+	}
+	s.preferredLayer = layer
+}
+
+// requestKeyframe asks the publisher for a keyframe on whichever layer this
+// subscriber is receiving or about to receive
+func (s *sfuSubscription) requestKeyframe() {
+	s.mutex.Lock()
+	rid := s.targetRID
+	if s.forwarding {
+		rid = s.currentRID
+	}
+	s.mutex.Unlock()
+
+	if layer := s.track.findLayer(rid); layer != nil {
+		s.track.owner.requestKeyframe(layer.remote)
+	}
+}
+
+// targetIndex finds the layer the subscription is on or switching to in
+// layers, or 0 if it isn't one of them
+func (s *sfuSubscription) targetIndex(layers []*sfuLayer) int {
+	s.mutex.Lock()
+	rid := s.targetRID
+	s.mutex.Unlock()
+
+	for i, layer := range layers {
+		if layer.rid == rid {
+			return i
+		}
+	}
+	return 0
+}
+
+// allowedLayers trims layers (sorted lowest first) to those at or below the
+// subscriber's preferred layer
+func (s *sfuSubscription) allowedLayers(layers []*sfuLayer) []*sfuLayer {
+	s.mutex.Lock()
+	preferred := s.preferredLayer
+	s.mutex.Unlock()
+
+	if len(layers) == 0 {
+		return layers
+	}
+
+	switch preferred {
+	case "":
+		return layers
+	case models.LayerLow:
+		return layers[:1]
+	case models.LayerMedium:
+		return layers[:len(layers)/2+1]
+	case models.LayerHigh:
+		return layers
+	}
+
+	for i, layer := range layers {
+		if layer.rid == preferred {
+			return layers[:i+1]
+		}
+	}
+	return layers
+}
+
+func (b *peerBandwidth) setEstimator(estimator cc.BandwidthEstimator) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.estimator = estimator
+}
+
+func (b *peerBandwidth) setREMB(bitrate uint64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remb = bitrate
+	b.feedback = true
+}
+
+func (b *peerBandwidth) setFractionLost(fractionLost uint8) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.fractionLost = fractionLost
+	b.feedback = true
+}
+
+// markFeedback records that TWCC feedback reached the estimator
+func (b *peerBandwidth) markFeedback() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.feedback = true
+}
+
+// available returns the subscriber's receive budget in bits per second, or 0
+// if nothing is known about it yet
+func (b *peerBandwidth) available() uint64 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if !b.feedback {
+		return 0
+	}
+
+	var estimate uint64
+	if b.estimator != nil {
+		estimate = uint64(b.estimator.GetTargetBitrate())
+	}
+	if b.remb > 0 && (estimate == 0 || b.remb < estimate) {
+		estimate = b.remb
+	}
+	if b.fractionLost > lossBackoffThreshold {
+		estimate = estimate * uint64(256-int(b.fractionLost)) / 256
+	}
+	return estimate
+}
+
+// layerChoice is a simulcast subscription being considered for an upgrade
+type layerChoice struct {
+	subscription *sfuSubscription
+	layers       []*sfuLayer
+	index        int
+	// current is the index of the layer the subscription is already on
+	current  int
+	priority int
+}
+
+func (r *sfuRoom) allocateLayers() {
+	r.mutex.RLock()
+	tracks := make([]*sfuTrack, 0, len(r.tracks))
+	for _, track := range r.tracks {
+		tracks = append(tracks, track)
+	}
+	peers := make([]*sfuPeer, 0, len(r.peers))
+	for _, peer := range r.peers {
+		peers = append(peers, peer)
+	}
+	activeSpeaker := r.activeSpeaker
+	r.mutex.RUnlock()
+
+	for _, track := range tracks {
+		track.measureLayers(layerAllocationInterval)
+	}
+
+	for _, peer := range peers {
+		r.allocatePeerLayers(peer, activeSpeaker)
+	}
+}
+
+// allocatePeerLayers spends a subscriber's bandwidth budget across the
+// simulcast tracks it receives. Everyone gets their lowest layer first, then
+// screen shares, the active speaker and everybody else are upgraded in that
+// order while the budget lasts. Until the subscriber's bandwidth is known
+// nothing is upgraded, and upgrades go one layer at a time so the estimate
+// can catch up before the next.
+func (r *sfuRoom) allocatePeerLayers(peer *sfuPeer, activeSpeaker string) {
+	peer.negotiationMutex.Lock()
+	subscriptions := make([]*sfuSubscription, 0, len(peer.subscriptions))
+	for _, subscription := range peer.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	peer.negotiationMutex.Unlock()
+
+	budget := peer.bandwidth.available()
+	var spent uint64
+
+	choices := make([]*layerChoice, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		track := subscription.track
+		if !track.simulcast {
+			spent += track.bitrate()
+			continue
+		}
+
+		layers := subscription.allowedLayers(track.sortedLayers())
+		if len(layers) == 0 {
+			continue
+		}
+
+		choices = append(choices, &layerChoice{
+			subscription: subscription,
+			layers:       layers,
+			current:      subscription.targetIndex(layers),
+			priority:     track.priority(activeSpeaker),
+		})
+		spent += layers[0].bitrate.Load()
+	}
+
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].priority > choices[j].priority
+	})
+
+	for _, choice := range choices {
+		if budget == 0 {
+			break
+		}
+
+		current := choice.layers[choice.index].bitrate.Load()
+		highest := len(choice.layers) - 1
+		if choice.current+1 < highest {
+			highest = choice.current + 1
+		}
+		for i := highest; i > choice.index; i-- {
+			var extra uint64
+			if bitrate := choice.layers[i].bitrate.Load(); bitrate > current {
+				extra = bitrate - current
+			}
+			if spent+extra <= budget {
+				choice.index = i
+				spent += extra
+				break
+			}
+		}
+	}
+
+	for _, choice := range choices {
+		choice.subscription.setTarget(choice.layers[choice.index])
+	}
+}
+
+// setPreferredLayer caps the layer a subscriber receives for a publisher's
+// tracks, or for one of them if trackID is set
+func (r *sfuRoom) setPreferredLayer(client *models.Client, layerData models.SetPreferredLayerData) error {
+	r.mutex.RLock()
+	peer, exists := r.peers[client.ID]
+	activeSpeaker := r.activeSpeaker
+	r.mutex.RUnlock()
+	if !exists {
+		return errors.New("no server connection")
+	}
+
+	peer.negotiationMutex.Lock()
+	matched := 0
+	for _, subscription := range peer.subscriptions {
+		track := subscription.track
+		if track.owner.client.UserID != layerData.PublisherID {
+			continue
+		}
+		if layerData.TrackID != "" && track.id != layerData.TrackID {
+			continue
+		}
+		subscription.setPreferredLayer(layerData.Layer)
+		matched++
+	}
+	peer.negotiationMutex.Unlock()
+
+	if matched == 0 {
+		return errors.New("no matching subscription")
+	}
+
+	r.allocatePeerLayers(peer, activeSpeaker)
+	return nil
+}
+
+// refreshScreenShares re-evaluates which of a publisher's tracks are screen
+// shares after it announced a new set of screen streams
+func (r *sfuRoom) refreshScreenShares(publisher *sfuPeer) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, track := range r.tracks {
+		if track.owner != publisher {
+			continue
+		}
+		track.mutex.Lock()
+		track.screenShare = publisher.isScreenStream(track.streamID)
+		track.mutex.Unlock()
+	}
+}
+
+// isKeyframe reports whether an RTP payload starts a keyframe. Payloads of
+// codecs we can't inspect are treated as keyframes.
+func isKeyframe(mimeType string, payload []byte) bool {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		vp8 := &codecs.VP8Packet{}
+		if _, err := vp8.Unmarshal(payload); err != nil || len(vp8.Payload) == 0 {
+			return false
+		}
+		return vp8.S == 1 && vp8.PID == 0 && vp8.Payload[0]&0x01 == 0
+
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		vp9 := &codecs.VP9Packet{}
+		if _, err := vp9.Unmarshal(payload); err != nil {
+			return false
+		}
+		return !vp9.P && vp9.B
+
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return isH264Keyframe(payload)
+
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		av1 := &codecs.AV1Packet{}
+		if _, err := av1.Unmarshal(payload); err != nil {
+			return false
+		}
+		return av1.N
+	}
+
+	return true
+}
+
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	const (
+		naluIDR  = 5
+		naluSPS  = 7
+		naluSTAP = 24
+		naluFUA  = 28
+	)
+
+	switch naluType := payload[0] & 0x1F; naluType {
+	case naluIDR, naluSPS:
+		return true
+
+	case naluSTAP:
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+			if offset >= len(payload) {
+				break
+			}
+			if t := payload[offset] & 0x1F; t == naluIDR || t == naluSPS {
+				return true
+			}
+			offset += size
+		}
+
+	case naluFUA:
+		if len(payload) < 2 {
+			return false
+		}
+		start := payload[1]&0x80 != 0
+		t := payload[1] & 0x1F
+		return start && (t == naluIDR || t == naluSPS)
+	}
+
+	return false
+}
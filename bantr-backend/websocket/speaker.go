@@ -0,0 +1,187 @@
+package websocket
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/AnshX01/Bantr/bantr-backend/models"
+	"github.com/AnshX01/Bantr/bantr-backend/utils"
+)
+
+const (
+	speakerTickInterval = 250 * time.Millisecond
+	// speechLevelThreshold is the smoothed level (0-1, about -40 dBov) above
+	// which a participant counts as speaking
+	speechLevelThreshold = 0.01
+	// levelSmoothing weights the newest tick's peak in the running level
+	levelSmoothing = 0.5
+	// A new speaker has to be the loudest for this many ticks in a row, and
+	// the current one must have held the floor for speakerMinHold, before
+	// the active speaker changes
+	speakerSwitchTicks = 3
+	speakerMinHold     = 1500 * time.Millisecond
+)
+
+// speakerDetector works out the dominant speaker in a room from audio levels
+// and accumulates how long each participant spoke
+type speakerDetector struct {
+	roomID   string
+	onChange func(client *models.Client)
+
+	mutex          sync.Mutex
+	participants   map[string]*speakerState // keyed by client ID
+	current        string
+	currentSince   time.Time
+	candidate      string
+	candidateTicks int
+	done           chan struct{}
+}
+
+type speakerState struct {
+	client *models.Client
+	// peak is the loudest level reported since the last tick
+	peak  float64
+	level float64
+	// speaking is time spent speaking not yet saved to analytics
+	speaking time.Duration
+}
+
+func newSpeakerDetector(roomID string, onChange func(client *models.Client)) *speakerDetector {
+	d := &speakerDetector{
+		roomID:       roomID,
+		onChange:     onChange,
+		participants: make(map[string]*speakerState),
+		done:         make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// reportLevel records a participant's current audio level, from 0 to 1
+func (d *speakerDetector) reportLevel(client *models.Client, level float64) {
+	level = math.Max(0, math.Min(1, level))
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	state, exists := d.participants[client.ID]
+	if !exists {
+		state = &speakerState{client: client}
+		d.participants[client.ID] = state
+	}
+	if level > state.peak {
+		state.peak = level
+	}
+}
+
+func (d *speakerDetector) run() {
+	ticker := time.NewTicker(speakerTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if client := d.tick(); client != nil {
+				d.onChange(client)
+			}
+		}
+	}
+}
+
+// tick updates everyone's level and returns the new active speaker, if it
+// changed
+func (d *speakerDetector) tick() *models.Client {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var loudest *speakerState
+	for _, state := range d.participants {
+		state.level = levelSmoothing*state.peak + (1-levelSmoothing)*state.level
+		state.peak = 0
+
+		if state.level < speechLevelThreshold {
+			continue
+		}
+		state.speaking += speakerTickInterval
+		if loudest == nil || state.level > loudest.level {
+			loudest = state
+		}
+	}
+
+	if loudest == nil || loudest.client.ID == d.current {
+		d.candidate = ""
+		d.candidateTicks = 0
+		return nil
+	}
+
+	if loudest.client.ID != d.candidate {
+		d.candidate = loudest.client.ID
+		d.candidateTicks = 0
+	}
+	d.candidateTicks++
+
+	if d.candidateTicks < speakerSwitchTicks {
+		return nil
+	}
+	if d.current != "" && time.Since(d.currentSince) < speakerMinHold {
+		return nil
+	}
+
+	d.current = loudest.client.ID
+	d.currentSince = time.Now()
+	d.candidate = ""
+	d.candidateTicks = 0
+
+	log.Printf("Active speaker in room %s is now %s", d.roomID, loudest.client.UserID)
+	return loudest.client
+}
+
+// removeClient saves a departing participant's speaking time
+func (d *speakerDetector) removeClient(client *models.Client) {
+	d.mutex.Lock()
+	state, exists := d.participants[client.ID]
+	delete(d.participants, client.ID)
+	if d.current == client.ID {
+		d.current = ""
+	}
+	d.mutex.Unlock()
+
+	if exists {
+		d.flush(state)
+	}
+}
+
+func (d *speakerDetector) close() {
+	close(d.done)
+
+	d.mutex.Lock()
+	participants := d.participants
+	d.participants = make(map[string]*speakerState)
+	d.mutex.Unlock()
+
+	for _, state := range participants {
+		d.flush(state)
+	}
+}
+
+func (d *speakerDetector) flush(state *speakerState) {
+	if state.speaking <= 0 || state.client.UserID == "" {
+		return
+	}
+
+	analyticsCollection := utils.GetMeetingAnalyticsCollection()
+	err := models.AddSpeakingTime(analyticsCollection, d.roomID, state.client.UserID, state.client.Name, state.speaking.Seconds())
+	if err != nil {
+		log.Printf("Error saving speaking time for %s in room %s: %v", state.client.UserID, d.roomID, err)
+	}
+}
+
+// audioLevelFromDBov converts an RTP audio level (RFC 6464, 0 to 127 -dBov)
+// to the 0-1 scale clients report on
+func audioLevelFromDBov(dBov uint8) float64 {
+	return math.Pow(10, -float64(dBov)/20)
+}
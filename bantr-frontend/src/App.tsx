@@ -4,6 +4,10 @@ import Home from './pages/Home';
 import Login from './components/Login';
 import MeetingDashboard from './components/MeetingDashboard';
 import MeetingRoom from './components/MeetingRoom';
+import AuthCallback from './pages/AuthCallback';
+import MagicLink from './pages/MagicLink';
+import ChatLink from './pages/ChatLink';
+import Invitation from './pages/Invitation';
 
 function App() {
   const isAuthenticated = !!localStorage.getItem("token");
@@ -13,9 +17,13 @@ function App() {
       <Routes>
         <Route path="/" element={<Navigate to={isAuthenticated ? "/home" : "/login"} />} />
         <Route path="/login" element={<Login />} />
+        <Route path="/auth/callback" element={<AuthCallback />} />
+        <Route path="/auth/magic-link" element={<MagicLink />} />
         <Route path="/home" element={<Home />} />
         <Route path="/meetings" element={<MeetingDashboard />} />
         <Route path="/meetings/:meetingId" element={<MeetingRoom />} />
+        <Route path="/integrations/chat/link" element={<ChatLink />} />
+        <Route path="/invitations/:token" element={<Invitation />} />
       </Routes>
     </Router>
   );
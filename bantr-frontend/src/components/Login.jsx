@@ -1,12 +1,19 @@
 import React, { useState } from 'react';
 import { GoogleLogin } from '@react-oauth/google';
-import { useNavigate } from 'react-router-dom';
-import apiService from '../services/api';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import apiService, { safeRedirectPath } from '../services/api';
+import TwoFactorForm from './TwoFactorForm';
 
 const Login = () => {
   const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  // Pages that need a login send people here with where to come back to
+  const redirect = safeRedirectPath(searchParams.get('redirect'));
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
+  const [challengeToken, setChallengeToken] = useState(null);
+  const [email, setEmail] = useState('');
+  const [linkSent, setLinkSent] = useState(false);
 
   const handleGoogleSuccess = async (credentialResponse) => {
     setLoading(true);
@@ -14,13 +21,17 @@ const Login = () => {
     
     try {
       const data = await apiService.googleAuth(credentialResponse.credential);
+
+      if (data.two_factor_required) {
+        setChallengeToken(data.challenge_token);
+        return;
+      }
       
       // Store authentication data
-      localStorage.setItem('token', data.token);
-      localStorage.setItem('user', JSON.stringify(data.user));
+      apiService.setSession(data);
       
       console.log('Login successful:', data.user);
-      navigate('/home');
+      navigate(redirect);
     } catch (error) {
       setError(error.message || 'Authentication failed');
       console.error('Login error:', error);
@@ -29,11 +40,39 @@ const Login = () => {
     }
   };
 
+  const handleTwoFactorSuccess = (data) => {
+    apiService.setSession(data);
+    navigate(redirect);
+  };
+
+  const handleMagicLink = async (e) => {
+    e.preventDefault();
+    if (!email.trim()) {
+      setError('Enter your email address');
+      return;
+    }
+
+    setLoading(true);
+    setError('');
+    try {
+      await apiService.requestMagicLink(email.trim(), redirect);
+      setLinkSent(true);
+    } catch (error) {
+      setError(error.message || 'Could not send a login link');
+    } finally {
+      setLoading(false);
+    }
+  };
+
   const handleGoogleError = () => {
     setError('Google login failed. Please try again.');
     console.log('Google Login Failed');
   };
 
+  if (challengeToken) {
+    return <TwoFactorForm challengeToken={challengeToken} onSuccess={handleTwoFactorSuccess} />;
+  }
+
   return (
     <div style={{ textAlign: 'center', marginTop: '50px' }}>
       <h2>Login with Google</h2>
@@ -50,6 +89,21 @@ const Login = () => {
           onError={handleGoogleError}
         />
       )}
+      <h3 style={{ marginTop: '30px' }}>Or sign in with email</h3>
+      {linkSent ? (
+        <div>Check your inbox for a login link.</div>
+      ) : (
+        <form onSubmit={handleMagicLink}>
+          <input
+            type="email"
+            value={email}
+            onChange={(e) => setEmail(e.target.value)}
+            placeholder="you@example.com"
+            style={{ padding: '8px', marginRight: '10px' }}
+          />
+          <button type="submit" disabled={loading}>Email me a link</button>
+        </form>
+      )}
     </div>
   );
 };
@@ -0,0 +1,54 @@
+import React, { useState } from 'react';
+import apiService from '../services/api';
+
+// Second step of a login for accounts with two-factor authentication. Takes
+// a code from the authenticator app or a recovery code.
+const TwoFactorForm = ({ challengeToken, onSuccess }) => {
+  const [code, setCode] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState('');
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    if (!code.trim()) {
+      setError('Enter the code from your authenticator app');
+      return;
+    }
+
+    setLoading(true);
+    setError('');
+    try {
+      const data = await apiService.verifyTwoFactor(challengeToken, code.trim());
+      await onSuccess(data);
+    } catch (error) {
+      setError(error.message || 'Invalid code');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <form onSubmit={handleSubmit} style={{ textAlign: 'center', marginTop: '50px' }}>
+      <h2>Two-factor authentication</h2>
+      <p>Enter the code from your authenticator app, or one of your recovery codes.</p>
+      {error && (
+        <div style={{ color: 'red', marginBottom: '20px' }}>
+          {error}
+        </div>
+      )}
+      <input
+        type="text"
+        value={code}
+        onChange={(e) => setCode(e.target.value)}
+        autoComplete="one-time-code"
+        autoFocus
+        style={{ padding: '8px', marginRight: '10px' }}
+      />
+      <button type="submit" disabled={loading}>
+        {loading ? 'Verifying...' : 'Verify'}
+      </button>
+    </form>
+  );
+};
+
+export default TwoFactorForm;
@@ -0,0 +1,71 @@
+import React, { useEffect, useState } from 'react';
+import { Link, useNavigate } from 'react-router-dom';
+import apiService, { safeRedirectPath } from '../services/api';
+import TwoFactorForm from '../components/TwoFactorForm';
+
+const errorMessages: Record<string, string> = {
+  invalid_state: 'This sign-in link has expired or was started in another browser. Please try again.',
+  login_failed: 'The provider could not sign you in.',
+  identity_in_use: 'That account is already linked to another Bantr user.',
+  email_in_use: 'An account with this email already exists. Sign in to it and link this provider from your settings.',
+  account_deactivated: 'This account has been deactivated.',
+  server_error: 'Something went wrong on our side. Please try again.',
+};
+
+// AuthCallback is where the backend sends the browser back after signing in
+// or linking an account with a provider. The result is in the fragment so
+// tokens never reach server logs.
+function AuthCallback() {
+  const navigate = useNavigate();
+  const [params] = useState(() => new URLSearchParams(window.location.hash.slice(1)));
+  const [error, setError] = useState('');
+  const redirect = safeRedirectPath(params.get('redirect'));
+  const challengeToken = params.get('two_factor_required') === 'true' ? params.get('challenge_token') : null;
+
+  useEffect(() => {
+    // Keep the tokens out of the history and the address bar
+    window.history.replaceState(null, '', window.location.pathname);
+
+    const providerError = params.get('error');
+    if (providerError) {
+      setError(errorMessages[providerError] || 'Sign-in failed. Please try again.');
+      return;
+    }
+    if (params.get('linked')) {
+      navigate(redirect, { replace: true });
+      return;
+    }
+    if (challengeToken) {
+      return;
+    }
+
+    const token = params.get('token');
+    if (!token) {
+      setError('Sign-in failed. Please try again.');
+      return;
+    }
+    apiService.completeLogin({ token, refresh_token: params.get('refresh_token') })
+      .then(() => navigate(redirect, { replace: true }))
+      .catch((error: Error) => setError(error.message || 'Sign-in failed. Please try again.'));
+  }, [params, redirect, challengeToken, navigate]);
+
+  const handleTwoFactorSuccess = async (data: any) => {
+    await apiService.completeLogin(data);
+    navigate(redirect, { replace: true });
+  };
+
+  if (error) {
+    return (
+      <div style={{ textAlign: 'center', marginTop: '50px' }}>
+        <div style={{ color: 'red', marginBottom: '20px' }}>{error}</div>
+        <Link to="/login">Back to login</Link>
+      </div>
+    );
+  }
+  if (challengeToken) {
+    return <TwoFactorForm challengeToken={challengeToken} onSuccess={handleTwoFactorSuccess} />;
+  }
+  return <div style={{ textAlign: 'center', marginTop: '50px' }}>Signing you in...</div>;
+}
+
+export default AuthCallback;
@@ -0,0 +1,100 @@
+import React, { useEffect, useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import apiService from '../services/api';
+
+interface ChatAccount {
+  platform: string;
+  team_domain?: string;
+  chat_user_id: string;
+  chat_user_name?: string;
+}
+
+// ChatLink finishes linking a Slack or Mattermost account from the link the
+// /bantr command replied with. The account is shown first and only linked
+// once the user confirms it's theirs.
+function ChatLink() {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token');
+  const [account, setAccount] = useState<ChatAccount | null>(null);
+  const [error, setError] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [linked, setLinked] = useState(false);
+
+  useEffect(() => {
+    if (!apiService.isAuthenticated()) {
+      const here = window.location.pathname + window.location.search;
+      navigate(`/login?redirect=${encodeURIComponent(here)}`, { replace: true });
+      return;
+    }
+    if (!token) {
+      setError('This link is incomplete. Run the command in chat again.');
+      return;
+    }
+
+    apiService.previewChatLink(token)
+      .then((data: any) => setAccount(data.chat_link))
+      .catch((error: Error) => setError(error.message || 'This link is invalid or has expired.'));
+  }, [token, navigate]);
+
+  const handleConfirm = async () => {
+    if (!token) {
+      return;
+    }
+    setLoading(true);
+    setError('');
+    try {
+      await apiService.confirmChatLink(token);
+      setLinked(true);
+    } catch (error) {
+      setError(error instanceof Error ? error.message : 'Failed to link chat account');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  if (error) {
+    return (
+      <div style={{ textAlign: 'center', marginTop: '50px' }}>
+        <div style={{ color: 'red', marginBottom: '20px' }}>{error}</div>
+        <Link to="/home">Back to Bantr</Link>
+      </div>
+    );
+  }
+  if (!account) {
+    return <div style={{ textAlign: 'center', marginTop: '50px' }}>Loading...</div>;
+  }
+
+  const workspace = account.team_domain || 'your workspace';
+  const name = account.chat_user_name ? `@${account.chat_user_name}` : account.chat_user_id;
+
+  if (linked) {
+    return (
+      <div style={{ textAlign: 'center', marginTop: '50px' }}>
+        <h2>Chat account linked</h2>
+        <p>You can now use /bantr as {name} in {workspace}.</p>
+        <Link to="/home">Back to Bantr</Link>
+      </div>
+    );
+  }
+
+  const user = apiService.getUser();
+  return (
+    <div style={{ textAlign: 'center', marginTop: '50px' }}>
+      <h2>Link your {account.platform} account?</h2>
+      <p>
+        {name} in {workspace} will be able to start meetings
+        as {user ? user.email : 'you'}.
+      </p>
+      <p>Only continue if you ran the /bantr command yourself.</p>
+      <button onClick={handleConfirm} disabled={loading} style={{ marginRight: '10px' }}>
+        {loading ? 'Linking...' : 'Link account'}
+      </button>
+      <button onClick={() => navigate('/home')} disabled={loading}>
+        Cancel
+      </button>
+    </div>
+  );
+}
+
+export default ChatLink;
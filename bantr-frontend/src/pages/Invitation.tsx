@@ -0,0 +1,98 @@
+import React, { useEffect, useState } from 'react';
+import { useParams } from 'react-router-dom';
+import apiService from '../services/api';
+
+interface InvitedMeeting {
+  room_id: string;
+  title: string;
+  description?: string;
+  creator_name?: string;
+  schedule?: { starts_at: string; duration_minutes: number };
+  is_active: boolean;
+}
+
+const responses = [
+  { value: 'accepted', label: 'Yes' },
+  { value: 'tentative', label: 'Maybe' },
+  { value: 'declined', label: 'No' },
+];
+
+// Invitation is where the link in an invitation email lands. Invitees RSVP
+// with the token alone, since most of them won't have an account.
+function Invitation() {
+  const { token = '' } = useParams();
+  const [meeting, setMeeting] = useState<InvitedMeeting | null>(null);
+  const [rsvp, setRsvp] = useState('');
+  const [error, setError] = useState('');
+  const [saving, setSaving] = useState(false);
+
+  useEffect(() => {
+    apiService.getInvitation(token)
+      .then((data: any) => {
+        setMeeting(data.meeting);
+        setRsvp(data.invitation.rsvp);
+      })
+      .catch((error: Error) => setError(error.message || 'Invitation not found'));
+  }, [token]);
+
+  const handleResponse = async (response: string) => {
+    setSaving(true);
+    setError('');
+    try {
+      const data = await apiService.respondToInvitation(token, response);
+      setRsvp(data.rsvp);
+    } catch (error) {
+      setError(error instanceof Error ? error.message : 'Failed to save response');
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  if (!meeting) {
+    return (
+      <div style={{ textAlign: 'center', marginTop: '50px' }}>
+        {error ? <div style={{ color: 'red' }}>{error}</div> : 'Loading...'}
+      </div>
+    );
+  }
+
+  return (
+    <div style={{ textAlign: 'center', marginTop: '50px' }}>
+      <h2>{meeting.title}</h2>
+      {meeting.creator_name && <p>Invited by {meeting.creator_name}</p>}
+      {meeting.schedule && (
+        <p>
+          {new Date(meeting.schedule.starts_at).toLocaleString()} ({meeting.schedule.duration_minutes} minutes)
+        </p>
+      )}
+      {meeting.description && <p>{meeting.description}</p>}
+      {error && (
+        <div style={{ color: 'red', marginBottom: '20px' }}>
+          {error}
+        </div>
+      )}
+      {meeting.is_active ? (
+        <>
+          <p>Will you attend?</p>
+          {responses.map(({ value, label }) => (
+            <button
+              key={value}
+              onClick={() => handleResponse(value)}
+              disabled={saving}
+              style={{ marginRight: '10px', fontWeight: rsvp === value ? 'bold' : 'normal' }}
+            >
+              {label}
+            </button>
+          ))}
+          <p style={{ marginTop: '30px' }}>
+            <a href={`/meetings/${meeting.room_id}`}>Join the meeting</a>
+          </p>
+        </>
+      ) : (
+        <p>This meeting has ended.</p>
+      )}
+    </div>
+  );
+}
+
+export default Invitation;
@@ -0,0 +1,59 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import apiService, { safeRedirectPath } from '../services/api';
+import TwoFactorForm from '../components/TwoFactorForm';
+
+// MagicLink signs the user in from the link emailed to them
+function MagicLink() {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const [error, setError] = useState('');
+  const [challenge, setChallenge] = useState<{ token: string; redirect: string } | null>(null);
+  // Links only work once, so make sure a re-render doesn't spend it twice
+  const verified = useRef(false);
+
+  useEffect(() => {
+    if (verified.current) {
+      return;
+    }
+    verified.current = true;
+
+    const token = searchParams.get('token');
+    if (!token) {
+      setError('This login link is incomplete. Please request a new one.');
+      return;
+    }
+
+    apiService.verifyMagicLink(token)
+      .then(async (data: any) => {
+        const redirect = safeRedirectPath(data.redirect);
+        if (data.two_factor_required) {
+          setChallenge({ token: data.challenge_token, redirect });
+          return;
+        }
+        await apiService.completeLogin(data);
+        navigate(redirect, { replace: true });
+      })
+      .catch((error: Error) => setError(error.message || 'This login link is invalid.'));
+  }, [searchParams, navigate]);
+
+  const handleTwoFactorSuccess = async (data: any) => {
+    await apiService.completeLogin(data);
+    navigate(challenge ? challenge.redirect : '/home', { replace: true });
+  };
+
+  if (error) {
+    return (
+      <div style={{ textAlign: 'center', marginTop: '50px' }}>
+        <div style={{ color: 'red', marginBottom: '20px' }}>{error}</div>
+        <Link to="/login">Back to login</Link>
+      </div>
+    );
+  }
+  if (challenge) {
+    return <TwoFactorForm challengeToken={challenge.token} onSuccess={handleTwoFactorSuccess} />;
+  }
+  return <div style={{ textAlign: 'center', marginTop: '50px' }}>Signing you in...</div>;
+}
+
+export default MagicLink;
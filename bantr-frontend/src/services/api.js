@@ -10,6 +10,31 @@ class ApiService {
     return localStorage.getItem('token');
   }
 
+  getRefreshToken() {
+    return localStorage.getItem('refresh_token');
+  }
+
+  // Store the tokens and user from a login or refresh response
+  setSession(data) {
+    localStorage.setItem('token', data.token);
+    if (data.refresh_token) {
+      localStorage.setItem('refresh_token', data.refresh_token);
+    }
+    if (data.user) {
+      localStorage.setItem('user', JSON.stringify(data.user));
+    }
+  }
+
+  // Finish a login from tokens alone, as the OAuth callback hands them over
+  // without the user
+  async completeLogin(data) {
+    this.setSession(data);
+    if (!data.user) {
+      const profile = await this.getUserProfile();
+      localStorage.setItem('user', JSON.stringify(profile.user));
+    }
+  }
+
   getUser() {
     const userStr = localStorage.getItem('user');
     return userStr ? JSON.parse(userStr) : null;
@@ -22,10 +47,66 @@ class ApiService {
 
   logout() {
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('user');
   }
 
-  async makeRequest(endpoint, options = {}) {
+  // Swap the refresh token for a new pair. Concurrent 401s share one
+  // request, since a refresh token can only be used once.
+  refreshSession() {
+    if (!this.refreshPromise) {
+      this.refreshPromise = this.requestRefresh().finally(() => {
+        this.refreshPromise = null;
+      });
+    }
+    return this.refreshPromise;
+  }
+
+  // Requests that can't retry on a 401, like the websocket join, use this
+  // to refresh an access token that is about to expire before sending it
+  async getFreshToken() {
+    const token = this.getToken();
+    if (token && this.tokenExpiresSoon(token)) {
+      await this.refreshSession();
+    }
+    return this.getToken();
+  }
+
+  // Whether the JWT expires within the next minute, going by its exp claim
+  tokenExpiresSoon(token) {
+    try {
+      const payload = token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/');
+      const { exp } = JSON.parse(atob(payload));
+      return exp * 1000 - Date.now() < 60 * 1000;
+    } catch (error) {
+      return false;
+    }
+  }
+
+  async requestRefresh() {
+    const refreshToken = this.getRefreshToken();
+    if (!refreshToken) {
+      return false;
+    }
+
+    try {
+      const response = await fetch(`${this.baseURL}/api/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      });
+      if (!response.ok) {
+        return false;
+      }
+      this.setSession(await response.json());
+      return true;
+    } catch (error) {
+      console.error('Token refresh failed:', error);
+      return false;
+    }
+  }
+
+  async makeRequest(endpoint, options = {}, retried = false) {
     const url = `${this.baseURL}${endpoint}`;
     const token = this.getToken();
     const headers = {
@@ -45,7 +126,12 @@ class ApiService {
     try {
       const response = await fetch(url, config);
       
-      if (response.status === 401) {
+      // A 401 without a token is a failed login, not an expired session
+      if (response.status === 401 && token) {
+        // The access token may just have expired; retry once with a new one
+        if (!retried && await this.refreshSession()) {
+          return this.makeRequest(endpoint, options, true);
+        }
         this.logout();
         window.location.href = '/login';
         throw new Error('Unauthorized - please login again');
@@ -100,6 +186,34 @@ class ApiService {
   async googleAuth(token) {
     return this.post('/api/auth/google', { token });
   }
+
+  async requestMagicLink(email, redirect = '/home') {
+    return this.post('/api/auth/magic-link', { email, redirect });
+  }
+
+  async verifyMagicLink(token) {
+    return this.post('/api/auth/magic-link/verify', { token });
+  }
+
+  async verifyTwoFactor(challengeToken, code) {
+    return this.post('/api/auth/2fa', { challenge_token: challengeToken, code });
+  }
+
+  async previewChatLink(token) {
+    return this.post('/api/integrations/chat/links/preview', { token });
+  }
+
+  async confirmChatLink(token) {
+    return this.post('/api/integrations/chat/links', { token, confirm: true });
+  }
+
+  async getInvitation(token) {
+    return this.get(`/api/invitations/${encodeURIComponent(token)}`);
+  }
+
+  async respondToInvitation(token, response) {
+    return this.post(`/api/invitations/${encodeURIComponent(token)}`, { response });
+  }
   async getUserProfile() {
     return this.get('/api/user/profile');
   }
@@ -132,5 +246,13 @@ class ApiService {
   }
 }
 
+// Only follow redirects to paths in this app
+export function safeRedirectPath(path) {
+  if (!path || !path.startsWith('/') || path.startsWith('//') || path.includes('\\')) {
+    return '/home';
+  }
+  return path === '/' ? '/home' : path;
+}
+
 const apiService = new ApiService();
 export default apiService;
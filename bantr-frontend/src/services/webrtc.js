@@ -1,3 +1,5 @@
+import apiService from './api';
+
 class WebRTCService {
   constructor() {
     this.localStream = null;
@@ -99,7 +101,13 @@ class WebRTCService {
     }
   }
 
-  async joinRoom(roomId, userId, userName) {
+  // token is a guest token for this room, or left out to use the access
+  // token. The server works out who is joining from it.
+  async joinRoom(roomId, userId, userName, token) {
+    if (token === undefined) {
+      token = await apiService.getFreshToken();
+    }
+
     return new Promise((resolve, reject) => {
       try {
         this.currentRoomId = roomId;
@@ -118,7 +126,8 @@ class WebRTCService {
             data: {
               room_id: roomId,
               user_id: userId,
-              name: userName
+              name: userName,
+              token
             }
           });
           